@@ -2,16 +2,23 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/bilgehannal/reghost/internal/config"
 	"github.com/bilgehannal/reghost/internal/dns"
+	"github.com/bilgehannal/reghost/internal/platform"
+	"github.com/bilgehannal/reghost/internal/provider"
+	"github.com/bilgehannal/reghost/internal/status"
+	"github.com/bilgehannal/reghost/internal/sysstate"
 	"github.com/bilgehannal/reghost/internal/utils"
 	"github.com/bilgehannal/reghost/internal/watcher"
+	"github.com/bilgehannal/reghost/pkg/reghost"
 )
 
 const (
@@ -56,19 +63,95 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Undo system changes left behind by a previous run that did not shut
+	// down cleanly, e.g. after SIGKILL or a power loss
+	journal := sysstate.NewJournal(sysstate.DefaultPath)
+	system := platform.New(logger, journal)
+	paths := sysstate.DefaultPaths(cfg.HostsSync.HostsPath())
+	leftovers, err := sysstate.Repair(sysstate.DefaultPath, system, paths)
+	for _, leftover := range leftovers {
+		logger.Warn("Undid leftover from a previous run: %s", leftover.Description)
+	}
+	if errors.Is(err, sysstate.ErrRunning) {
+		logger.Error("Another daemon is running: %v", err)
+		os.Exit(1)
+	}
+	if err != nil {
+		logger.Warn("Failed to undo leftovers from a previous run: %v", err)
+	}
+
 	// Create DNS cache
 	cache := dns.NewCache(activeRecords)
 
 	// Create DNS server
-	server := dns.NewServer(cache, logger)
+	server := dns.NewServer(cache, logger, system)
+	server.Configure(cfg)
+	server.SetRecordStore(config.NewWriter(configPath))
+	server.SetJournal(journal)
+	server.SetBindIPFile(sysstate.DefaultBindIPPath)
 
 	// Start DNS server
 	if err := server.Start(); err != nil {
 		logger.Error("Failed to start DNS server: %v", err)
+		server.Shutdown(context.Background())
+		journal.Close()
 		os.Exit(1)
 	}
 
-	logger.Info("DNS server started successfully on %s:53", server.GetBindIP())
+	if server.GetBindIP() != "" {
+		logger.Info("DNS server started successfully on %s:53", server.GetBindIP())
+	}
+
+	// Serve the records of dynamic providers, each as a layer of its own
+	// below the config file: the declared providers in order, then Docker.
+	// Provider settings take effect on start.
+	var providers []reghost.Provider
+	for _, source := range cfg.Providers {
+		providers = append(providers, provider.New(source, logger))
+	}
+	if cfg.Docker != nil {
+		providers = append(providers, provider.NewDocker(cfg.Docker, logger))
+	}
+	providerCtx, stopProviders := context.WithCancel(context.Background())
+	var providersRunning sync.WaitGroup
+	for i, p := range providers {
+		runProvider(providerCtx, &providersRunning, p, dns.ProviderRank+i, server, logger)
+	}
+
+	// Publish the daemon status for reghostctl
+	var statusMu sync.Mutex
+	state := &status.Status{
+		PID:          os.Getpid(),
+		StartedAt:    time.Now(),
+		BindIP:       server.GetBindIP(),
+		ActiveRecord: cfg.Active(),
+	}
+	publishStatus := func() {
+		statusMu.Lock()
+		defer statusMu.Unlock()
+
+		state.UpdatedAt = time.Now()
+		state.Metrics = server.Metrics().Snapshot()
+		if err := status.Write(status.DefaultPath, state); err != nil {
+			logger.Warn("Failed to write status: %v", err)
+		}
+	}
+	publishStatus()
+
+	statusDone := make(chan struct{})
+	defer close(statusDone)
+	go func() {
+		ticker := time.NewTicker(status.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				publishStatus()
+			case <-statusDone:
+				return
+			}
+		}
+	}()
 
 	// Create config watcher
 	w, err := watcher.NewWatcher(configPath, logger, func(newCfg *config.Config) error {
@@ -77,14 +160,26 @@ func main() {
 		// Log new configuration details
 		config.LogConfigInfo(newCfg, logger)
 
-		// Update cache with new active records
+		// Update cache with new active records. The config file is not run
+		// as a provider, since its records must change together with the
+		// zones and server settings configured below.
 		newRecords := newCfg.GetActiveRecords()
 		cache.Update(newRecords)
+		server.Configure(newCfg)
 
-		// Update resolver files based on new active records
-		if err := server.UpdateResolverFiles(newRecords); err != nil {
+		// Update resolver files based on the new records, including those
+		// of runtime layers
+		if err := server.UpdateResolverFiles(cache.GetRecords()); err != nil {
 			logger.Warn("Failed to update resolver files: %v", err)
 		}
+		if err := server.UpdateHostsFile(cache.GetRecords()); err != nil {
+			logger.Warn("Failed to update hosts file: %v", err)
+		}
+
+		statusMu.Lock()
+		state.ActiveRecord = newCfg.Active()
+		statusMu.Unlock()
+		publishStatus()
 
 		logger.Info("✓ Configuration reloaded successfully")
 		return nil
@@ -108,6 +203,10 @@ func main() {
 	logger.Info("Received signal: %v", sig)
 	logger.Info("Shutting down gracefully...")
 
+	// Stop providers first, so none updates what the server cleans up
+	stopProviders()
+	providersRunning.Wait()
+
 	// Shutdown server with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -115,6 +214,27 @@ func main() {
 	if err := server.Shutdown(ctx); err != nil {
 		logger.Error("Error during shutdown: %v", err)
 	}
+	if err := journal.Close(); err != nil {
+		logger.Error("Failed to update state: %v", err)
+	}
+	os.Remove(status.DefaultPath)
 
 	logger.Info("=== reghostd stopped ===")
 }
+
+// runProvider serves the records of a provider as a layer of the given rank
+// until ctx is canceled
+func runProvider(ctx context.Context, wg *sync.WaitGroup, p reghost.Provider, rank int, server *dns.Server, logger *utils.Logger) {
+	logger.Info("Starting %s provider", p.Name())
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err := p.Run(ctx, func(records []reghost.Record) {
+			server.UpdateLayer(p.Name(), rank, records)
+		})
+		if err != nil {
+			logger.Error("The %s provider stopped: %v", p.Name(), err)
+		}
+	}()
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package cli
+
+import "os"
+
+// openAsCaller opens a file for reading. reghostctl is only installed setuid
+// on unix systems, so elsewhere it already runs with the caller's permissions.
+func openAsCaller(path string) (*os.File, error) {
+	return os.Open(path)
+}
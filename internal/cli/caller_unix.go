@@ -0,0 +1,41 @@
+//go:build unix
+
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// openAsCaller opens a file for reading with the permissions of the user
+// running reghostctl. When it is installed setuid root, the effective ids
+// are dropped for the open, so no file the caller cannot read is imported
+// and echoed back.
+func openAsCaller(path string) (*os.File, error) {
+	uid, euid := os.Getuid(), os.Geteuid()
+	gid, egid := os.Getgid(), os.Getegid()
+	if uid == euid && gid == egid {
+		return os.Open(path)
+	}
+
+	if err := syscall.Setegid(gid); err != nil {
+		return nil, fmt.Errorf("failed to drop privileges: %w", err)
+	}
+	if err := syscall.Seteuid(uid); err != nil {
+		syscall.Setegid(egid)
+		return nil, fmt.Errorf("failed to drop privileges: %w", err)
+	}
+
+	file, err := os.Open(path)
+
+	restoreErr := errors.Join(syscall.Seteuid(euid), syscall.Setegid(egid))
+	if restoreErr != nil {
+		if file != nil {
+			file.Close()
+		}
+		return nil, fmt.Errorf("failed to restore privileges: %w", restoreErr)
+	}
+	return file, err
+}
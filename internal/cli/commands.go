@@ -3,8 +3,18 @@ package cli
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/bilgehannal/reghost/internal/config"
+	"github.com/bilgehannal/reghost/internal/convert"
+	"github.com/bilgehannal/reghost/internal/dnssec"
+	"github.com/bilgehannal/reghost/internal/platform"
+	"github.com/bilgehannal/reghost/internal/status"
+	"github.com/bilgehannal/reghost/internal/sysstate"
+	"github.com/bilgehannal/reghost/pkg/reghost"
 	"github.com/spf13/cobra"
 )
 
@@ -18,19 +28,49 @@ func NewRootCommand() *cobra.Command {
 		Use:   "reghostctl",
 		Short: "reghost configuration management tool",
 		Long:  `reghostctl is a CLI tool for managing reghost DNS server configuration.`,
+		// Errors are reported by Execute, in the selected output format
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := cmd.ValidateRequiredFlags(); err != nil {
+				return err
+			}
+			if err := cmd.ValidateFlagGroups(); err != nil {
+				return err
+			}
+			return checkOutputFormat()
+		},
 	}
 
 	cmd.PersistentFlags().StringVarP(&configPath, "config", "c", "/etc/reghost.yml", "Path to config file")
+	cmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", OutputTable, "Output format: table, json or yaml")
 
 	// Add subcommands
 	cmd.AddCommand(newListCommand())
 	cmd.AddCommand(newSetActiveCommand())
+	cmd.AddCommand(newActivateCommand())
+	cmd.AddCommand(newDeactivateCommand())
 	cmd.AddCommand(newAddRecordCommand())
 	cmd.AddCommand(newRemoveRecordCommand())
+	cmd.AddCommand(newUpdateRecordCommand())
+	cmd.AddCommand(newMoveRecordCommand())
 	cmd.AddCommand(newCreateSetCommand())
+	cmd.AddCommand(newRenameSetCommand())
+	cmd.AddCommand(newCopySetCommand())
 	cmd.AddCommand(newDeleteSetCommand())
 	cmd.AddCommand(newShowCommand())
+	cmd.AddCommand(newResolveCommand())
+	cmd.AddCommand(newDNSSECCommand())
+	cmd.AddCommand(newStatusCommand())
+	cmd.AddCommand(newDoctorCommand())
+	cmd.AddCommand(newProjectCommand())
+	cmd.AddCommand(newImportCommand())
+	cmd.AddCommand(newExportCommand())
+	cmd.AddCommand(newHistoryCommand())
+	cmd.AddCommand(newDiffCommand())
+	cmd.AddCommand(newRollbackCommand())
 
+	wrapRunErrors(cmd)
 	return cmd
 }
 
@@ -45,6 +85,9 @@ func newListCommand() *cobra.Command {
 				return fmt.Errorf("failed to load config: %w", err)
 			}
 
+			if structured() {
+				return printStructured(newConfigView(cfg))
+			}
 			PrintConfig(cfg)
 			return nil
 		},
@@ -69,9 +112,52 @@ func newSetActiveCommand() *cobra.Command {
 	}
 }
 
+// newActivateCommand creates the activate command
+func newActivateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "activate <record-set>",
+		Short: "Push a record set on top of the active record sets",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			writer := config.NewWriter(configPath)
+			if err := writer.ActivateRecordSet(args[0]); err != nil {
+				return err
+			}
+
+			fmt.Printf("✓ Activated record set: %s\n", args[0])
+			return nil
+		},
+	}
+}
+
+// newDeactivateCommand creates the deactivate command
+func newDeactivateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "deactivate [record-set]",
+		Short: "Remove a record set from the active record sets (the top one by default)",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := ""
+			if len(args) == 1 {
+				name = args[0]
+			}
+
+			writer := config.NewWriter(configPath)
+			removed, err := writer.DeactivateRecordSet(name)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("✓ Deactivated record set: %s\n", removed)
+			return nil
+		},
+	}
+}
+
 // newAddRecordCommand creates the add-record command
 func newAddRecordCommand() *cobra.Command {
 	var (
+		id     string
 		domain string
 		ip     string
 	)
@@ -82,6 +168,7 @@ func newAddRecordCommand() *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			record := config.Record{
+				ID:     id,
 				Domain: domain,
 				IP:     ip,
 			}
@@ -96,6 +183,7 @@ func newAddRecordCommand() *cobra.Command {
 		},
 	}
 
+	cmd.Flags().StringVar(&id, "id", "", "Stable ID to address the record by (optional)")
 	cmd.Flags().StringVarP(&domain, "domain", "d", "", "Domain pattern (required)")
 	cmd.Flags().StringVarP(&ip, "ip", "i", "", "IP address (required)")
 	cmd.MarkFlagRequired("domain")
@@ -106,7 +194,10 @@ func newAddRecordCommand() *cobra.Command {
 
 // newRemoveRecordCommand creates the remove-record command
 func newRemoveRecordCommand() *cobra.Command {
-	var index int
+	var (
+		selector config.RecordSelector
+		dryRun   bool
+	)
 
 	cmd := &cobra.Command{
 		Use:   "remove-record <record-set>",
@@ -114,30 +205,136 @@ func newRemoveRecordCommand() *cobra.Command {
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			writer := config.NewWriter(configPath)
-			if err := writer.RemoveRecord(args[0], index); err != nil {
+			writer.SetDryRun(dryRun)
+			change, err := writer.RemoveRecordBy(args[0], selector)
+			if err != nil {
 				return err
 			}
 
-			fmt.Printf("✓ Record removed from '%s' at index %d\n", args[0], index)
+			PrintRecordChange(change, dryRun)
 			return nil
 		},
 	}
 
-	cmd.Flags().IntVarP(&index, "index", "i", -1, "Index of the record to remove (required)")
-	cmd.MarkFlagRequired("index")
+	cmd.Flags().IntVarP(&selector.Index, "index", "i", -1, "Index of the record to remove")
+	cmd.Flags().StringVar(&selector.ID, "id", "", "ID of the record to remove")
+	cmd.Flags().StringVarP(&selector.Domain, "domain", "d", "", "Domain of the record to remove")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the record that would be removed without removing it")
+	cmd.MarkFlagsOneRequired("index", "id", "domain")
+	cmd.MarkFlagsMutuallyExclusive("index", "id", "domain")
+
+	return cmd
+}
+
+// newUpdateRecordCommand creates the update-record command
+func newUpdateRecordCommand() *cobra.Command {
+	var (
+		selector config.RecordSelector
+		id       string
+		domain   string
+		ip       string
+		dryRun   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "update-record <record-set>",
+		Short: "Change the ID, domain or IP of a record",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			changeID := cmd.Flags().Changed("set-id")
+			changeDomain := cmd.Flags().Changed("set-domain")
+			changeIP := cmd.Flags().Changed("set-ip")
+			if !changeID && !changeDomain && !changeIP {
+				return fmt.Errorf("nothing to update: set --set-domain, --set-ip and/or --set-id")
+			}
+
+			writer := config.NewWriter(configPath)
+			writer.SetDryRun(dryRun)
+			change, err := writer.UpdateRecordBy(args[0], selector, func(record *reghost.Record) {
+				if changeID {
+					record.ID = id
+				}
+				if changeDomain {
+					record.Domain = domain
+				}
+				if changeIP {
+					record.IP = ip
+				}
+			})
+			if err != nil {
+				return err
+			}
+
+			PrintRecordChange(change, dryRun)
+			return nil
+		},
+	}
+
+	// The record is picked like in remove-record; the new values are set-*
+	cmd.Flags().IntVarP(&selector.Index, "index", "i", -1, "Index of the record to update")
+	cmd.Flags().StringVar(&selector.ID, "id", "", "ID of the record to update")
+	cmd.Flags().StringVarP(&selector.Domain, "domain", "d", "", "Domain of the record to update")
+	cmd.Flags().StringVar(&id, "set-id", "", "New ID (empty to use the derived ID)")
+	cmd.Flags().StringVar(&domain, "set-domain", "", "New domain pattern")
+	cmd.Flags().StringVar(&ip, "set-ip", "", "New IP address")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show the change without writing it")
+	cmd.MarkFlagsOneRequired("index", "id", "domain")
+	cmd.MarkFlagsMutuallyExclusive("index", "id", "domain")
+
+	return cmd
+}
+
+// newMoveRecordCommand creates the move-record command
+func newMoveRecordCommand() *cobra.Command {
+	var from, to int
+
+	cmd := &cobra.Command{
+		Use:   "move-record <record-set>",
+		Short: "Move a record to another position; earlier records take precedence",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			writer := config.NewWriter(configPath)
+			if err := writer.MoveRecord(args[0], from, to); err != nil {
+				return err
+			}
+
+			fmt.Printf("✓ Record in '%s' moved from index %d to %d\n", args[0], from, to)
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&from, "from", -1, "Current index of the record (required)")
+	cmd.Flags().IntVar(&to, "to", -1, "New index of the record (required)")
+	cmd.MarkFlagRequired("from")
+	cmd.MarkFlagRequired("to")
 
 	return cmd
 }
 
 // newCreateSetCommand creates the create-set command
 func newCreateSetCommand() *cobra.Command {
-	return &cobra.Command{
+	var (
+		from  string
+		empty bool
+	)
+
+	cmd := &cobra.Command{
 		Use:   "create-set <record-set>",
 		Short: "Create a new record set",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			writer := config.NewWriter(configPath)
-			if err := writer.CreateRecordSet(args[0]); err != nil {
+
+			var err error
+			switch {
+			case from != "":
+				err = writer.CopyRecordSet(from, args[0])
+			case empty:
+				err = writer.CreateEmptyRecordSet(args[0])
+			default:
+				err = writer.CreateRecordSet(args[0])
+			}
+			if err != nil {
 				return err
 			}
 
@@ -145,6 +342,48 @@ func newCreateSetCommand() *cobra.Command {
 			return nil
 		},
 	}
+
+	cmd.Flags().StringVar(&from, "from", "", "Copy the records of an existing record set")
+	cmd.Flags().BoolVar(&empty, "empty", false, "Create the record set without the reghost.local placeholder")
+	cmd.MarkFlagsMutuallyExclusive("from", "empty")
+
+	return cmd
+}
+
+// newRenameSetCommand creates the rename-set command
+func newRenameSetCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "rename-set <record-set> <new-name>",
+		Short: "Rename a record set, updating every reference to it",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			writer := config.NewWriter(configPath)
+			if err := writer.RenameRecordSet(args[0], args[1]); err != nil {
+				return err
+			}
+
+			fmt.Printf("✓ Record set '%s' renamed to '%s'\n", args[0], args[1])
+			return nil
+		},
+	}
+}
+
+// newCopySetCommand creates the copy-set command
+func newCopySetCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "copy-set <record-set> <new-name>",
+		Short: "Copy a record set under a new name",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			writer := config.NewWriter(configPath)
+			if err := writer.CopyRecordSet(args[0], args[1]); err != nil {
+				return err
+			}
+
+			fmt.Printf("✓ Record set '%s' copied to '%s'\n", args[0], args[1])
+			return nil
+		},
+	}
 }
 
 // newDeleteSetCommand creates the delete-set command
@@ -168,24 +407,557 @@ func newDeleteSetCommand() *cobra.Command {
 // newShowCommand creates the show command
 func newShowCommand() *cobra.Command {
 	return &cobra.Command{
-		Use:   "show",
-		Short: "Show active record set",
+		Use:   "show [record-set]",
+		Short: "Show the active record set, or the resolved rules of a record set",
+		Args:  cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			cfg, err := config.Load(configPath)
 			if err != nil {
 				return fmt.Errorf("failed to load config: %w", err)
 			}
 
+			if len(args) == 1 {
+				if _, exists := cfg.Records[args[0]]; !exists {
+					return reghost.NotFound("record set '%s' does not exist", args[0])
+				}
+				if structured() {
+					return printStructured(rulesView{
+						RecordSet: args[0],
+						Extends:   cfg.Extends[args[0]],
+						Records:   newRecordViews(cfg.GetRecordSet(args[0])),
+					})
+				}
+				PrintRecordSet(cfg, args[0])
+				return nil
+			}
+
+			if structured() {
+				return printStructured(rulesView{
+					ActiveRecord: append([]string{}, cfg.Active()...),
+					Records:      newRecordViews(cfg.GetActiveRecords()),
+				})
+			}
 			PrintActiveRecord(cfg)
 			return nil
 		},
 	}
 }
 
-// Execute runs the CLI
+// newResolveCommand creates the resolve command
+func newResolveCommand() *cobra.Command {
+	var recordSet string
+
+	cmd := &cobra.Command{
+		Use:   "resolve <domain>",
+		Short: "Show the rule answering for a domain",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			records := cfg.GetActiveRecords()
+			if recordSet != "" {
+				if _, exists := cfg.Records[recordSet]; !exists {
+					return reghost.NotFound("record set '%s' does not exist", recordSet)
+				}
+				records = cfg.GetRecordSet(recordSet)
+			}
+
+			record, ok := reghost.NewResolver(records).ResolveRecord(args[0])
+			if !ok {
+				return reghost.NotFound("no rule matches '%s'", args[0])
+			}
+
+			view := resolveView{Domain: args[0], IP: record.IP}
+			for i, rule := range newRecordViews(records) {
+				if records[i] == record {
+					view.Rule = rule
+					break
+				}
+			}
+			if structured() {
+				return printStructured(view)
+			}
+			PrintResolve(view)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&recordSet, "record-set", "r", "", "Resolve against a record set instead of the active ones")
+
+	return cmd
+}
+
+// newDNSSECCommand creates the dnssec command
+func newDNSSECCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dnssec",
+		Short: "Manage DNSSEC keys of signed zones",
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "ds [zone...]",
+		Short: "Print the DS records to install in the parent zones",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+			if cfg.DNSSEC == nil {
+				return fmt.Errorf("dnssec is not enabled in %s", configPath)
+			}
+
+			zones := args
+			if len(zones) == 0 {
+				for _, zone := range cfg.Zones {
+					zones = append(zones, zone.Origin())
+				}
+			}
+
+			for _, zone := range zones {
+				if found := reghost.FindZone(cfg.Zones, zone); found == nil || found.Origin() != reghost.Fqdn(zone) {
+					return fmt.Errorf("zone '%s' is not configured", zone)
+				}
+
+				keys, err := dnssec.Load(cfg.DNSSEC, zone)
+				if err != nil {
+					return fmt.Errorf("failed to load keys for %s (they are generated when reghostd starts): %w", zone, err)
+				}
+				fmt.Println(keys.DS().String())
+			}
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+// newStatusCommand creates the status command
+func newStatusCommand() *cobra.Command {
+	var statusPath string
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the daemon status and query counters",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := status.Read(statusPath)
+			if err != nil {
+				return err
+			}
+
+			if structured() {
+				return printStructured(newStatusView(s, time.Now()))
+			}
+			PrintStatus(s)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&statusPath, "status-file", status.DefaultPath, "Path to the daemon status file")
+
+	return cmd
+}
+
+// newDoctorCommand creates the doctor command
+func newDoctorCommand() *cobra.Command {
+	var (
+		statePath string
+		fix       bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Find and undo system changes left behind by a crashed daemon",
+		Long: `Find system changes recorded by a reghostd that did not shut down cleanly,
+such as a nameserver in resolv.conf, loopback aliases, resolver files or a
+managed block in the hosts file. With --fix, undo them.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// The state file and config name the files to change
+			if err := refuseWhenSetuid(cmd, "state-file", "config"); err != nil {
+				return err
+			}
+
+			state, err := sysstate.Load(statePath)
+			if err != nil {
+				return err
+			}
+
+			result := doctorView{StateFile: statePath}
+			if state != nil && state.Running() {
+				result.RunningPID = state.PID
+				if fix {
+					return fmt.Errorf("%w with pid %d, its changes are in use", sysstate.ErrRunning, state.PID)
+				}
+			}
+
+			// The hosts file is only known from a valid config
+			var hostsSync *reghost.HostsSync
+			if cfg, err := config.Load(configPath); err == nil {
+				hostsSync = cfg.HostsSync
+			}
+			paths := sysstate.DefaultPaths(hostsSync.HostsPath())
+
+			system := platform.New(nil, nil)
+			var leftovers []sysstate.Leftover
+			if fix {
+				leftovers, err = sysstate.Repair(statePath, system, paths)
+				result.Fixed = err == nil
+			} else if state != nil && result.RunningPID == 0 {
+				leftovers = sysstate.Leftovers(state, system, paths)
+			}
+			for _, leftover := range leftovers {
+				result.Leftovers = append(result.Leftovers, leftover.Description)
+			}
+			if err != nil {
+				return err
+			}
+
+			if structured() {
+				return printStructured(result)
+			}
+			PrintDoctor(result)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&statePath, "state-file", sysstate.DefaultPath, "Path to the daemon state file")
+	cmd.Flags().BoolVar(&fix, "fix", false, "Undo the changes found")
+
+	return cmd
+}
+
+// newProjectCommand creates the project command
+func newProjectCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "project",
+		Short: "Manage project-level .reghost.yml files",
+	}
+
+	var name string
+	register := &cobra.Command{
+		Use:   "register <dir>",
+		Short: "Register a project directory holding a .reghost.yml",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir, err := filepath.Abs(args[0])
+			if err != nil {
+				return fmt.Errorf("invalid project directory: %w", err)
+			}
+
+			project := reghost.Project{Name: name, Path: dir}
+			if project.Name == "" {
+				project.Name = filepath.Base(dir)
+			}
+
+			writer := config.NewWriter(configPath)
+			if err := writer.RegisterProject(project); err != nil {
+				return err
+			}
+
+			fmt.Printf("✓ Registered project %s as record set %s\n", project.Name, project.SetName())
+			if _, err := os.Stat(config.ProjectFilePath(project)); err != nil {
+				fmt.Printf("  Note: %s does not exist yet\n", config.ProjectFilePath(project))
+			}
+			return nil
+		},
+	}
+	register.Flags().StringVarP(&name, "name", "n", "", "Project name (defaults to the directory name)")
+
+	unregister := &cobra.Command{
+		Use:   "unregister <name|dir>",
+		Short: "Unregister a project",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			target := args[0]
+			if dir, err := filepath.Abs(target); err == nil && strings.ContainsRune(target, os.PathSeparator) {
+				target = dir
+			}
+
+			writer := config.NewWriter(configPath)
+			project, err := writer.UnregisterProject(target)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("✓ Unregistered project %s\n", project.Name)
+			return nil
+		},
+	}
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List registered projects and their status",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.LoadUnchecked(configPath)
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			if structured() {
+				return printStructured(newProjectViews(config.ProjectStates(cfg)))
+			}
+			PrintProjects(config.ProjectStates(cfg))
+			return nil
+		},
+	}
+
+	cmd.AddCommand(register, unregister, list)
+	return cmd
+}
+
+// newImportCommand creates the import command
+func newImportCommand() *cobra.Command {
+	var (
+		format  string
+		set     string
+		origin  string
+		replace bool
+		dryRun  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "import <file>",
+		Short: "Import records from a hosts file, dnsmasq configuration, zone file or JSON",
+		Long: `Import records from a hosts file, dnsmasq configuration, zone file or JSON
+export into a record set. Records are added to the set unless --replace is
+given. Use - to read from standard input.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			input := os.Stdin
+			if args[0] != "-" {
+				file, err := openAsCaller(args[0])
+				if err != nil {
+					return fmt.Errorf("failed to open %s: %w", args[0], err)
+				}
+				defer file.Close()
+				input = file
+			}
+
+			imported, issues, err := convert.Import(format, input, origin)
+			if err != nil {
+				return err
+			}
+
+			result := importView{Set: set, Imported: len(imported), Replaced: replace}
+			writer := config.NewWriter(configPath)
+			writer.SetDryRun(dryRun)
+			err = writer.ModifyRecordSet(set, func(records []reghost.Record) ([]reghost.Record, error) {
+				if replace {
+					result.Added = len(imported)
+					return imported, nil
+				}
+				merged := convert.MergeRecords(records, imported)
+				result.Added = len(merged) - len(records)
+				return merged, nil
+			})
+			if err != nil {
+				return err
+			}
+
+			for _, issue := range issues {
+				result.Skipped = append(result.Skipped, issueView{Line: issue.Line, Text: issue.Text, Reason: issue.Reason})
+			}
+			if structured() {
+				return printStructured(result)
+			}
+			PrintImport(result, dryRun)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "f", "", "Input format: hosts, dnsmasq, zone or json (required)")
+	cmd.Flags().StringVarP(&set, "set", "s", "", "Record set to import into, created if needed (required)")
+	cmd.Flags().StringVar(&origin, "origin", ".", "Origin of relative names in zone files without $ORIGIN")
+	cmd.Flags().BoolVar(&replace, "replace", false, "Replace the records of the set instead of adding to them")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be imported without writing it")
+	cmd.MarkFlagRequired("format")
+	cmd.MarkFlagRequired("set")
+
+	return cmd
+}
+
+// newExportCommand creates the export command
+func newExportCommand() *cobra.Command {
+	var (
+		format string
+		set    string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export a record set as a hosts file, dnsmasq, CoreDNS or zone configuration",
+		Long: `Export a record set, including the records it inherits, to standard output
+as a hosts file, dnsmasq configuration, CoreDNS Corefile, zone file or JSON.
+
+Regex rules are expanded into the sample hostnames of the config that they
+answer for. Regex rules that match no sample are written as comments and
+reported on standard error.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.Load(configPath)
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			issues, err := convert.Export(os.Stdout, format, cfg, set)
+			if err != nil {
+				return err
+			}
+			for _, issue := range issues {
+				fmt.Fprintf(os.Stderr, "⚠️  %s\n", issue)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "f", "", "Output format: hosts, dnsmasq, corefile, zone or json (required)")
+	cmd.Flags().StringVarP(&set, "set", "s", "", "Record set to export (required)")
+	cmd.MarkFlagRequired("format")
+	cmd.MarkFlagRequired("set")
+
+	return cmd
+}
+
+// newHistoryCommand creates the history command
+func newHistoryCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "history",
+		Short: "List previous versions of the configuration",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := refuseWhenSetuid(cmd, "config"); err != nil {
+				return err
+			}
+
+			entries, err := config.History(configPath)
+			if err != nil {
+				return err
+			}
+
+			current := 0
+			if len(entries) > 0 && entries[len(entries)-1].IsCurrent(configPath) {
+				current = entries[len(entries)-1].Revision
+			}
+
+			if structured() {
+				return printStructured(newHistoryViews(entries, current))
+			}
+			PrintHistory(entries, current)
+			return nil
+		},
+	}
+}
+
+// newDiffCommand creates the diff command
+func newDiffCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "diff <revision>",
+		Short: "Show the changes made to the configuration since a revision",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// The history names the files diffed
+			if err := refuseWhenSetuid(cmd, "config"); err != nil {
+				return err
+			}
+
+			revision, err := parseRevision(args[0])
+			if err != nil {
+				return err
+			}
+
+			diff, err := config.Diff(configPath, revision)
+			if err != nil {
+				return err
+			}
+
+			if diff == "" {
+				fmt.Printf("No changes since revision %d\n", revision)
+				return nil
+			}
+			fmt.Print(diff)
+			return nil
+		},
+	}
+}
+
+// newRollbackCommand creates the rollback command
+func newRollbackCommand() *cobra.Command {
+	var undo bool
+
+	cmd := &cobra.Command{
+		Use:   "rollback <revision> | --undo",
+		Short: "Restore a previous version of the configuration",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if undo {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// The history names the files restored
+			if err := refuseWhenSetuid(cmd, "config"); err != nil {
+				return err
+			}
+
+			writer := config.NewWriter(configPath)
+
+			if undo {
+				revision, err := writer.Undo()
+				if err != nil {
+					return err
+				}
+				fmt.Printf("✓ Undid the last change, configuration restored to revision %d\n", revision)
+				return nil
+			}
+
+			revision, err := parseRevision(args[0])
+			if err != nil {
+				return err
+			}
+			if err := writer.Rollback(revision); err != nil {
+				return err
+			}
+
+			fmt.Printf("✓ Configuration restored to revision %d\n", revision)
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&undo, "undo", false, "Revert the last change")
+
+	return cmd
+}
+
+// parseRevision parses a history revision argument
+func parseRevision(arg string) (int, error) {
+	revision, err := strconv.Atoi(arg)
+	if err != nil || revision <= 0 {
+		return 0, fmt.Errorf("invalid revision '%s'", arg)
+	}
+	return revision, nil
+}
+
+// refuseWhenSetuid fails if one of flags is set while reghostctl runs
+// setuid root, for flags that name the files a command reads or changes
+func refuseWhenSetuid(cmd *cobra.Command, flags ...string) error {
+	if os.Geteuid() == os.Getuid() {
+		return nil
+	}
+	for _, flag := range flags {
+		if cmd.Flags().Changed(flag) {
+			return fmt.Errorf("--%s is not allowed when running setuid", flag)
+		}
+	}
+	return nil
+}
+
+// Execute runs the CLI. Errors are written to stderr, and the exit code
+// tells usage errors, invalid configs, missing items, I/O failures and
+// conflicting writes apart.
 func Execute() {
-	if err := NewRootCommand().Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+	cmd, err := NewRootCommand().ExecuteC()
+	if err != nil {
+		os.Exit(reportError(os.Stderr, cmd, err))
 	}
 }
@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/bilgehannal/reghost/internal/config"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of reghostctl
+const (
+	ExitOK            = 0
+	ExitError         = 1
+	ExitUsage         = 2
+	ExitInvalidConfig = 3
+	ExitNotFound      = 4
+	ExitIO            = 5
+	ExitConflict      = 6
+)
+
+// Error kinds reported in structured error output
+const (
+	ErrorKindGeneric       = "error"
+	ErrorKindUsage         = "usage"
+	ErrorKindInvalidConfig = "invalid_config"
+	ErrorKindNotFound      = "not_found"
+	ErrorKindIO            = "io"
+	ErrorKindConflict      = "conflict"
+)
+
+// errorView is the structured form of an error
+type errorView struct {
+	Error errorDetail `json:"error" yaml:"error"`
+}
+
+// errorDetail describes an error in structured output
+type errorDetail struct {
+	Kind     string `json:"kind" yaml:"kind"`
+	ExitCode int    `json:"exitCode" yaml:"exitCode"`
+	Message  string `json:"message" yaml:"message"`
+}
+
+// commandError wraps an error returned once flags and arguments were
+// accepted, so it is not reported as a usage error
+type commandError struct {
+	err error
+}
+
+func (e *commandError) Error() string { return e.err.Error() }
+func (e *commandError) Unwrap() error { return e.err }
+
+// wrapRunErrors marks the errors returned by the run functions of cmd and its
+// subcommands as command errors
+func wrapRunErrors(cmd *cobra.Command) {
+	if run := cmd.RunE; run != nil {
+		cmd.RunE = func(cmd *cobra.Command, args []string) error {
+			if err := run(cmd, args); err != nil {
+				return &commandError{err: err}
+			}
+			return nil
+		}
+	}
+	for _, sub := range cmd.Commands() {
+		wrapRunErrors(sub)
+	}
+}
+
+// ExitCode returns the exit code reghostctl uses for an error returned by
+// the root command
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	_, code := classifyError(err)
+	return code
+}
+
+// classifyError returns the kind and exit code of an error
+func classifyError(err error) (string, int) {
+	var notFound *reghost.ErrNotFound
+	var pathErr *fs.PathError
+	var linkErr *os.LinkError
+	var syscallErr *os.SyscallError
+	var cmdErr *commandError
+
+	switch {
+	case !errors.As(err, &cmdErr):
+		return ErrorKindUsage, ExitUsage
+	case errors.Is(err, config.ErrConflict), errors.Is(err, config.ErrLocked):
+		return ErrorKindConflict, ExitConflict
+	case errors.Is(err, config.ErrInvalidConfig):
+		return ErrorKindInvalidConfig, ExitInvalidConfig
+	case errors.As(err, &notFound):
+		return ErrorKindNotFound, ExitNotFound
+	case errors.As(err, &pathErr), errors.As(err, &linkErr), errors.As(err, &syscallErr):
+		return ErrorKindIO, ExitIO
+	default:
+		return ErrorKindGeneric, ExitError
+	}
+}
+
+// reportError writes an error of cmd to w in the selected output format and
+// returns the exit code
+func reportError(w io.Writer, cmd *cobra.Command, err error) int {
+	kind, code := classifyError(err)
+
+	if structured() {
+		view := errorView{Error: errorDetail{Kind: kind, ExitCode: code, Message: err.Error()}}
+		if writeStructured(w, view) == nil {
+			return code
+		}
+	}
+
+	fmt.Fprintf(w, "Error: %v\n", err)
+	if kind == ErrorKindUsage && cmd != nil {
+		fmt.Fprintf(w, "\n%s", cmd.UsageString())
+	}
+	return code
+}
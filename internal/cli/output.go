@@ -0,0 +1,249 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/bilgehannal/reghost/internal/config"
+	"github.com/bilgehannal/reghost/internal/dns"
+	"github.com/bilgehannal/reghost/internal/status"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats selected with --output
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
+)
+
+var outputFormat = OutputTable
+
+// checkOutputFormat validates the --output flag
+func checkOutputFormat() error {
+	switch outputFormat {
+	case OutputTable, OutputJSON, OutputYAML:
+		return nil
+	default:
+		return fmt.Errorf("invalid output format '%s' (want table, json or yaml)", outputFormat)
+	}
+}
+
+// structured reports whether a machine-readable output format is selected
+func structured() bool {
+	return outputFormat == OutputJSON || outputFormat == OutputYAML
+}
+
+// writeStructured writes v in the selected machine-readable format
+func writeStructured(w io.Writer, v interface{}) error {
+	if outputFormat == OutputYAML {
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return enc.Close()
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printStructured writes v to stdout in the selected machine-readable format
+func printStructured(v interface{}) error {
+	return writeStructured(os.Stdout, v)
+}
+
+// recordView is a record in machine-readable output
+type recordView struct {
+	Index  int    `json:"index" yaml:"index"`
+	ID     string `json:"id" yaml:"id"`
+	Domain string `json:"domain" yaml:"domain"`
+	IP     string `json:"ip" yaml:"ip"`
+	Set    string `json:"set,omitempty" yaml:"set,omitempty"`
+}
+
+// recordSetView is a record set in machine-readable output
+type recordSetView struct {
+	Name    string       `json:"name" yaml:"name"`
+	Active  bool         `json:"active" yaml:"active"`
+	Extends []string     `json:"extends,omitempty" yaml:"extends,omitempty"`
+	Source  string       `json:"source,omitempty" yaml:"source,omitempty"`
+	Records []recordView `json:"records" yaml:"records"`
+}
+
+// configView is the output of list
+type configView struct {
+	ActiveRecord []string        `json:"activeRecord" yaml:"activeRecord"`
+	RecordSets   []recordSetView `json:"recordSets" yaml:"recordSets"`
+}
+
+// rulesView is the output of show: the merged active rules, or the resolved
+// rules of one record set
+type rulesView struct {
+	ActiveRecord []string     `json:"activeRecord,omitempty" yaml:"activeRecord,omitempty"`
+	RecordSet    string       `json:"recordSet,omitempty" yaml:"recordSet,omitempty"`
+	Extends      []string     `json:"extends,omitempty" yaml:"extends,omitempty"`
+	Records      []recordView `json:"records" yaml:"records"`
+}
+
+// statusView is the output of status
+type statusView struct {
+	State        string              `json:"state" yaml:"state"`
+	PID          int                 `json:"pid" yaml:"pid"`
+	StartedAt    time.Time           `json:"startedAt" yaml:"startedAt"`
+	UpdatedAt    time.Time           `json:"updatedAt" yaml:"updatedAt"`
+	BindIP       string              `json:"bindIP" yaml:"bindIP"`
+	ActiveRecord []string            `json:"activeRecord" yaml:"activeRecord"`
+	Metrics      dns.MetricsSnapshot `json:"metrics" yaml:"metrics"`
+}
+
+// resolveView is the output of resolve
+type resolveView struct {
+	Domain string     `json:"domain" yaml:"domain"`
+	IP     string     `json:"ip" yaml:"ip"`
+	Rule   recordView `json:"rule" yaml:"rule"`
+}
+
+// doctorView is the output of doctor
+type doctorView struct {
+	StateFile  string   `json:"stateFile" yaml:"stateFile"`
+	RunningPID int      `json:"runningPID,omitempty" yaml:"runningPID,omitempty"`
+	Leftovers  []string `json:"leftovers" yaml:"leftovers"`
+	Fixed      bool     `json:"fixed" yaml:"fixed"`
+}
+
+// importView is the output of import
+type importView struct {
+	Set      string      `json:"set" yaml:"set"`
+	Imported int         `json:"imported" yaml:"imported"`
+	Added    int         `json:"added" yaml:"added"`
+	Replaced bool        `json:"replaced" yaml:"replaced"`
+	Skipped  []issueView `json:"skipped" yaml:"skipped"`
+}
+
+// issueView is an entry that could not be imported
+type issueView struct {
+	Line   int    `json:"line,omitempty" yaml:"line,omitempty"`
+	Text   string `json:"text" yaml:"text"`
+	Reason string `json:"reason" yaml:"reason"`
+}
+
+// historyView is an entry of the output of history
+type historyView struct {
+	Revision int       `json:"revision" yaml:"revision"`
+	Time     time.Time `json:"time" yaml:"time"`
+	User     string    `json:"user" yaml:"user"`
+	Command  string    `json:"command" yaml:"command"`
+	Current  bool      `json:"current" yaml:"current"`
+}
+
+// projectView is an entry of the output of project list
+type projectView struct {
+	Name    string `json:"name" yaml:"name"`
+	Path    string `json:"path" yaml:"path"`
+	File    string `json:"file" yaml:"file"`
+	Status  string `json:"status" yaml:"status"`
+	Records int    `json:"records" yaml:"records"`
+	Error   string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// sortedSetNames returns the names of the record sets in order
+func sortedSetNames(cfg *reghost.Config) []string {
+	names := make([]string, 0, len(cfg.Records))
+	for name := range cfg.Records {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newRecordViews converts records for machine-readable output
+func newRecordViews(records []reghost.Record) []recordView {
+	views := make([]recordView, len(records))
+	for i, record := range records {
+		views[i] = recordView{
+			Index:  i,
+			ID:     record.RecordID(),
+			Domain: record.Domain,
+			IP:     record.IP,
+			Set:    record.Set,
+		}
+	}
+	return views
+}
+
+// newConfigView builds the output of list
+func newConfigView(cfg *reghost.Config) configView {
+	view := configView{
+		ActiveRecord: append([]string{}, cfg.Active()...),
+		RecordSets:   make([]recordSetView, 0, len(cfg.Records)),
+	}
+	for _, name := range sortedSetNames(cfg) {
+		view.RecordSets = append(view.RecordSets, recordSetView{
+			Name:    name,
+			Active:  cfg.Active().Contains(name),
+			Extends: cfg.Extends[name],
+			Source:  cfg.Sources[name],
+			Records: newRecordViews(cfg.Records[name]),
+		})
+	}
+	return view
+}
+
+// newStatusView builds the output of status
+func newStatusView(s *status.Status, now time.Time) statusView {
+	state := "running"
+	if s.Stale(now) {
+		state = "stale"
+	}
+	return statusView{
+		State:        state,
+		PID:          s.PID,
+		StartedAt:    s.StartedAt,
+		UpdatedAt:    s.UpdatedAt,
+		BindIP:       s.BindIP,
+		ActiveRecord: append([]string{}, s.ActiveRecord...),
+		Metrics:      s.Metrics,
+	}
+}
+
+// newHistoryViews builds the output of history, newest first
+func newHistoryViews(entries []config.HistoryEntry, current int) []historyView {
+	views := make([]historyView, 0, len(entries))
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		views = append(views, historyView{
+			Revision: entry.Revision,
+			Time:     entry.Time,
+			User:     entry.User,
+			Command:  entry.Command,
+			Current:  entry.Revision == current,
+		})
+	}
+	return views
+}
+
+// newProjectViews builds the output of project list
+func newProjectViews(states []config.ProjectState) []projectView {
+	views := make([]projectView, len(states))
+	for i, state := range states {
+		views[i] = projectView{
+			Name:    state.Name,
+			Path:    state.Path,
+			File:    state.File,
+			Status:  state.Status,
+			Records: state.Records,
+		}
+		if state.Error != nil {
+			views[i].Error = state.Error.Error()
+		}
+	}
+	return views
+}
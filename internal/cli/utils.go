@@ -2,33 +2,45 @@ package cli
 
 import (
 	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
 
+	"github.com/bilgehannal/reghost/internal/config"
+	"github.com/bilgehannal/reghost/internal/status"
 	"github.com/bilgehannal/reghost/pkg/reghost"
 )
 
 // PrintConfig prints the configuration in a human-readable format
 func PrintConfig(cfg *reghost.Config) {
 	fmt.Printf("\n=== reghost Configuration ===\n\n")
-	fmt.Printf("Active Record Set: %s\n\n", cfg.ActiveRecord)
+	fmt.Printf("Active Record Set: %s\n\n", cfg.Active().String())
 
 	fmt.Println("Record Sets:")
-	for name, records := range cfg.Records {
+	for _, name := range sortedSetNames(cfg) {
+		records := cfg.Records[name]
 		marker := " "
-		if name == cfg.ActiveRecord {
+		if cfg.Active().Contains(name) {
 			marker = "*"
 		}
-		fmt.Printf("  %s %s (%d records)\n", marker, name, len(records))
+		if parents := cfg.Extends[name]; len(parents) > 0 {
+			fmt.Printf("  %s %s (%d records, extends %s)\n", marker, name, len(records), reghost.RecordSetNames(parents).String())
+		} else {
+			fmt.Printf("  %s %s (%d records)\n", marker, name, len(records))
+		}
 
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
 		for i, record := range records {
-			fmt.Printf("    [%d] %s -> %s\n", i, record.Domain, record.IP)
+			fmt.Fprintf(tw, "    [%d]\t%s\t-> %s\t(id %s)\n", i, record.Domain, record.IP, record.RecordID())
 		}
+		tw.Flush()
 		fmt.Println()
 	}
 }
 
 // PrintActiveRecord prints only the active record set
 func PrintActiveRecord(cfg *reghost.Config) {
-	fmt.Printf("\n=== Active Record Set: %s ===\n\n", cfg.ActiveRecord)
+	fmt.Printf("\n=== Active Record Set: %s ===\n\n", cfg.Active().String())
 
 	activeRecords := cfg.GetActiveRecords()
 	if len(activeRecords) == 0 {
@@ -36,9 +48,203 @@ func PrintActiveRecord(cfg *reghost.Config) {
 		return
 	}
 
-	fmt.Printf("Records (%d total):\n", len(activeRecords))
-	for i, record := range activeRecords {
-		fmt.Printf("  [%d] %s -> %s\n", i, record.Domain, record.IP)
+	printRules(activeRecords)
+}
+
+// PrintRecordSet prints the resolved rules of a record set, including the
+// rules it inherits
+func PrintRecordSet(cfg *reghost.Config, name string) {
+	fmt.Printf("\n=== Record Set: %s ===\n\n", name)
+	if parents := cfg.Extends[name]; len(parents) > 0 {
+		fmt.Printf("Extends: %s\n\n", reghost.RecordSetNames(parents).String())
+	}
+
+	records := cfg.GetRecordSet(name)
+	if len(records) == 0 {
+		fmt.Println("No records found in record set")
+		return
+	}
+
+	printRules(records)
+}
+
+// printRules prints merged rules, naming the set each rule came from when
+// they come from more than one set
+func printRules(records []reghost.Record) {
+	provenance := false
+	for _, record := range records {
+		if record.Set != records[0].Set {
+			provenance = true
+			break
+		}
+	}
+
+	fmt.Printf("Records (%d total):\n", len(records))
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, record := range records {
+		if provenance {
+			fmt.Fprintf(tw, "  [%d]\t%s\t-> %s\t(id %s, from %s)\n", i, record.Domain, record.IP, record.RecordID(), record.Set)
+			continue
+		}
+		fmt.Fprintf(tw, "  [%d]\t%s\t-> %s\t(id %s)\n", i, record.Domain, record.IP, record.RecordID())
+	}
+	tw.Flush()
+	fmt.Println()
+}
+
+// PrintRecordChange prints the record affected by an edit. In a dry run,
+// nothing was written.
+func PrintRecordChange(change *config.RecordChange, dryRun bool) {
+	before := change.Before
+	if change.After == nil {
+		if dryRun {
+			fmt.Printf("Would remove from '%s':\n", change.Set)
+		} else {
+			fmt.Printf("✓ Record removed from '%s':\n", change.Set)
+		}
+		fmt.Printf("  [%d] %s -> %s  (id %s)\n", change.Index, before.Domain, before.IP, before.RecordID())
+		return
+	}
+
+	after := change.After
+	if dryRun {
+		fmt.Printf("Would update in '%s':\n", change.Set)
+	} else {
+		fmt.Printf("✓ Record updated in '%s':\n", change.Set)
+	}
+	fmt.Printf("  - [%d] %s -> %s  (id %s)\n", change.Index, before.Domain, before.IP, before.RecordID())
+	fmt.Printf("  + [%d] %s -> %s  (id %s)\n", change.Index, after.Domain, after.IP, after.RecordID())
+}
+
+// PrintResolve prints the rule answering for a domain
+func PrintResolve(view resolveView) {
+	fmt.Printf("%s -> %s\n", view.Domain, view.IP)
+	rule := view.Rule
+	if rule.Set != "" {
+		fmt.Printf("  rule [%d] %s (id %s, from %s)\n", rule.Index, rule.Domain, rule.ID, rule.Set)
+		return
+	}
+	fmt.Printf("  rule [%d] %s (id %s)\n", rule.Index, rule.Domain, rule.ID)
+}
+
+// PrintDoctor prints the system changes left behind by a crashed daemon
+func PrintDoctor(result doctorView) {
+	if result.RunningPID != 0 {
+		fmt.Printf("reghostd is running (pid %d), its system changes are in use\n", result.RunningPID)
+		return
+	}
+	if len(result.Leftovers) == 0 {
+		fmt.Println("✓ No leftover system changes found")
+		return
+	}
+
+	for _, leftover := range result.Leftovers {
+		if result.Fixed {
+			fmt.Printf("✓ Undid %s\n", leftover)
+		} else {
+			fmt.Printf("✗ Leftover %s\n", leftover)
+		}
+	}
+	if !result.Fixed {
+		fmt.Println("\nRun 'reghostctl doctor --fix' to undo them")
+	}
+}
+
+// PrintImport prints the result of an import and the entries it skipped. In
+// a dry run, nothing was written.
+func PrintImport(result importView, dryRun bool) {
+	action := "Added"
+	if result.Replaced {
+		action = "Replaced the records with"
+	}
+	if dryRun {
+		fmt.Printf("Would import %d records into '%s', %d new\n", result.Imported, result.Set, result.Added)
+	} else {
+		fmt.Printf("✓ %s %d records in '%s' (%d read)\n", action, result.Added, result.Set, result.Imported)
+	}
+
+	if len(result.Skipped) == 0 {
+		return
+	}
+	fmt.Printf("\nSkipped %d entries:\n", len(result.Skipped))
+	for _, issue := range result.Skipped {
+		if issue.Line > 0 {
+			fmt.Printf("  line %d: %s\n    %s\n", issue.Line, issue.Text, issue.Reason)
+		} else {
+			fmt.Printf("  %s\n    %s\n", issue.Text, issue.Reason)
+		}
+	}
+}
+
+// PrintStatus prints the daemon status in a human-readable format
+func PrintStatus(s *status.Status) {
+	fmt.Printf("\n=== reghostd Status ===\n\n")
+	if s.Stale(time.Now()) {
+		fmt.Printf("State:         stale (last update %s)\n", s.UpdatedAt.Format(time.RFC3339))
+	} else {
+		fmt.Printf("State:         running (pid %d)\n", s.PID)
+	}
+	fmt.Printf("Started:       %s\n", s.StartedAt.Format(time.RFC3339))
+	fmt.Printf("Listening on:  %s:53\n", s.BindIP)
+	fmt.Printf("Active Record: %s\n\n", s.ActiveRecord.String())
+
+	fmt.Println("Queries:")
+	fmt.Printf("  Total:        %d\n", s.Metrics.Queries)
+	fmt.Printf("  Refused:      %d\n", s.Metrics.Refused)
+	fmt.Printf("  Rate limited: %d\n", s.Metrics.RateLimited)
+	fmt.Printf("  RRL dropped:  %d\n", s.Metrics.RRLDropped)
+	fmt.Printf("  RRL slipped:  %d\n", s.Metrics.RRLSlipped)
+	fmt.Println()
+}
+
+// PrintProjects prints the registered projects and their status
+func PrintProjects(states []config.ProjectState) {
+	fmt.Printf("\n=== Registered Projects ===\n\n")
+	if len(states) == 0 {
+		fmt.Println("No projects registered")
+		return
+	}
+
+	for _, state := range states {
+		switch state.Status {
+		case config.ProjectActive:
+			fmt.Printf("  ✓ %s (%s, %d records)\n", state.Name, state.Status, state.Records)
+		case config.ProjectInvalid:
+			fmt.Printf("  ✗ %s (%s: %v)\n", state.Name, state.Status, state.Error)
+		default:
+			fmt.Printf("  ✗ %s (%s)\n", state.Name, state.Status)
+		}
+		fmt.Printf("    %s\n", state.File)
+	}
+	fmt.Println()
+}
+
+// PrintHistory prints the recorded versions of the config, newest first.
+// current is the revision the config files are at, or 0.
+func PrintHistory(entries []config.HistoryEntry, current int) {
+	fmt.Printf("\n=== Config History ===\n\n")
+	if len(entries) == 0 {
+		fmt.Println("No history recorded yet")
+		return
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		marker := " "
+		if entry.Revision == current {
+			marker = "*"
+		}
+
+		command := entry.Command
+		if command == "" {
+			command = "(changed outside reghostctl)"
+		}
+		user := entry.User
+		if user == "" {
+			user = "unknown"
+		}
+
+		fmt.Printf("%s %4d  %s  %-12s %s\n", marker, entry.Revision, entry.Time.Format("2006-01-02 15:04:05"), user, command)
 	}
 	fmt.Println()
 }
@@ -0,0 +1,370 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bilgehannal/reghost/internal/utils"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+// HistoryLimit is the number of config versions kept in the history
+const HistoryLimit = 50
+
+// HistoryDir returns the directory holding the history of a config file,
+// e.g. /etc/reghost.yml.history for /etc/reghost.yml
+func HistoryDir(path string) string {
+	return path + ".history"
+}
+
+// HistoryEntry is a version of the config files recorded in the history
+type HistoryEntry struct {
+	Revision int           `json:"revision"`
+	Time     time.Time     `json:"time"`
+	Command  string        `json:"command,omitempty"`
+	User     string        `json:"user,omitempty"`
+	Files    []HistoryFile `json:"files"`
+}
+
+// HistoryFile is the content of one config file in a history entry
+type HistoryFile struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// History returns the recorded versions of a config file, oldest first
+func History(path string) ([]HistoryEntry, error) {
+	names, err := historyFiles(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]HistoryEntry, 0, len(names))
+	for _, name := range names {
+		entry, err := readHistoryEntry(filepath.Join(HistoryDir(path), name))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, nil
+}
+
+// HistoryAt returns the version of a config file recorded as revision
+func HistoryAt(path string, revision int) (*HistoryEntry, error) {
+	entry, err := readHistoryEntry(filepath.Join(HistoryDir(path), historyFileName(revision)))
+	if os.IsNotExist(err) {
+		return nil, reghost.NotFound("revision %d is not in the history", revision)
+	}
+	return entry, err
+}
+
+// IsCurrent reports whether the config files are at the version of entry
+func (e *HistoryEntry) IsCurrent(path string) bool {
+	files, err := snapshot(path)
+	return err == nil && sameFiles(e.Files, files)
+}
+
+// Diff returns the differences between a recorded version of the config
+// files and their current content, as a unified diff. Rolling back to
+// revision reverts exactly these changes.
+func Diff(path string, revision int) (string, error) {
+	entry, err := HistoryAt(path, revision)
+	if err != nil {
+		return "", err
+	}
+	current, err := snapshot(path)
+	if err != nil {
+		return "", err
+	}
+
+	contents := make(map[string]string, len(current))
+	for _, file := range current {
+		contents[file.Path] = file.Content
+	}
+
+	var diff strings.Builder
+	seen := make(map[string]bool, len(entry.Files))
+	for _, file := range entry.Files {
+		seen[file.Path] = true
+		diff.WriteString(unifiedDiff(
+			fmt.Sprintf("%s (revision %d)", file.Path, revision),
+			fmt.Sprintf("%s (current)", file.Path),
+			file.Content, contents[file.Path]))
+	}
+	for _, file := range current {
+		if !seen[file.Path] {
+			diff.WriteString(unifiedDiff(
+				fmt.Sprintf("%s (revision %d)", file.Path, revision),
+				fmt.Sprintf("%s (current)", file.Path),
+				"", file.Content))
+		}
+	}
+	return diff.String(), nil
+}
+
+// historyFiles returns the names of the history entries, oldest first
+func historyFiles(path string) ([]string, error) {
+	dirEntries, err := os.ReadDir(HistoryDir(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	var names []string
+	for _, dirEntry := range dirEntries {
+		if historyRevision(dirEntry.Name()) > 0 {
+			names = append(names, dirEntry.Name())
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return historyRevision(names[i]) < historyRevision(names[j])
+	})
+	return names, nil
+}
+
+// historyFileName returns the name of the file holding a revision
+func historyFileName(revision int) string {
+	return fmt.Sprintf("%06d.json", revision)
+}
+
+// historyRevision returns the revision held by a history file, or 0
+func historyRevision(name string) int {
+	base, ok := strings.CutSuffix(name, ".json")
+	if !ok {
+		return 0
+	}
+	revision, err := strconv.Atoi(base)
+	if err != nil || revision <= 0 {
+		return 0
+	}
+	return revision
+}
+
+// readHistoryEntry reads a history file
+func readHistoryEntry(file string) (*HistoryEntry, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry HistoryEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	return &entry, nil
+}
+
+// recordHistory appends the current content of the config files to the
+// history, unless it is the latest recorded version, and drops the versions
+// beyond HistoryLimit. The caller holds the lock.
+func recordHistory(path, command string) error {
+	files, err := snapshot(path)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+
+	names, err := historyFiles(path)
+	if err != nil {
+		return err
+	}
+
+	revision := 1
+	if len(names) > 0 {
+		latest, err := readHistoryEntry(filepath.Join(HistoryDir(path), names[len(names)-1]))
+		if err != nil {
+			return err
+		}
+		if sameFiles(latest.Files, files) {
+			return nil
+		}
+		revision = latest.Revision + 1
+	}
+
+	entry := HistoryEntry{
+		Revision: revision,
+		Time:     time.Now(),
+		Command:  command,
+		User:     currentUser(),
+		Files:    files,
+	}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// The config may hold TSIG secrets, so only its owner may read the history
+	dir := HistoryDir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create history directory: %w", err)
+	}
+	if err := utils.WriteFileAtomic(filepath.Join(dir, historyFileName(revision)), data, 0644); err != nil {
+		return err
+	}
+
+	names = append(names, historyFileName(revision))
+	for len(names) > HistoryLimit {
+		os.Remove(filepath.Join(dir, names[0]))
+		names = names[1:]
+	}
+	return nil
+}
+
+// snapshot returns the current content of the config file and the fragment
+// files it loads, in load order. It returns nothing if the config file does
+// not exist yet.
+func snapshot(path string) ([]HistoryFile, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	files := []HistoryFile{{Path: absPath(path), Content: string(data)}}
+
+	fragments, err := Fragments(path, includeList(data))
+	if err != nil {
+		return nil, err
+	}
+	for _, fragment := range fragments {
+		data, err := os.ReadFile(fragment)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", fragment, err)
+		}
+		files = append(files, HistoryFile{Path: absPath(fragment), Content: string(data)})
+	}
+	return files, nil
+}
+
+// sameFiles reports whether two snapshots hold the same files and contents
+func sameFiles(a, b []HistoryFile) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// checkHistoryFiles checks that a history entry only holds the config file
+// and fragment files matched by the include patterns of its config file.
+// The history directory may be writable by others than the config owner,
+// and a rollback must not write anywhere else.
+func checkHistoryFiles(path string, files []HistoryFile) error {
+	main := absPath(path)
+	var include []string
+	for _, file := range files {
+		if file.Path == main {
+			include = includeList([]byte(file.Content))
+		}
+	}
+	patterns := IncludePatterns(main, include)
+
+	for _, file := range files {
+		if file.Path == main {
+			continue
+		}
+		if !matchesAny(patterns, file.Path) {
+			return fmt.Errorf("history file %s is not part of the config", file.Path)
+		}
+	}
+	return nil
+}
+
+// matchesAny reports whether a path matches one of the glob patterns
+func matchesAny(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		if ok, err := filepath.Match(pattern, path); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// restoreFiles writes the files of a snapshot back, skipping those that did
+// not change, and removes the fragment files the snapshot does not hold. The
+// caller holds the lock.
+func restoreFiles(path string, files []HistoryFile) error {
+	before, err := snapshot(path)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if data, err := os.ReadFile(file.Path); err == nil && string(data) == file.Content {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(file.Path), 0755); err != nil {
+			return fmt.Errorf("failed to create directory of %s: %w", file.Path, err)
+		}
+		if err := utils.WriteFileAtomic(file.Path, []byte(file.Content), 0644); err != nil {
+			return err
+		}
+	}
+
+	// Fragments created since the snapshot, and those the restored include
+	// patterns pick up, would change what the config loads
+	after, err := snapshot(path)
+	if err != nil {
+		return err
+	}
+	keep := make(map[string]bool, len(files))
+	for _, file := range files {
+		keep[absPath(file.Path)] = true
+	}
+	for _, file := range append(before, after...) {
+		if keep[file.Path] {
+			continue
+		}
+		if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", file.Path, err)
+		}
+		keep[file.Path] = true
+	}
+	return nil
+}
+
+// absPath returns the absolute form of a path, so that history entries do not
+// depend on the working directory
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// commandLine returns the command line of the running process
+func commandLine() string {
+	if len(os.Args) == 0 {
+		return ""
+	}
+	args := append([]string{filepath.Base(os.Args[0])}, os.Args[1:]...)
+	return strings.Join(args, " ")
+}
+
+// currentUser returns the user running the process, or the user who ran it
+// through sudo. The real uid is used, so that running reghostctl setuid is
+// attributed to the caller; SUDO_USER is only trusted when root runs it.
+func currentUser() string {
+	uid := os.Getuid()
+	if name := os.Getenv("SUDO_USER"); name != "" && uid == 0 {
+		return name
+	}
+	if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		return u.Username
+	}
+	return strconv.Itoa(uid)
+}
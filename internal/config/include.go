@@ -0,0 +1,244 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/bilgehannal/reghost/pkg/reghost"
+	"gopkg.in/yaml.v3"
+)
+
+// FragmentDir returns the directory of configuration fragments read next to
+// the config file, e.g. /etc/reghost.d for /etc/reghost.yml
+func FragmentDir(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".d"
+}
+
+// IncludePatterns returns the glob patterns of the fragment files: every
+// YAML file in the fragment directory, followed by the include list.
+// Relative include patterns are resolved against the config file directory.
+func IncludePatterns(path string, include []string) []string {
+	dir := FragmentDir(path)
+	patterns := []string{filepath.Join(dir, "*.yml"), filepath.Join(dir, "*.yaml")}
+	for _, pattern := range include {
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+// Fragments returns the fragment files of a config file in load order
+func Fragments(path string, include []string) ([]string, error) {
+	return fragments(disk, path, include)
+}
+
+// fragments returns the fragment files of a config file in src
+func fragments(src source, path string, include []string) ([]string, error) {
+	var files []string
+	seen := map[string]bool{filepath.Clean(path): true}
+	for _, pattern := range IncludePatterns(path, include) {
+		// Glob returns the matches sorted
+		matches, err := src.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern '%s': %w", pattern, err)
+		}
+		for _, match := range matches {
+			match = filepath.Clean(match)
+			if seen[match] {
+				continue
+			}
+			seen[match] = true
+			files = append(files, match)
+		}
+	}
+	return files, nil
+}
+
+// loadFragments merges the record sets of every fragment file into the
+// config. A record set may only be defined in one file.
+func loadFragments(src source, path string, config *reghost.Config) error {
+	files, err := fragments(src, path, config.Include)
+	if err != nil {
+		return err
+	}
+
+	config.Sources = make(map[string]string, len(config.Records))
+	for name := range config.Records {
+		config.Sources[name] = path
+	}
+
+	for _, file := range files {
+		fragment, err := loadFragment(src, file)
+		if err != nil {
+			return err
+		}
+
+		for name, records := range fragment.Records {
+			if owner, exists := config.Sources[name]; exists {
+				return fmt.Errorf("%w: record set '%s' is defined in both %s and %s", ErrInvalidConfig, name, owner, file)
+			}
+			if config.Records == nil {
+				config.Records = make(map[string][]reghost.Record)
+			}
+			config.Records[name] = records
+			config.Sources[name] = file
+
+			if parents := fragment.Extends[name]; len(parents) > 0 {
+				if config.Extends == nil {
+					config.Extends = make(map[string][]string)
+				}
+				config.Extends[name] = parents
+			}
+		}
+	}
+
+	return nil
+}
+
+// loadFragment reads a fragment file. Fragments may only define record sets.
+func loadFragment(src source, file string) (*reghost.Config, error) {
+	data, err := src.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file, err)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse %s: %w", ErrInvalidConfig, file, err)
+	}
+	if len(doc.Content) == 0 {
+		return &reghost.Config{}, nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%w: failed to parse %s: expected a mapping", ErrInvalidConfig, file)
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if key := root.Content[i].Value; key != "records" {
+			return nil, fmt.Errorf("%w: %s: only records can be defined in included files, found '%s'", ErrInvalidConfig, file, key)
+		}
+	}
+
+	var fragment reghost.Config
+	if err := root.Decode(&fragment); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse %s: %w", ErrInvalidConfig, file, err)
+	}
+	return &fragment, nil
+}
+
+// fragmentFile is the content of a fragment file: the record sets of a
+// config, in the same forms as in the main file
+type fragmentFile struct {
+	config reghost.Config
+}
+
+// MarshalYAML renders only the records of the config
+func (f *fragmentFile) MarshalYAML() (interface{}, error) {
+	var node yaml.Node
+	if err := node.Encode(&f.config); err != nil {
+		return nil, err
+	}
+
+	records := mappingChild(&node, "records")
+	if records == nil {
+		records = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	}
+	return &yaml.Node{
+		Kind: yaml.MappingNode,
+		Tag:  "!!map",
+		Content: []*yaml.Node{
+			{Kind: yaml.ScalarNode, Tag: "!!str", Value: "records"},
+			records,
+		},
+	}, nil
+}
+
+// UnmarshalYAML reads the record sets of a fragment
+func (f *fragmentFile) UnmarshalYAML(value *yaml.Node) error {
+	return value.Decode(&f.config)
+}
+
+// encodeFragments renders the record sets owned by fragment files as the
+// new contents of these files and returns them, together with the config
+// holding what remains for the main file. Fragments whose record sets did
+// not change are left out.
+func encodeFragments(path string, config *reghost.Config) (*reghost.Config, []fileContent, error) {
+	files, err := Fragments(path, config.Include)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	owned := make(map[string]*reghost.Config, len(files))
+	for _, file := range files {
+		owned[file] = &reghost.Config{Records: map[string][]reghost.Record{}}
+	}
+
+	main := *config
+	main.Records = make(map[string][]reghost.Record)
+	main.Extends = nil
+	for name, records := range config.Records {
+		// Project record sets belong to their repositories
+		if project := projectForFile(config, config.Sources[name]); project != nil {
+			if err := checkProjectUnchanged(project, records); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+
+		target := &main
+		if fragment, ok := owned[config.Sources[name]]; ok {
+			target = fragment
+		}
+
+		target.Records[name] = records
+		if parents := config.Extends[name]; len(parents) > 0 {
+			if target.Extends == nil {
+				target.Extends = make(map[string][]string)
+			}
+			target.Extends[name] = parents
+		}
+	}
+
+	var changed []fileContent
+	for _, file := range files {
+		fragment := owned[file]
+		if current, err := loadFragment(disk, file); err == nil && sameRecordSets(current, fragment) {
+			continue
+		}
+
+		data, err := encodeYAML(file, &fragmentFile{config: *fragment})
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal %s: %w", file, err)
+		}
+		changed = append(changed, fileContent{path: file, data: data})
+	}
+
+	return &main, changed, nil
+}
+
+// sameRecordSets reports whether two fragments define the same record sets
+func sameRecordSets(a, b *reghost.Config) bool {
+	if len(a.Records) != len(b.Records) || len(a.Extends) != len(b.Extends) {
+		return false
+	}
+	for name, records := range a.Records {
+		other, ok := b.Records[name]
+		if !ok || len(records) != len(other) {
+			return false
+		}
+		for i := range records {
+			if !reghost.SameRecord(records[i], other[i]) {
+				return false
+			}
+		}
+	}
+	if len(a.Extends) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a.Extends, b.Extends)
+}
@@ -41,8 +41,71 @@ func Load(path string) (*reghost.Config, error) {
 		return defaultConfig(), nil
 	}
 
+	return load(disk, path)
+}
+
+// LoadWithRevision loads the config like Load, together with the revision
+// of the file contents it parsed, for a later WriteAt
+func LoadWithRevision(path string) (*reghost.Config, string, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := createDefaultConfig(path); err != nil {
+			return nil, "", fmt.Errorf("failed to create default config: %w", err)
+		}
+	}
+
+	return loadWithRevision(load, path)
+}
+
+// loadUncheckedWithRevision loads the config like LoadUnchecked, together
+// with the revision of the file contents it parsed
+func loadUncheckedWithRevision(path string) (*reghost.Config, string, error) {
+	return loadWithRevision(loadUnchecked, path)
+}
+
+// loadWithRevision loads the config from disk with loadConfig. The revision
+// is computed from the very contents loadConfig parsed, so an edit saved
+// while loading shows up as a change.
+func loadWithRevision(loadConfig func(source, string) (*reghost.Config, error), path string) (*reghost.Config, string, error) {
+	src := newRecordingSource(disk)
+	config, err := loadConfig(src, path)
+	if err != nil {
+		return nil, "", err
+	}
+
+	revision, err := revisionOf(src, path)
+	if err != nil {
+		return nil, "", err
+	}
+	return config, revision, nil
+}
+
+// LoadUnchecked reads the configuration like Load, but does not validate it,
+// so a config that fails validation can still be inspected and repaired
+func LoadUnchecked(path string) (*reghost.Config, error) {
+	return loadUnchecked(disk, path)
+}
+
+// load reads, parses and validates the configuration file and the files it
+// refers to from src
+func load(src source, path string) (*reghost.Config, error) {
+	config, err := loadUnchecked(src, path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate config
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	return config, nil
+}
+
+// loadUnchecked reads and parses the configuration file and the files it
+// refers to from src
+func loadUnchecked(src source, path string) (*reghost.Config, error) {
 	// Read config file
-	data, err := os.ReadFile(path)
+	data, err := src.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
@@ -50,12 +113,17 @@ func Load(path string) (*reghost.Config, error) {
 	// Parse YAML
 	var config reghost.Config
 	if err := yaml.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config: %w", err)
+		return nil, fmt.Errorf("%w: failed to parse config: %w", ErrInvalidConfig, err)
 	}
 
-	// Validate config
-	if err := config.Validate(); err != nil {
-		return nil, fmt.Errorf("invalid config: %w", err)
+	// Merge record sets from the fragment directory and included files
+	if err := loadFragments(src, path, &config); err != nil {
+		return nil, err
+	}
+
+	// Merge record sets of registered projects
+	if err := loadProjects(&config); err != nil {
+		return nil, err
 	}
 
 	return &config, nil
@@ -98,7 +166,7 @@ func LogConfigInfo(cfg *reghost.Config, logger *utils.Logger) {
 	logger.Info("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 	logger.Info("📋 Configuration Summary")
 	logger.Info("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
-	logger.Info("🔹 Active Record: %s", cfg.ActiveRecord)
+	logger.Info("🔹 Active Record: %s", cfg.Active().String())
 	logger.Info("")
 
 	// Get active records
@@ -116,6 +184,9 @@ func LogConfigInfo(cfg *reghost.Config, logger *utils.Logger) {
 		logger.Info("  Rule #%d:", i+1)
 		logger.Info("    Domain: %s", record.Domain)
 		logger.Info("    IP:     %s", record.IP)
+		if len(cfg.Active()) > 1 {
+			logger.Info("    Set:    %s", record.Set)
+		}
 		if i < len(activeRecords)-1 {
 			logger.Info("")
 		}
@@ -123,13 +194,39 @@ func LogConfigInfo(cfg *reghost.Config, logger *utils.Logger) {
 
 	logger.Info("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
 
+	// Log authoritative zones
+	if len(cfg.Zones) > 0 {
+		logger.Info("🌐 Authoritative Zones: %d", len(cfg.Zones))
+		for _, zone := range cfg.Zones {
+			logger.Info("  • %s (ns: %v)", zone.Origin(), zone.NS)
+		}
+		logger.Info("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	}
+
+	// Log registered projects
+	if len(cfg.Projects) > 0 {
+		logger.Info("📁 Registered Projects: %d", len(cfg.Projects))
+		for _, state := range ProjectStates(cfg) {
+			if state.Error != nil {
+				logger.Warn("  • %s: %s (%v)", state.Name, state.Status, state.Error)
+			} else {
+				logger.Info("  • %s: %s (%s)", state.Name, state.Status, state.File)
+			}
+		}
+		logger.Info("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
+	}
+
 	// Log all available record sets
 	logger.Info("📦 Available Record Sets: %d", len(cfg.Records))
 	for name := range cfg.Records {
-		if name == cfg.ActiveRecord {
-			logger.Info("  • %s (active)", name)
+		source := ""
+		if file, ok := cfg.Sources[name]; ok {
+			source = " [" + filepath.Base(file) + "]"
+		}
+		if cfg.Active().Contains(name) {
+			logger.Info("  • %s (active)%s", name, source)
 		} else {
-			logger.Info("  • %s", name)
+			logger.Info("  • %s%s", name, source)
 		}
 	}
 	logger.Info("━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━━")
@@ -0,0 +1,122 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LockTimeout is how long a write waits for another writer to finish
+const LockTimeout = 10 * time.Second
+
+// lockRetryInterval is the delay between attempts to take the lock
+const lockRetryInterval = 50 * time.Millisecond
+
+// ErrConflict is returned when the config changed on disk since it was read
+var ErrConflict = errors.New("config was modified by another process")
+
+// ErrLocked is returned when another writer holds the lock for too long
+var ErrLocked = errors.New("config is locked by another process")
+
+// errLockBusy is returned by tryLock while another process holds the lock
+var errLockBusy = errors.New("lock is held")
+
+// ErrInvalidConfig is wrapped by errors about configs that do not parse or
+// validate
+var ErrInvalidConfig = errors.New("invalid config")
+
+// LockPath returns the path of the lock file guarding writes to a config file
+func LockPath(path string) string {
+	return path + ".lock"
+}
+
+// fileLock is an exclusive advisory lock held on a lock file
+type fileLock struct {
+	file *os.File
+}
+
+// lockConfig takes the exclusive write lock of a config file, waiting up to
+// LockTimeout for the current holder to release it
+func lockConfig(path string) (*fileLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	file, err := os.OpenFile(LockPath(path), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(LockTimeout)
+	for {
+		err := tryLock(file)
+		if err == nil {
+			return &fileLock{file: file}, nil
+		}
+		if !errors.Is(err, errLockBusy) || time.Now().After(deadline) {
+			file.Close()
+			if errors.Is(err, errLockBusy) {
+				return nil, fmt.Errorf("%w: timed out waiting for %s", ErrLocked, LockPath(path))
+			}
+			return nil, fmt.Errorf("failed to lock config: %w", err)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// unlock releases the lock. The lock file is left in place so that every
+// writer locks the same inode.
+func (l *fileLock) unlock() {
+	unlockFile(l.file)
+	l.file.Close()
+}
+
+// revision returns a digest of the config file and the fragment files it
+// loads. It changes whenever any of them is edited, added or removed.
+func revision(path string) (string, error) {
+	return revisionOf(disk, path)
+}
+
+// revisionOf returns the revision of the config files in src
+func revisionOf(src source, path string) (string, error) {
+	hash := sha256.New()
+
+	data, err := src.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read config file: %w", err)
+	}
+	hash.Write([]byte(path + "\x00"))
+	hash.Write(data)
+
+	files, err := fragments(src, path, includeList(data))
+	if err != nil {
+		return "", err
+	}
+	for _, file := range files {
+		data, err := src.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		hash.Write([]byte("\x00" + file + "\x00"))
+		hash.Write(data)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// includeList returns the include list of a config file. Only this list is
+// needed to find the fragments, so a config that does not parse otherwise
+// still has them.
+func includeList(data []byte) []string {
+	var main struct {
+		Include []string `yaml:"include"`
+	}
+	yaml.Unmarshal(data, &main)
+	return main.Include
+}
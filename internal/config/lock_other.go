@@ -0,0 +1,14 @@
+//go:build !unix
+
+package config
+
+import "os"
+
+// tryLock does nothing: advisory locks are only taken on unix systems, where
+// the daemon and the CLI share the config
+func tryLock(file *os.File) error {
+	return nil
+}
+
+// unlockFile does nothing, like tryLock
+func unlockFile(file *os.File) {}
@@ -0,0 +1,479 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultIndent is used when the indentation of a file cannot be detected
+const defaultIndent = 2
+
+// encodeYAML renders value as the new content of the YAML file at path.
+// When the file exists, its node tree is edited in place so that only the
+// nodes whose values changed are touched: comments, key order, quoting and
+// anchors of everything else survive. value must be a pointer.
+func encodeYAML(path string, value interface{}) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return yaml.Marshal(value)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		// Nothing to keep in an empty file
+		return yaml.Marshal(value)
+	}
+
+	out, err := editYAML(data, &doc, value)
+	if !errors.Is(err, errMeaningChanged) {
+		return out, err
+	}
+
+	// An edit through an anchor also changed the nodes aliasing it. Expand
+	// the aliases and edit the copies, which keeps the comments.
+	doc = yaml.Node{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	expandAliases(&doc)
+	out, err = editYAML(data, &doc, value)
+	if err != nil {
+		return nil, fmt.Errorf("cannot edit %s in place: %w", path, err)
+	}
+	return out, nil
+}
+
+// errMeaningChanged is returned by editYAML when the edited document does
+// not decode to the value it was edited to hold
+var errMeaningChanged = errors.New("edited document does not match the config")
+
+// editYAML edits doc, parsed from data, to hold value and renders it
+func editYAML(data []byte, doc *yaml.Node, value interface{}) ([]byte, error) {
+	var target yaml.Node
+	if err := target.Encode(value); err != nil {
+		return nil, err
+	}
+
+	// The base is what the file currently means. Keys that are in the file
+	// but not in the base are unknown to the config and are kept as they are.
+	current := reflect.New(reflect.TypeOf(value).Elem()).Interface()
+	if err := doc.Decode(current); err != nil {
+		return nil, err
+	}
+	var base yaml.Node
+	if err := base.Encode(current); err != nil {
+		return nil, err
+	}
+
+	blank := make(map[string]bool)
+	blankKeys(doc.Content[0], strings.Split(string(data), "\n"), "", blank)
+
+	doc.Content[0] = syncNode(doc.Content[0], &base, &target)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(detectIndent(data))
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	if !sameMeaning(buf.Bytes(), value) {
+		return nil, errMeaningChanged
+	}
+	return restoreBlankLines(buf.Bytes(), blank), nil
+}
+
+// expandAliases replaces every alias in the tree by a copy of the node it
+// refers to, and drops the anchors
+func expandAliases(node *yaml.Node) {
+	for i, child := range node.Content {
+		if child.Kind == yaml.AliasNode && child.Alias != nil {
+			// The comment on the alias line moves above a copied collection
+			copied := copyNode(child.Alias)
+			copied.HeadComment = child.HeadComment
+			copied.FootComment = child.FootComment
+			if copied.Kind == yaml.ScalarNode {
+				copied.LineComment = child.LineComment
+			} else if child.LineComment != "" {
+				copied.HeadComment = strings.TrimPrefix(copied.HeadComment+"\n"+child.LineComment, "\n")
+			}
+			node.Content[i] = copied
+		}
+		expandAliases(node.Content[i])
+	}
+	node.Anchor = ""
+}
+
+// copyNode returns a deep copy of a node
+func copyNode(node *yaml.Node) *yaml.Node {
+	copied := *node
+	copied.Content = make([]*yaml.Node, len(node.Content))
+	for i, child := range node.Content {
+		copied.Content[i] = copyNode(child)
+	}
+	return &copied
+}
+
+// blankKeys collects the paths of mapping keys that are preceded by a blank
+// line, which the YAML encoder does not preserve
+func blankKeys(node *yaml.Node, lines []string, prefix string, out map[string]bool) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key := node.Content[i]
+		path := prefix + "/" + key.Value
+
+		start := keyStart(key)
+		if start >= 2 && start-2 < len(lines) && strings.TrimSpace(lines[start-2]) == "" {
+			out[path] = true
+		}
+		blankKeys(node.Content[i+1], lines, path, out)
+	}
+}
+
+// restoreBlankLines inserts a blank line before the keys found by blankKeys
+func restoreBlankLines(data []byte, blank map[string]bool) []byte {
+	if len(blank) == 0 {
+		return data
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil || len(doc.Content) == 0 {
+		return data
+	}
+
+	var starts []int
+	var walk func(node *yaml.Node, prefix string)
+	walk = func(node *yaml.Node, prefix string) {
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			path := prefix + "/" + node.Content[i].Value
+			if blank[path] {
+				starts = append(starts, keyStart(node.Content[i]))
+			}
+			walk(node.Content[i+1], path)
+		}
+	}
+	walk(doc.Content[0], "")
+
+	lines := strings.Split(string(data), "\n")
+	sort.Sort(sort.Reverse(sort.IntSlice(starts)))
+	for _, start := range starts {
+		at := start - 1
+		if at <= 0 || at >= len(lines) || strings.TrimSpace(lines[at-1]) == "" {
+			continue
+		}
+		lines = append(lines[:at], append([]string{""}, lines[at:]...)...)
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// keyStart returns the first line of a mapping key including its head comment
+func keyStart(key *yaml.Node) int {
+	if key.HeadComment == "" {
+		return key.Line
+	}
+	return key.Line - strings.Count(key.HeadComment, "\n") - 1
+}
+
+// sameMeaning reports whether data decodes to value
+func sameMeaning(data []byte, value interface{}) bool {
+	decoded := reflect.New(reflect.TypeOf(value).Elem()).Interface()
+	if err := yaml.Unmarshal(data, decoded); err != nil {
+		return false
+	}
+
+	want, err := yaml.Marshal(value)
+	if err != nil {
+		return false
+	}
+	got, err := yaml.Marshal(decoded)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(want, got)
+}
+
+// syncNode makes dst hold the value of src, reusing dst where possible, and
+// returns the resulting node. base is the plain encoding of dst's value, or
+// nil when unknown.
+func syncNode(dst, base, src *yaml.Node) *yaml.Node {
+	if nodeEqual(dst, src) {
+		return dst
+	}
+	if dst.Kind == yaml.AliasNode || dst.Kind != src.Kind {
+		return replaceNode(dst, src)
+	}
+
+	switch src.Kind {
+	case yaml.ScalarNode:
+		dst.Value = src.Value
+		dst.Tag = src.Tag
+		if (dst.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0) != strings.Contains(src.Value, "\n") {
+			dst.Style = src.Style
+		}
+	case yaml.MappingNode:
+		syncMapping(dst, base, src)
+	case yaml.SequenceNode:
+		syncSequence(dst, base, src)
+	default:
+		return replaceNode(dst, src)
+	}
+	return dst
+}
+
+// replaceNode returns src carrying the comments of dst. A scalar replaced by
+// a list of scalars stays on one line in flow style.
+func replaceNode(dst, src *yaml.Node) *yaml.Node {
+	if dst.Kind == yaml.ScalarNode && src.Kind == yaml.SequenceNode {
+		flow := true
+		for _, item := range src.Content {
+			flow = flow && item.Kind == yaml.ScalarNode
+		}
+		if flow {
+			src.Style = yaml.FlowStyle
+		}
+	}
+
+	if src.HeadComment == "" {
+		src.HeadComment = dst.HeadComment
+	}
+	if src.LineComment == "" {
+		src.LineComment = dst.LineComment
+	}
+	if src.FootComment == "" {
+		src.FootComment = dst.FootComment
+	}
+	return src
+}
+
+// syncMapping updates the values of existing keys in place and appends new
+// keys. A key removed by the edit whose value moved to a new key is renamed
+// in place, keeping its comments and position. Other keys removed by the
+// edit are dropped; keys unknown to the config are kept.
+func syncMapping(dst, base, src *yaml.Node) {
+	present := make(map[string]bool)
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		present[src.Content[i].Value] = true
+	}
+
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key := src.Content[i].Value
+		if mappingIndex(dst, key) >= 0 {
+			continue
+		}
+		for j := 0; j+1 < len(dst.Content); j += 2 {
+			old := dst.Content[j].Value
+			if removed := mappingChild(base, old); !present[old] && removed != nil && nodeEqual(removed, src.Content[i+1]) {
+				dst.Content[j].Value = key
+				break
+			}
+		}
+	}
+
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key := src.Content[i].Value
+
+		if j := mappingIndex(dst, key); j >= 0 {
+			dst.Content[j+1] = syncNode(dst.Content[j+1], mappingChild(base, key), src.Content[i+1])
+			continue
+		}
+		dst.Content = append(dst.Content, src.Content[i], src.Content[i+1])
+	}
+
+	kept := make([]*yaml.Node, 0, len(dst.Content))
+	for i := 0; i+1 < len(dst.Content); i += 2 {
+		key := dst.Content[i].Value
+		if !present[key] && mappingIndex(base, key) >= 0 {
+			continue
+		}
+		kept = append(kept, dst.Content[i], dst.Content[i+1])
+	}
+	dst.Content = kept
+}
+
+// syncSequence keeps the items of dst that are also in src, moving them if
+// needed, and edits or replaces the others
+func syncSequence(dst, base, src *yaml.Node) {
+	n, m := len(dst.Content), len(src.Content)
+
+	// Longest common subsequence of equal items
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if nodeEqual(dst.Content[i], src.Content[j]) {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	matched := make([]int, m)
+	used := make([]bool, n)
+	for j := range matched {
+		matched[j] = -1
+	}
+	for i, j := 0, 0; i < n && j < m; {
+		switch {
+		case nodeEqual(dst.Content[i], src.Content[j]):
+			matched[j] = i
+			used[i] = true
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+
+	// Items that moved keep their node
+	for j := range matched {
+		if matched[j] >= 0 {
+			continue
+		}
+		for i := range dst.Content {
+			if !used[i] && nodeEqual(dst.Content[i], src.Content[j]) {
+				matched[j] = i
+				used[i] = true
+				break
+			}
+		}
+	}
+
+	var baseItems []*yaml.Node
+	if base != nil && base.Kind == yaml.SequenceNode && len(base.Content) == n {
+		baseItems = base.Content
+	}
+
+	// Remaining items are edits of the next unused item, or new
+	items := make([]*yaml.Node, 0, m)
+	next := 0
+	for j, item := range src.Content {
+		if matched[j] >= 0 {
+			items = append(items, dst.Content[matched[j]])
+			if matched[j] >= next {
+				next = matched[j] + 1
+			}
+			continue
+		}
+
+		for next < n && used[next] {
+			next++
+		}
+		if next < n {
+			var baseItem *yaml.Node
+			if baseItems != nil {
+				baseItem = baseItems[next]
+			}
+			used[next] = true
+			items = append(items, syncNode(dst.Content[next], baseItem, item))
+			next++
+			continue
+		}
+		items = append(items, item)
+	}
+	dst.Content = items
+}
+
+// mappingIndex returns the index of key in a mapping node, or -1
+func mappingIndex(node *yaml.Node, key string) int {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return -1
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// mappingChild returns the value of key in a mapping node, or nil
+func mappingChild(node *yaml.Node, key string) *yaml.Node {
+	if i := mappingIndex(node, key); i >= 0 {
+		return node.Content[i+1]
+	}
+	return nil
+}
+
+// nodeEqual reports whether two nodes hold the same value, ignoring style,
+// comments and key order, and resolving aliases
+func nodeEqual(a, b *yaml.Node) bool {
+	for a.Kind == yaml.AliasNode && a.Alias != nil {
+		a = a.Alias
+	}
+	for b.Kind == yaml.AliasNode && b.Alias != nil {
+		b = b.Alias
+	}
+	if a.Kind != b.Kind {
+		return false
+	}
+
+	switch a.Kind {
+	case yaml.ScalarNode:
+		return a.ShortTag() == b.ShortTag() && a.Value == b.Value
+	case yaml.MappingNode:
+		if len(a.Content) != len(b.Content) {
+			return false
+		}
+		for i := 0; i+1 < len(a.Content); i += 2 {
+			other := mappingChild(b, a.Content[i].Value)
+			if other == nil || !nodeEqual(a.Content[i+1], other) {
+				return false
+			}
+		}
+		return true
+	default:
+		if len(a.Content) != len(b.Content) {
+			return false
+		}
+		for i := range a.Content {
+			if !nodeEqual(a.Content[i], b.Content[i]) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// detectIndent returns the indentation width used by a YAML document
+func detectIndent(data []byte) int {
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		indent := len(line) - len(trimmed)
+		if indent == 0 || trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if indent >= 2 && indent <= 8 {
+			return indent
+		}
+		break
+	}
+	return defaultIndent
+}
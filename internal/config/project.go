@@ -0,0 +1,158 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bilgehannal/reghost/pkg/reghost"
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectFile is the name of the project-level config file
+const ProjectFile = ".reghost.yml"
+
+// Project states reported by ProjectStates
+const (
+	ProjectActive  = "active"
+	ProjectMissing = "missing"
+	ProjectInvalid = "invalid"
+)
+
+// ProjectState describes a registered project and whether its file loads
+type ProjectState struct {
+	Name    string
+	Path    string
+	File    string
+	Status  string
+	Records int
+	Error   error
+}
+
+// projectConfig is the content of a project-level config file
+type projectConfig struct {
+	Records []reghost.Record `yaml:"records"`
+}
+
+// WatchPatterns returns the patterns of every file the config is read from
+// besides the config file itself: fragments, included files and project files
+func WatchPatterns(path string, cfg *reghost.Config) []string {
+	if cfg == nil {
+		return IncludePatterns(path, nil)
+	}
+
+	patterns := IncludePatterns(path, cfg.Include)
+	for _, project := range cfg.Projects {
+		patterns = append(patterns, ProjectFilePath(project))
+	}
+	return patterns
+}
+
+// ProjectFilePath returns the path of a project's config file
+func ProjectFilePath(project reghost.Project) string {
+	return filepath.Join(project.Path, ProjectFile)
+}
+
+// LoadProject reads and checks the records of a project
+func LoadProject(project reghost.Project) ([]reghost.Record, error) {
+	file := ProjectFilePath(project)
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var pc projectConfig
+	if err := yaml.Unmarshal(data, &pc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+
+	// Validate the records as a record set of their own
+	check := reghost.Config{
+		ActiveRecord: project.SetName(),
+		Records:      map[string][]reghost.Record{project.SetName(): pc.Records},
+	}
+	if err := check.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", file, err)
+	}
+
+	return pc.Records, nil
+}
+
+// ProjectStates loads every registered project and reports its state
+func ProjectStates(cfg *reghost.Config) []ProjectState {
+	states := make([]ProjectState, 0, len(cfg.Projects))
+	for _, project := range cfg.Projects {
+		state := ProjectState{
+			Name: project.Name,
+			Path: project.Path,
+			File: ProjectFilePath(project),
+		}
+
+		records, err := LoadProject(project)
+		switch {
+		case os.IsNotExist(err):
+			state.Status = ProjectMissing
+		case err != nil:
+			state.Status = ProjectInvalid
+			state.Error = err
+		default:
+			state.Status = ProjectActive
+			state.Records = len(records)
+		}
+		states = append(states, state)
+	}
+	return states
+}
+
+// loadProjects adds the record set of every registered project. Missing and
+// invalid projects get an empty placeholder set, so one broken repository
+// cannot take the daemon down; ProjectStates reports them.
+func loadProjects(config *reghost.Config) error {
+	for _, project := range config.Projects {
+		name := project.SetName()
+		if owner, exists := config.Sources[name]; exists {
+			return fmt.Errorf("%w: record set '%s' is defined in %s and by project '%s'", ErrInvalidConfig, name, owner, project.Name)
+		}
+
+		records, err := LoadProject(project)
+		if err != nil {
+			records = []reghost.Record{}
+		}
+
+		if config.Records == nil {
+			config.Records = make(map[string][]reghost.Record)
+		}
+		config.Records[name] = records
+		if config.Sources == nil {
+			config.Sources = make(map[string]string)
+		}
+		config.Sources[name] = ProjectFilePath(project)
+	}
+	return nil
+}
+
+// projectForFile returns the project whose config file is file, or nil
+func projectForFile(config *reghost.Config, file string) *reghost.Project {
+	for i := range config.Projects {
+		if ProjectFilePath(config.Projects[i]) == file {
+			return &config.Projects[i]
+		}
+	}
+	return nil
+}
+
+// checkProjectUnchanged fails when the records of a project were edited,
+// since they are only ever written by the project's own repository. A
+// project whose file does not load is compared as the empty placeholder.
+func checkProjectUnchanged(project *reghost.Project, records []reghost.Record) error {
+	current, _ := LoadProject(*project)
+
+	changed := len(current) != len(records)
+	for i := 0; !changed && i < len(current); i++ {
+		changed = !reghost.SameRecord(current[i], records[i])
+	}
+	if changed {
+		return fmt.Errorf("record set '%s' belongs to project '%s', edit %s instead", project.SetName(), project.Name, ProjectFilePath(*project))
+	}
+	return nil
+}
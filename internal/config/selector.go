@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+// RecordSelector picks one record of a record set: by ID when ID is set, by
+// domain when Domain is set, and by position otherwise. IDs and domains stay
+// valid when other records are added, removed or moved.
+type RecordSelector struct {
+	ID     string
+	Domain string
+	Index  int
+}
+
+// String describes the selector for messages
+func (s RecordSelector) String() string {
+	switch {
+	case s.ID != "":
+		return fmt.Sprintf("id '%s'", s.ID)
+	case s.Domain != "":
+		return fmt.Sprintf("domain '%s'", s.Domain)
+	default:
+		return fmt.Sprintf("index %d", s.Index)
+	}
+}
+
+// find returns the index of the selected record. Selecting no record, or more
+// than one, is an error.
+func (s RecordSelector) find(recordSetName string, records []reghost.Record) (int, error) {
+	if s.ID == "" && s.Domain == "" {
+		// Check if index is valid
+		if s.Index < 0 || s.Index >= len(records) {
+			return 0, reghost.NotFound("invalid index %d for record set '%s'", s.Index, recordSetName)
+		}
+		return s.Index, nil
+	}
+
+	var matches []int
+	for i, record := range records {
+		if s.ID != "" && record.RecordID() == s.ID {
+			matches = append(matches, i)
+		} else if s.ID == "" && reghost.SameDomain(record.Domain, s.Domain) {
+			matches = append(matches, i)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return 0, reghost.NotFound("no record with %s in record set '%s'", s, recordSetName)
+	case 1:
+		return matches[0], nil
+	default:
+		ids := make([]string, len(matches))
+		for i, index := range matches {
+			ids[i] = records[index].RecordID()
+		}
+		return 0, fmt.Errorf("%s matches %d records in record set '%s' (ids %s), select one by id",
+			s, len(matches), recordSetName, strings.Join(ids, ", "))
+	}
+}
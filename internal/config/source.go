@@ -0,0 +1,100 @@
+package config
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// source gives access to the files a config is loaded from
+type source interface {
+	ReadFile(name string) ([]byte, error)
+	Glob(pattern string) ([]string, error)
+}
+
+// diskSource reads files from the file system
+type diskSource struct{}
+
+// disk is the source of configs loaded from the file system
+var disk source = diskSource{}
+
+func (diskSource) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (diskSource) Glob(pattern string) ([]string, error) {
+	return filepath.Glob(pattern)
+}
+
+// snapshotSource reads files from a set of contents keyed by absolute path,
+// as if they were the only config files. It shows what a config would load
+// after a snapshot of the files was restored.
+type snapshotSource struct {
+	files map[string][]byte
+}
+
+func (s snapshotSource) ReadFile(name string) ([]byte, error) {
+	if data, ok := s.files[absPath(name)]; ok {
+		return data, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+func (s snapshotSource) Glob(pattern string) ([]string, error) {
+	// Check the pattern like filepath.Glob does
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	var matches []string
+	absPattern := absPath(pattern)
+	for name := range s.files {
+		if matched, _ := filepath.Match(absPattern, name); matched {
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// recordingSource reads through another source and keeps what it read, so
+// later reads of the same file or pattern see exactly the same content
+type recordingSource struct {
+	source source
+	files  map[string][]byte
+	globs  map[string][]string
+}
+
+// newRecordingSource creates a recording source reading from src
+func newRecordingSource(src source) *recordingSource {
+	return &recordingSource{
+		source: src,
+		files:  make(map[string][]byte),
+		globs:  make(map[string][]string),
+	}
+}
+
+func (s *recordingSource) ReadFile(name string) ([]byte, error) {
+	if data, ok := s.files[name]; ok {
+		return data, nil
+	}
+	data, err := s.source.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	s.files[name] = data
+	return data, nil
+}
+
+func (s *recordingSource) Glob(pattern string) ([]string, error) {
+	if matches, ok := s.globs[pattern]; ok {
+		return matches, nil
+	}
+	matches, err := s.source.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	s.globs[pattern] = matches
+	return matches, nil
+}
@@ -1,159 +1,659 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/bilgehannal/reghost/internal/utils"
 	"github.com/bilgehannal/reghost/pkg/reghost"
-	"gopkg.in/yaml.v3"
 )
 
-// Writer handles safe configuration file updates
+// Writer handles safe configuration file updates. Every version it writes
+// is recorded in the history next to the config file.
 type Writer struct {
 	configPath string
+	command    string
+	dryRun     bool
 }
 
-// NewWriter creates a new config writer
+// RecordChange describes the record affected by an edit
+type RecordChange struct {
+	Set    string
+	Index  int
+	Before reghost.Record
+	// After is the record after the edit, or nil when it was removed
+	After *reghost.Record
+}
+
+// NewWriter creates a new config writer. Its history entries are attributed
+// to the command line of the running process.
 func NewWriter(configPath string) *Writer {
 	return &Writer{
 		configPath: configPath,
+		command:    commandLine(),
 	}
 }
 
-// Write writes the configuration to disk safely
+// SetCommand sets the command recorded in the history for later writes
+func (w *Writer) SetCommand(command string) {
+	w.command = command
+}
+
+// SetDryRun makes later edits check and report their changes without
+// writing them
+func (w *Writer) SetDryRun(dryRun bool) {
+	w.dryRun = dryRun
+}
+
+// Path returns the path of the config file
+func (w *Writer) Path() string {
+	return w.configPath
+}
+
+// Write writes the configuration to disk safely. Record sets loaded from
+// fragment files are written back to the file that defines them. Existing
+// files keep their comments, key order, quoting and anchors; only the nodes
+// whose values changed are rewritten. The main file is written last, and a
+// failed write restores the fragments already written. Concurrent writers
+// are serialized by a lock file next to the config.
 func (w *Writer) Write(config *reghost.Config) error {
+	lock, err := lockConfig(w.configPath)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	return w.write(config)
+}
+
+// WriteAt writes the configuration like Write, but only if the files on disk
+// are still at revision, as returned by LoadWithRevision. Otherwise it fails
+// with ErrConflict and leaves the files untouched.
+func (w *Writer) WriteAt(config *reghost.Config, revision string) error {
+	lock, err := lockConfig(w.configPath)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	return w.writeAt(config, revision)
+}
+
+// update applies modify to the current config and writes the result. The
+// lock is held from load to write, so no other writer's edit is lost, and
+// the write fails with ErrConflict if the files were edited by hand in
+// between.
+func (w *Writer) update(modify func(*reghost.Config) error) error {
+	return w.updateWith(LoadWithRevision, modify)
+}
+
+// updateWith is update with the current config, and the revision it was
+// read at, loaded by loadConfig
+func (w *Writer) updateWith(loadConfig func(string) (*reghost.Config, string, error), modify func(*reghost.Config) error) error {
+	lock, err := lockConfig(w.configPath)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	// Load current config, along with the revision it was read at
+	config, readRevision, err := loadConfig(w.configPath)
+	if err != nil {
+		return err
+	}
+
+	if err := modify(config); err != nil {
+		return err
+	}
+
+	if w.dryRun {
+		if err := config.Validate(); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+		}
+		return nil
+	}
+
+	// Write back, unless the files changed since they were read
+	return w.writeAt(config, readRevision)
+}
+
+// writeAt writes the configuration if the files are still at readRevision;
+// the caller holds the lock
+func (w *Writer) writeAt(config *reghost.Config, readRevision string) error {
+	current, err := revision(w.configPath)
+	if err != nil {
+		return err
+	}
+	if current != readRevision {
+		return ErrConflict
+	}
+	return w.write(config)
+}
+
+// write writes the configuration; the caller holds the lock
+func (w *Writer) write(config *reghost.Config) error {
 	// Validate before writing
 	if err := config.Validate(); err != nil {
-		return fmt.Errorf("invalid config: %w", err)
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	// Keep edits made by hand since the last write, so they can be restored
+	if err := recordHistory(w.configPath, ""); err != nil {
+		return fmt.Errorf("failed to record history: %w", err)
 	}
 
-	// Marshal to YAML
-	data, err := yaml.Marshal(config)
+	main, files, err := encodeFragments(w.configPath, config)
+	if err != nil {
+		return err
+	}
+
+	// Marshal to YAML, editing the existing document in place
+	data, err := encodeYAML(w.configPath, main)
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	// Write to temporary file first
-	tempPath := w.configPath + ".tmp"
-	if err := os.WriteFile(tempPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write temp config: %w", err)
+	// The main file goes last, once every fragment it loads is written
+	if err := writeFiles(append(files, fileContent{path: w.configPath, data: data})); err != nil {
+		return err
 	}
 
-	// Atomic rename
-	if err := os.Rename(tempPath, w.configPath); err != nil {
-		os.Remove(tempPath) // Clean up temp file
-		return fmt.Errorf("failed to rename config file: %w", err)
+	if err := recordHistory(w.configPath, w.command); err != nil {
+		return fmt.Errorf("config written, but failed to record history: %w", err)
 	}
+	return nil
+}
 
+// fileContent is the new content of a config file
+type fileContent struct {
+	path string
+	data []byte
+}
+
+// writeFiles writes files in order. When a write fails, the files written
+// before it are restored, so the config is not left half changed.
+func writeFiles(files []fileContent) error {
+	var written []fileContent
+	var created []string
+	for _, file := range files {
+		previous, readErr := os.ReadFile(file.path)
+		if readErr != nil && !os.IsNotExist(readErr) {
+			return errors.Join(readErr, restoreWritten(written, created))
+		}
+		if err := utils.WriteFileAtomic(file.path, file.data, 0644); err != nil {
+			return errors.Join(err, restoreWritten(written, created))
+		}
+		if os.IsNotExist(readErr) {
+			created = append(created, file.path)
+		} else {
+			written = append(written, fileContent{path: file.path, data: previous})
+		}
+	}
 	return nil
 }
 
-// SetActiveRecord updates the active record set
-func (w *Writer) SetActiveRecord(recordName string) error {
-	// Load current config
-	config, err := Load(w.configPath)
+// restoreWritten puts back the previous contents of files written by
+// writeFiles and removes the files it created
+func restoreWritten(written []fileContent, created []string) error {
+	var errs []error
+	for _, file := range written {
+		if err := utils.WriteFileAtomic(file.path, file.data, 0644); err != nil {
+			errs = append(errs, fmt.Errorf("failed to restore %s: %w", file.path, err))
+		}
+	}
+	for _, path := range created {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("failed to remove %s: %w", path, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Rollback restores the config files to a revision of the history. The
+// restored config is validated first; the rollback is recorded as a new
+// revision, so it can be undone too.
+func (w *Writer) Rollback(revision int) error {
+	lock, err := lockConfig(w.configPath)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	entry, err := HistoryAt(w.configPath, revision)
 	if err != nil {
 		return err
 	}
+	return w.restore(entry)
+}
 
-	// Check if record exists
-	if _, exists := config.Records[recordName]; !exists {
-		return fmt.Errorf("record '%s' does not exist", recordName)
+// Undo reverts the latest change to the config files and returns the
+// revision restored. A change made by hand since the last write is reverted
+// first.
+func (w *Writer) Undo() (int, error) {
+	lock, err := lockConfig(w.configPath)
+	if err != nil {
+		return 0, err
 	}
+	defer lock.unlock()
 
-	// Update active record
-	config.ActiveRecord = recordName
+	entries, err := History(w.configPath)
+	if err != nil {
+		return 0, err
+	}
+	if len(entries) == 0 {
+		return 0, fmt.Errorf("no history recorded for %s", w.configPath)
+	}
+
+	target := &entries[len(entries)-1]
+	if target.IsCurrent(w.configPath) {
+		if len(entries) == 1 {
+			return 0, fmt.Errorf("nothing to undo: revision %d is the oldest in the history", target.Revision)
+		}
+		target = &entries[len(entries)-2]
+	}
 
-	// Write back
-	return w.Write(config)
+	return target.Revision, w.restore(target)
 }
 
-// AddRecord adds a new record to a record set
-func (w *Writer) AddRecord(recordSetName string, record reghost.Record) error {
-	// Load current config
-	config, err := Load(w.configPath)
-	if err != nil {
+// restore writes back the files of a history entry; the caller holds the lock
+func (w *Writer) restore(entry *HistoryEntry) error {
+	if err := checkHistoryFiles(w.configPath, entry.Files); err != nil {
+		return fmt.Errorf("cannot restore revision %d: %w", entry.Revision, err)
+	}
+
+	files := make(map[string][]byte, len(entry.Files))
+	for _, file := range entry.Files {
+		files[absPath(file.Path)] = []byte(file.Content)
+	}
+	if _, err := load(snapshotSource{files: files}, w.configPath); err != nil {
+		return fmt.Errorf("%w: cannot restore revision %d: %w", ErrInvalidConfig, entry.Revision, err)
+	}
+
+	if err := recordHistory(w.configPath, ""); err != nil {
+		return fmt.Errorf("failed to record history: %w", err)
+	}
+	if err := restoreFiles(w.configPath, entry.Files); err != nil {
 		return err
 	}
+	if err := recordHistory(w.configPath, w.command); err != nil {
+		return fmt.Errorf("config restored, but failed to record history: %w", err)
+	}
+	return nil
+}
 
-	// Add record to the set
-	if _, exists := config.Records[recordSetName]; !exists {
-		config.Records[recordSetName] = []reghost.Record{}
+// SetActiveRecord updates the active record set
+func (w *Writer) SetActiveRecord(recordName string) error {
+	return w.update(func(config *reghost.Config) error {
+		// Check if record exists
+		if _, exists := config.Records[recordName]; !exists {
+			return reghost.NotFound("record set '%s' does not exist", recordName)
+		}
+
+		// Update active record, replacing any layered sets
+		config.SetActive(reghost.RecordSetNames{recordName})
+
+		return nil
+	})
+}
+
+// ActivateRecordSet pushes a record set on top of the active sets, where it
+// takes precedence over the others
+func (w *Writer) ActivateRecordSet(name string) error {
+	return w.update(func(config *reghost.Config) error {
+		// Check if record exists
+		if _, exists := config.Records[name]; !exists {
+			return reghost.NotFound("record set '%s' does not exist", name)
+		}
+
+		config.SetActive(config.Active().Activate(name))
+
+		return nil
+	})
+}
+
+// DeactivateRecordSet removes a record set from the active sets. An empty
+// name pops the set on top.
+func (w *Writer) DeactivateRecordSet(name string) (string, error) {
+	err := w.update(func(config *reghost.Config) error {
+		active := config.Active()
+		if name == "" {
+			name = active[0]
+		}
+		if !active.Contains(name) {
+			return reghost.NotFound("record set '%s' is not active", name)
+		}
+		if len(active) == 1 {
+			return fmt.Errorf("cannot deactivate '%s': it is the only active record set", name)
+		}
+
+		config.SetActive(active.Deactivate(name))
+		return nil
+	})
+	if err != nil {
+		return "", err
 	}
+	return name, nil
+}
+
+// AddRecord adds a new record to a record set
+func (w *Writer) AddRecord(recordSetName string, record reghost.Record) error {
+	return w.update(func(config *reghost.Config) error {
+		// Add record to the set
+		if _, exists := config.Records[recordSetName]; !exists {
+			config.Records[recordSetName] = []reghost.Record{}
+		}
 
-	config.Records[recordSetName] = append(config.Records[recordSetName], record)
+		config.Records[recordSetName] = append(config.Records[recordSetName], record)
 
-	// Write back
-	return w.Write(config)
+		return nil
+	})
 }
 
 // RemoveRecord removes a record from a record set
 func (w *Writer) RemoveRecord(recordSetName string, index int) error {
-	// Load current config
-	config, err := Load(w.configPath)
+	_, err := w.RemoveRecordBy(recordSetName, RecordSelector{Index: index})
+	return err
+}
+
+// RemoveRecordBy removes the record picked by selector from a record set
+func (w *Writer) RemoveRecordBy(recordSetName string, selector RecordSelector) (*RecordChange, error) {
+	var change *RecordChange
+	err := w.update(func(config *reghost.Config) error {
+		// Check if record set exists
+		records, exists := config.Records[recordSetName]
+		if !exists {
+			return reghost.NotFound("record set '%s' does not exist", recordSetName)
+		}
+
+		index, err := selector.find(recordSetName, records)
+		if err != nil {
+			return err
+		}
+		change = &RecordChange{Set: recordSetName, Index: index, Before: records[index]}
+
+		// Remove record
+		config.Records[recordSetName] = append(records[:index], records[index+1:]...)
+		return nil
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return change, nil
+}
 
-	// Check if record set exists
-	records, exists := config.Records[recordSetName]
-	if !exists {
-		return fmt.Errorf("record set '%s' does not exist", recordSetName)
-	}
+// UpdateRecord changes a record of a record set in place through update
+func (w *Writer) UpdateRecord(recordSetName string, index int, update func(*reghost.Record)) error {
+	_, err := w.UpdateRecordBy(recordSetName, RecordSelector{Index: index}, update)
+	return err
+}
+
+// UpdateRecordBy changes the record picked by selector in place through
+// update
+func (w *Writer) UpdateRecordBy(recordSetName string, selector RecordSelector, update func(*reghost.Record)) (*RecordChange, error) {
+	var change *RecordChange
+	err := w.update(func(config *reghost.Config) error {
+		records, err := editableRecords(config, recordSetName)
+		if err != nil {
+			return err
+		}
 
-	// Check if index is valid
-	if index < 0 || index >= len(records) {
-		return fmt.Errorf("invalid index %d for record set '%s'", index, recordSetName)
+		index, err := selector.find(recordSetName, records)
+		if err != nil {
+			return err
+		}
+		change = &RecordChange{Set: recordSetName, Index: index, Before: records[index]}
+
+		update(&records[index])
+		after := records[index]
+		change.After = &after
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return change, nil
+}
 
-	// Remove record
-	config.Records[recordSetName] = append(records[:index], records[index+1:]...)
+// MoveRecord moves a record of a record set from one index to another.
+// Records listed first take precedence.
+func (w *Writer) MoveRecord(recordSetName string, from, to int) error {
+	return w.update(func(config *reghost.Config) error {
+		records, err := editableRecords(config, recordSetName)
+		if err != nil {
+			return err
+		}
 
-	// Write back
-	return w.Write(config)
+		// Check if indexes are valid
+		for _, index := range []int{from, to} {
+			if index < 0 || index >= len(records) {
+				return fmt.Errorf("invalid index %d for record set '%s'", index, recordSetName)
+			}
+		}
+
+		record := records[from]
+		records = append(records[:from], records[from+1:]...)
+		records = append(records[:to], append([]reghost.Record{record}, records[to:]...)...)
+		config.Records[recordSetName] = records
+		return nil
+	})
 }
 
 // CreateRecordSet creates a new record set with a default record
 func (w *Writer) CreateRecordSet(name string) error {
-	// Load current config
-	config, err := Load(w.configPath)
-	if err != nil {
-		return err
-	}
-
-	// Check if already exists
-	if _, exists := config.Records[name]; exists {
-		return fmt.Errorf("record set '%s' already exists", name)
-	}
-
 	// Create record set with default record
-	config.Records[name] = []reghost.Record{
+	return w.createRecordSet(name, []reghost.Record{
 		{
 			Domain: "reghost.local",
 			IP:     "127.0.0.1",
 		},
+	})
+}
+
+// CreateEmptyRecordSet creates a new record set without records. It cannot
+// be activated until records are added.
+func (w *Writer) CreateEmptyRecordSet(name string) error {
+	return w.createRecordSet(name, []reghost.Record{})
+}
+
+// CopyRecordSet creates a record set holding a copy of the records of
+// another one, including the sets it extends. The copy is written to the
+// main config file.
+func (w *Writer) CopyRecordSet(source, name string) error {
+	return w.update(func(config *reghost.Config) error {
+		records, exists := config.Records[source]
+		if !exists {
+			return reghost.NotFound("record set '%s' does not exist", source)
+		}
+		if err := checkNewRecordSet(config, name); err != nil {
+			return err
+		}
+
+		config.Records[name] = append([]reghost.Record{}, records...)
+		if parents := config.Extends[source]; len(parents) > 0 {
+			if config.Extends == nil {
+				config.Extends = make(map[string][]string)
+			}
+			config.Extends[name] = append([]string{}, parents...)
+		}
+		return nil
+	})
+}
+
+// RenameRecordSet renames a record set in the file that defines it, and
+// updates the active record sets, the sets extending it, the views serving
+// it and the set receiving dynamic updates
+func (w *Writer) RenameRecordSet(oldName, newName string) error {
+	return w.update(func(config *reghost.Config) error {
+		if _, err := editableRecords(config, oldName); err != nil {
+			return err
+		}
+		if err := checkNewRecordSet(config, newName); err != nil {
+			return err
+		}
+
+		config.Records[newName] = config.Records[oldName]
+		delete(config.Records, oldName)
+		if parents, ok := config.Extends[oldName]; ok {
+			config.Extends[newName] = parents
+			delete(config.Extends, oldName)
+		}
+		if source, ok := config.Sources[oldName]; ok {
+			config.Sources[newName] = source
+			delete(config.Sources, oldName)
+		}
+
+		active := append(reghost.RecordSetNames{}, config.Active()...)
+		for i, name := range active {
+			if name == oldName {
+				active[i] = newName
+			}
+		}
+		config.SetActive(active)
+		for _, parents := range config.Extends {
+			for i, parent := range parents {
+				if parent == oldName {
+					parents[i] = newName
+				}
+			}
+		}
+		for i := range config.Views {
+			if config.Views[i].RecordSet == oldName {
+				config.Views[i].RecordSet = newName
+			}
+		}
+		if config.Update != nil && config.Update.RecordSet == oldName {
+			config.Update.RecordSet = newName
+		}
+		return nil
+	})
+}
+
+// createRecordSet adds a record set holding records
+func (w *Writer) createRecordSet(name string, records []reghost.Record) error {
+	return w.update(func(config *reghost.Config) error {
+		if err := checkNewRecordSet(config, name); err != nil {
+			return err
+		}
+
+		config.Records[name] = records
+		return nil
+	})
+}
+
+// checkNewRecordSet fails when name cannot be used for a new record set
+func checkNewRecordSet(config *reghost.Config, name string) error {
+	// Check if already exists
+	if _, exists := config.Records[name]; exists {
+		return fmt.Errorf("record set '%s' already exists", name)
+	}
+	if strings.HasPrefix(name, reghost.ProjectSetPrefix) {
+		return fmt.Errorf("record set names starting with '%s' are reserved for projects", reghost.ProjectSetPrefix)
 	}
+	return nil
+}
 
-	// Write back
-	return w.Write(config)
+// editableRecords returns the records of a record set that may be changed
+// through the writer
+func editableRecords(config *reghost.Config, name string) ([]reghost.Record, error) {
+	// Check if record set exists
+	records, exists := config.Records[name]
+	if !exists {
+		return nil, reghost.NotFound("record set '%s' does not exist", name)
+	}
+	if project := projectForFile(config, config.Sources[name]); project != nil {
+		return nil, fmt.Errorf("record set '%s' belongs to project '%s', edit %s instead", name, project.Name, ProjectFilePath(*project))
+	}
+	return records, nil
 }
 
 // DeleteRecordSet deletes a record set
 func (w *Writer) DeleteRecordSet(name string) error {
-	// Load current config
-	config, err := Load(w.configPath)
-	if err != nil {
-		return err
-	}
+	return w.update(func(config *reghost.Config) error {
+		// Check if it's the active record
+		if config.Active().Contains(name) {
+			return fmt.Errorf("cannot delete active record set '%s'", name)
+		}
 
-	// Check if it's the active record
-	if config.ActiveRecord == name {
-		return fmt.Errorf("cannot delete active record set '%s'", name)
-	}
+		if project := projectForFile(config, config.Sources[name]); project != nil {
+			return fmt.Errorf("record set '%s' belongs to project '%s', unregister the project instead", name, project.Name)
+		}
+
+		// Delete record set
+		delete(config.Records, name)
+		delete(config.Extends, name)
+
+		return nil
+	})
+}
+
+// ModifyRecordSet replaces the records of a record set with the result of
+// modify, creating the set if it does not exist yet
+func (w *Writer) ModifyRecordSet(name string, modify func([]reghost.Record) ([]reghost.Record, error)) error {
+	return w.update(func(config *reghost.Config) error {
+		records, err := modify(config.Records[name])
+		if err != nil {
+			return err
+		}
+		config.Records[name] = records
+
+		return nil
+	})
+}
+
+// RegisterProject registers a project directory. Its records are served as
+// the record set "project/<name>" once its .reghost.yml loads.
+func (w *Writer) RegisterProject(project reghost.Project) error {
+	return w.update(func(config *reghost.Config) error {
+		for _, existing := range config.Projects {
+			if existing.Name == project.Name {
+				return fmt.Errorf("project '%s' is already registered", project.Name)
+			}
+			if existing.Path == project.Path {
+				return fmt.Errorf("%s is already registered as project '%s'", project.Path, existing.Name)
+			}
+		}
+		if owner, exists := config.Sources[project.SetName()]; exists {
+			return fmt.Errorf("record set '%s' is already defined in %s", project.SetName(), owner)
+		}
+
+		config.Projects = append(config.Projects, project)
+
+		return nil
+	})
+}
 
-	// Delete record set
-	delete(config.Records, name)
+// UnregisterProject removes a project, given its name or path. The config is
+// only validated once the project is gone, so a project breaking it can be
+// unregistered.
+func (w *Writer) UnregisterProject(nameOrPath string) (*reghost.Project, error) {
+	var removed *reghost.Project
+	err := w.updateWith(loadUncheckedWithRevision, func(config *reghost.Config) error {
+		for i, project := range config.Projects {
+			if project.Name != nameOrPath && project.Path != nameOrPath {
+				continue
+			}
 
-	// Write back
-	return w.Write(config)
+			if active := config.Active(); active.Contains(project.SetName()) {
+				if len(active) == 1 {
+					return fmt.Errorf("cannot unregister project '%s': its record set is the only active one", project.Name)
+				}
+				config.SetActive(active.Deactivate(project.SetName()))
+			}
+
+			config.Projects = append(config.Projects[:i], config.Projects[i+1:]...)
+			delete(config.Records, project.SetName())
+			delete(config.Sources, project.SetName())
+
+			removed = &project
+			return nil
+		}
+
+		return reghost.NotFound("project '%s' is not registered", nameOrPath)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return removed, nil
 }
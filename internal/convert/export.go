@@ -0,0 +1,166 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+// exportedRecord is a rule in the JSON export format
+type exportedRecord struct {
+	ID     string `json:"id,omitempty"`
+	Domain string `json:"domain"`
+	IP     string `json:"ip"`
+	Set    string `json:"set,omitempty"`
+}
+
+// Export writes the records of a record set, including the records it
+// inherits, in one of the export formats. Only JSON can hold regex rules;
+// the other formats get the sample hostnames of cfg that a rule answers
+// for, and a comment for each regex rule that no sample matches. Those
+// rules are returned as issues.
+func Export(w io.Writer, format string, cfg *reghost.Config, set string) ([]Issue, error) {
+	if _, ok := cfg.Records[set]; !ok {
+		return nil, reghost.NotFound("record set '%s' not found", set)
+	}
+	records := cfg.GetRecordSet(set)
+
+	if format == FormatJSON {
+		return nil, exportJSON(w, records)
+	}
+
+	var write func(io.Writer, string, []reghost.Record, []reghost.Record) error
+	switch format {
+	case FormatHosts:
+		write = exportHosts
+	case FormatDnsmasq:
+		write = exportDnsmasq
+	case FormatZone:
+		write = exportZone
+	case FormatCorefile:
+		write = exportCorefile
+	default:
+		return nil, fmt.Errorf("unsupported export format '%s' (want hosts, dnsmasq, corefile, zone or json)", format)
+	}
+
+	names, unexpanded := expand(records, cfg.Samples)
+	var issues []Issue
+	for _, record := range unexpanded {
+		issues = append(issues, Issue{
+			Text:   fmt.Sprintf("%s -> %s", record.Domain, record.IP),
+			Reason: "regex rule matches no sample hostname and was written as a comment",
+		})
+	}
+	return issues, write(w, set, names, unexpanded)
+}
+
+// expand returns the names the records answer for, with the sample
+// hostnames standing in for regex rules, and the regex rules that no sample
+// matches
+func expand(records []reghost.Record, samples []string) ([]reghost.Record, []reghost.Record) {
+	matcher := reghost.NewMatcher(records)
+	names := matcher.Enumerate(samples)
+
+	expanded := make(map[string]bool)
+	for _, sample := range samples {
+		if record, ok := matcher.MatchRecord(sample); ok {
+			expanded[record.Domain] = true
+		}
+	}
+
+	var unexpanded []reghost.Record
+	for _, record := range records {
+		if strings.HasPrefix(record.Domain, "^") && !expanded[record.Domain] {
+			unexpanded = append(unexpanded, record)
+		}
+	}
+
+	for i := range names {
+		names[i].Domain = strings.TrimSuffix(names[i].Domain, ".")
+	}
+	return names, unexpanded
+}
+
+// exportHosts writes records as a hosts file
+func exportHosts(w io.Writer, set string, names, unexpanded []reghost.Record) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(tw, "# Record set '%s', exported by reghostctl\n", set)
+	writeUnexpanded(tw, "#", unexpanded)
+	for _, record := range names {
+		fmt.Fprintf(tw, "%s\t%s\n", record.IP, record.Domain)
+	}
+	return tw.Flush()
+}
+
+// exportDnsmasq writes records as dnsmasq host records, which unlike
+// address= options do not match subdomains
+func exportDnsmasq(w io.Writer, set string, names, unexpanded []reghost.Record) error {
+	fmt.Fprintf(w, "# Record set '%s', exported by reghostctl\n", set)
+	writeUnexpanded(w, "#", unexpanded)
+	for _, record := range names {
+		fmt.Fprintf(w, "host-record=%s,%s\n", record.Domain, record.IP)
+	}
+	return nil
+}
+
+// exportZone writes records as zone file A and AAAA records with absolute
+// names, to be included in a zone
+func exportZone(w io.Writer, set string, names, unexpanded []reghost.Record) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(tw, "; Record set '%s', exported by reghostctl\n", set)
+	writeUnexpanded(tw, ";", unexpanded)
+	fmt.Fprintf(tw, "$TTL %d\n", reghost.DefaultZoneTTL)
+	for _, record := range names {
+		fmt.Fprintf(tw, "%s.\tIN\t%s\t%s\n", record.Domain, addressType(record.IP), record.IP)
+	}
+	return tw.Flush()
+}
+
+// exportCorefile writes records as a CoreDNS server block answering from
+// the hosts plugin and forwarding other names to the system resolvers
+func exportCorefile(w io.Writer, set string, names, unexpanded []reghost.Record) error {
+	fmt.Fprintf(w, "# Record set '%s', exported by reghostctl\n", set)
+	writeUnexpanded(w, "#", unexpanded)
+	fmt.Fprintln(w, ". {")
+	fmt.Fprintln(w, "    hosts {")
+	fmt.Fprintf(w, "        ttl %d\n", reghost.DefaultZoneTTL)
+	for _, record := range names {
+		fmt.Fprintf(w, "        %s %s\n", record.IP, record.Domain)
+	}
+	fmt.Fprintln(w, "        fallthrough")
+	fmt.Fprintln(w, "    }")
+	fmt.Fprintln(w, "    forward . /etc/resolv.conf")
+	fmt.Fprintln(w, "}")
+	return nil
+}
+
+// exportJSON writes the rules themselves as a JSON array
+func exportJSON(w io.Writer, records []reghost.Record) error {
+	exported := make([]exportedRecord, len(records))
+	for i, record := range records {
+		exported[i] = exportedRecord{ID: record.ID, Domain: record.Domain, IP: record.IP, Set: record.Set}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(exported)
+}
+
+// writeUnexpanded writes a comment for each regex rule left out
+func writeUnexpanded(w io.Writer, comment string, unexpanded []reghost.Record) {
+	for _, record := range unexpanded {
+		fmt.Fprintf(w, "%s not exported, add matching samples: %s -> %s\n", comment, record.Domain, record.IP)
+	}
+}
+
+// addressType returns the record type of an address
+func addressType(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return "AAAA"
+	}
+	return "A"
+}
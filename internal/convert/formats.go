@@ -0,0 +1,29 @@
+package convert
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Formats understood by Import and Export
+const (
+	FormatHosts    = "hosts"
+	FormatDnsmasq  = "dnsmasq"
+	FormatZone     = "zone"
+	FormatCorefile = "corefile"
+	FormatJSON     = "json"
+)
+
+// fileFormats maps file extensions to import formats
+var fileFormats = map[string]string{
+	".hosts": FormatHosts,
+	".conf":  FormatDnsmasq,
+	".zone":  FormatZone,
+	".json":  FormatJSON,
+}
+
+// FormatForFile returns the import format of a file by its extension, or an
+// empty string if there is none
+func FormatForFile(path string) string {
+	return fileFormats[strings.ToLower(filepath.Ext(path))]
+}
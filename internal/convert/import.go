@@ -0,0 +1,285 @@
+package convert
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/bilgehannal/reghost/pkg/reghost"
+	"github.com/miekg/dns"
+)
+
+// Issue is an entry of an imported file that was not translated into a
+// record
+type Issue struct {
+	// Line is the line number in the file, or 0 when unknown
+	Line   int
+	Text   string
+	Reason string
+}
+
+// String formats the issue for reports
+func (i Issue) String() string {
+	if i.Line > 0 {
+		return fmt.Sprintf("line %d: %s (%s)", i.Line, i.Text, i.Reason)
+	}
+	return fmt.Sprintf("%s (%s)", i.Text, i.Reason)
+}
+
+// systemHosts are the names /etc/hosts defines for the machine itself
+var systemHosts = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"ip6-localnet":          true,
+	"ip6-mcastprefix":       true,
+	"ip6-allnodes":          true,
+	"ip6-allrouters":        true,
+	"ip6-allhosts":          true,
+}
+
+// Import reads records from a file in one of the import formats. origin is
+// the default origin of relative names in zone files.
+func Import(format string, r io.Reader, origin string) ([]reghost.Record, []Issue, error) {
+	switch format {
+	case FormatHosts:
+		return ImportHosts(r)
+	case FormatDnsmasq:
+		return ImportDnsmasq(r)
+	case FormatZone:
+		return ImportZone(r, origin)
+	case FormatJSON:
+		return ImportJSON(r)
+	default:
+		return nil, nil, fmt.Errorf("unsupported import format '%s' (want hosts, dnsmasq, zone or json)", format)
+	}
+}
+
+// ImportJSON reads rules in the JSON export format. The sets they were
+// exported from are dropped.
+func ImportJSON(r io.Reader) ([]reghost.Record, []Issue, error) {
+	var entries []exportedRecord
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, nil, fmt.Errorf("invalid JSON records: %w", err)
+	}
+
+	var records []reghost.Record
+	var issues []Issue
+	for i, entry := range entries {
+		if entry.Domain == "" || entry.IP == "" {
+			issues = append(issues, Issue{Text: fmt.Sprintf("entry %d", i+1), Reason: "domain or ip is empty"})
+			continue
+		}
+		if reason := addressIssue(entry.IP); reason != "" {
+			issues = append(issues, Issue{Text: fmt.Sprintf("entry %d", i+1), Reason: reason})
+			continue
+		}
+		records = append(records, reghost.Record{ID: entry.ID, Domain: entry.Domain, IP: entry.IP})
+	}
+	return records, issues, nil
+}
+
+// ImportHosts reads the entries of a hosts file. Every name of a line
+// becomes a record; the names of the machine itself and IPv6 addresses,
+// which are not served, are skipped.
+func ImportHosts(r io.Reader) ([]reghost.Record, []Issue, error) {
+	var records []reghost.Record
+	var issues []Issue
+
+	err := eachLine(r, true, func(number int, line string) {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			issues = append(issues, Issue{Line: number, Text: line, Reason: "expected an address and a name"})
+			return
+		}
+
+		ip := fields[0]
+		if reason := addressIssue(ip); reason != "" {
+			issues = append(issues, Issue{Line: number, Text: line, Reason: reason})
+			return
+		}
+
+		for _, name := range fields[1:] {
+			if systemHosts[strings.ToLower(name)] {
+				issues = append(issues, Issue{Line: number, Text: line, Reason: fmt.Sprintf("skipped system name '%s'", name)})
+				continue
+			}
+			records = append(records, reghost.Record{Domain: name, IP: ip})
+		}
+	})
+	return records, issues, err
+}
+
+// ImportDnsmasq reads the address= and host-record= options of a dnsmasq
+// configuration. An address= domain also matches its subdomains, so it
+// becomes a regex rule.
+func ImportDnsmasq(r io.Reader) ([]reghost.Record, []Issue, error) {
+	var records []reghost.Record
+	var issues []Issue
+
+	// dnsmasq only has full line comments; '#' is a valid address= value
+	err := eachLine(r, false, func(number int, line string) {
+		option, value, _ := strings.Cut(line, "=")
+		option = strings.TrimSpace(option)
+		value = strings.TrimSpace(value)
+
+		switch option {
+		case "address":
+			// address=/domain/[domain/...]ip
+			parts := strings.Split(value, "/")
+			if len(parts) < 3 || parts[0] != "" {
+				issues = append(issues, Issue{Line: number, Text: line, Reason: "expected address=/domain/ip"})
+				return
+			}
+			ip := parts[len(parts)-1]
+			if ip == "" || ip == "#" {
+				issues = append(issues, Issue{Line: number, Text: line, Reason: "only domains resolving to an address can be imported"})
+				return
+			}
+			if reason := addressIssue(ip); reason != "" {
+				issues = append(issues, Issue{Line: number, Text: line, Reason: reason})
+				return
+			}
+			for _, domain := range parts[1 : len(parts)-1] {
+				if domain == "" || domain == "#" {
+					issues = append(issues, Issue{Line: number, Text: line, Reason: "matching every domain is not supported"})
+					continue
+				}
+				records = append(records, reghost.Record{Domain: SubdomainPattern(domain), IP: ip})
+			}
+
+		case "host-record":
+			// host-record=name[,name...],address[,address][,ttl]
+			var names, ips []string
+			for _, field := range strings.Split(value, ",") {
+				field = strings.TrimSpace(field)
+				if net.ParseIP(field) != nil {
+					if reason := addressIssue(field); reason != "" {
+						issues = append(issues, Issue{Line: number, Text: line, Reason: reason})
+						continue
+					}
+					ips = append(ips, field)
+				} else if len(ips) == 0 {
+					names = append(names, field)
+				}
+			}
+			if len(names) == 0 || len(ips) == 0 {
+				issues = append(issues, Issue{Line: number, Text: line, Reason: "expected host-record=name,address"})
+				return
+			}
+			for _, name := range names {
+				for _, ip := range ips {
+					records = append(records, reghost.Record{Domain: name, IP: ip})
+				}
+			}
+
+		default:
+			issues = append(issues, Issue{Line: number, Text: line, Reason: "not an address or host record"})
+		}
+	})
+	return records, issues, err
+}
+
+// ImportZone reads the A records of an RFC 1035 zone file. A wildcard owner
+// becomes a regex rule matching the names below it.
+func ImportZone(r io.Reader, origin string) ([]reghost.Record, []Issue, error) {
+	var records []reghost.Record
+	var issues []Issue
+
+	zp := dns.NewZoneParser(r, dns.Fqdn(origin), "")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		a, ok := rr.(*dns.A)
+		if !ok {
+			rrType := dns.TypeToString[rr.Header().Rrtype]
+			issues = append(issues, Issue{Text: rr.String(), Reason: fmt.Sprintf("unsupported record type %s", rrType)})
+			continue
+		}
+
+		name := rr.Header().Name
+		domain := strings.TrimSuffix(name, ".")
+		if rest, ok := strings.CutPrefix(name, "*."); ok {
+			domain = WildcardPattern(rest)
+		}
+		records = append(records, reghost.Record{Domain: domain, IP: a.A.String()})
+	}
+	if err := zp.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse zone: %w", err)
+	}
+	return records, issues, nil
+}
+
+// addressIssue returns why ip cannot be served as an A record, or "" when it
+// can. reghost only answers A queries, so IPv6 addresses are not imported.
+func addressIssue(ip string) string {
+	parsed := net.ParseIP(ip)
+	switch {
+	case parsed == nil:
+		return fmt.Sprintf("invalid address '%s'", ip)
+	case parsed.To4() == nil:
+		return fmt.Sprintf("IPv6 address '%s' is not served", ip)
+	default:
+		return ""
+	}
+}
+
+// SubdomainPattern returns a regex rule matching a domain and all of its
+// subdomains
+func SubdomainPattern(domain string) string {
+	return `^(.+\.)?` + quoteDomain(domain) + `$`
+}
+
+// WildcardPattern returns a regex rule matching the names below a domain,
+// like a DNS wildcard
+func WildcardPattern(domain string) string {
+	return `^.+\.` + quoteDomain(domain) + `$`
+}
+
+// quoteDomain returns a domain as a regex matching its fully qualified form
+func quoteDomain(domain string) string {
+	return regexp.QuoteMeta(reghost.Fqdn(domain))
+}
+
+// MergeRecords appends the imported records that are not in existing yet
+func MergeRecords(existing, imported []reghost.Record) []reghost.Record {
+	merged := append([]reghost.Record{}, existing...)
+	for _, record := range imported {
+		duplicate := false
+		for _, other := range merged {
+			if reghost.SameDomain(other.Domain, record.Domain) && other.IP == record.IP {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			merged = append(merged, record)
+		}
+	}
+	return merged
+}
+
+// eachLine calls fn with every line of r that is not empty or a comment.
+// Comments start with '#', at the start of a line unless inlineComments.
+func eachLine(r io.Reader, inlineComments bool, fn func(number int, line string)) error {
+	scanner := bufio.NewScanner(r)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(line, '#'); i >= 0 && (inlineComments || i == 0) {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line == "" {
+			continue
+		}
+		fn(number, line)
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+	return nil
+}
@@ -1,7 +1,9 @@
 package dns
 
 import (
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/bilgehannal/reghost/pkg/reghost"
 )
@@ -10,15 +12,54 @@ import (
 type Cache struct {
 	mu       sync.RWMutex
 	resolver *reghost.Resolver
+	// records are the records of the active record set
+	records []reghost.Record
+	// layers hold runtime records, ordered by rank
+	layers []cacheLayer
+	// generation increases on every update and serves as the zone serial
+	generation uint32
+	// views are the caches of views. They hold their own record set and
+	// follow the runtime layers of this cache.
+	views []*Cache
+}
+
+// Layer ranks. Layers with a lower rank take precedence, and layers of the
+// same rank keep the order they were added in.
+const (
+	// UpdateRank is the rank of the records of dynamic updates
+	UpdateRank = -1
+	// ConfigRank is the rank of the active records of the config file
+	ConfigRank = 0
+	// ProviderRank is the rank of the first provider; the others follow
+	ProviderRank = 1
+)
+
+// cacheLayer is a named set of runtime records
+type cacheLayer struct {
+	name    string
+	rank    int
+	records []reghost.Record
 }
 
 // NewCache creates a new DNS cache
 func NewCache(records []reghost.Record) *Cache {
 	return &Cache{
-		resolver: reghost.NewResolver(records),
+		resolver:   reghost.NewResolver(records),
+		records:    records,
+		generation: nextGeneration(0),
 	}
 }
 
+// nextGeneration returns a generation that is greater than the previous one
+// and, when possible, tracks wall clock time so it keeps growing across restarts
+func nextGeneration(prev uint32) uint32 {
+	now := uint32(time.Now().Unix())
+	if now > prev {
+		return now
+	}
+	return prev + 1
+}
+
 // Lookup performs a DNS lookup in the cache
 func (c *Cache) Lookup(domain string) (string, bool) {
 	c.mu.RLock()
@@ -32,7 +73,94 @@ func (c *Cache) Update(records []reghost.Record) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.resolver.UpdateRecords(records)
+	c.records = records
+	c.rebuild()
+}
+
+// SetViews replaces the caches of views with one cache per record set. They
+// start with the runtime layers of c and follow later changes to them.
+func (c *Cache) SetViews(recordSets [][]reghost.Record) []*Cache {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	views := make([]*Cache, len(recordSets))
+	for i, records := range recordSets {
+		view := NewCache(records)
+		view.layers = append([]cacheLayer(nil), c.layers...)
+		view.rebuild()
+		views[i] = view
+	}
+	c.views = views
+	return views
+}
+
+// SetLayer replaces the records of a runtime layer, here and in the caches
+// of views. Layers ranked below ConfigRank take precedence over the active
+// records, the others come after them. The rank of an existing layer is kept.
+func (c *Cache) SetLayer(name string, rank int, records []reghost.Record) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, view := range c.views {
+		view.SetLayer(name, rank, records)
+	}
+
+	for i := range c.layers {
+		if c.layers[i].name == name {
+			c.layers[i].records = records
+			c.rebuild()
+			return
+		}
+	}
+
+	c.layers = append(c.layers, cacheLayer{name: name, rank: rank, records: records})
+	sort.SliceStable(c.layers, func(i, j int) bool {
+		return c.layers[i].rank < c.layers[j].rank
+	})
+	c.rebuild()
+}
+
+// Layer returns a copy of the records of a runtime layer
+func (c *Cache) Layer(name string) []reghost.Record {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, layer := range c.layers {
+		if layer.name == name {
+			records := make([]reghost.Record, len(layer.records))
+			copy(records, layer.records)
+			return records
+		}
+	}
+	return nil
+}
+
+// rebuild merges the layers and the active records into the resolver in
+// rank order. The caller must hold the write lock.
+func (c *Cache) rebuild() {
+	var merged []reghost.Record
+	configMerged := false
+	for _, layer := range c.layers {
+		if layer.rank >= ConfigRank && !configMerged {
+			merged = append(merged, c.records...)
+			configMerged = true
+		}
+		merged = append(merged, layer.records...)
+	}
+	if !configMerged {
+		merged = append(merged, c.records...)
+	}
+
+	c.resolver.UpdateRecords(merged)
+	c.generation = nextGeneration(c.generation)
+}
+
+// Generation returns the current reload generation
+func (c *Cache) Generation() uint32 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.generation
 }
 
 // GetDomains returns all domain patterns from the cache
@@ -50,3 +178,11 @@ func (c *Cache) GetRecords() []reghost.Record {
 
 	return c.resolver.GetRecords()
 }
+
+// Enumerate returns the listable records, expanding regex rules via samples
+func (c *Cache) Enumerate(samples []string) []reghost.Record {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.resolver.Enumerate(samples)
+}
@@ -0,0 +1,124 @@
+package dns
+
+import (
+	"strings"
+	"time"
+
+	"github.com/bilgehannal/reghost/internal/dnssec"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+	"github.com/miekg/dns"
+)
+
+// zoneKeys returns the signing keys of a zone, or nil when it is unsigned
+func (h *Handler) zoneKeys(zone *reghost.Zone) *dnssec.ZoneKeys {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.keys[zone.Origin()]
+}
+
+// wantsDNSSEC reports whether the client set the DO bit
+func wantsDNSSEC(r *dns.Msg) bool {
+	opt := r.IsEdns0()
+	return opt != nil && opt.Do()
+}
+
+// dnssecAnswer answers the DNSSEC specific queries at a zone apex. It
+// returns false when the query is not one of them.
+func (h *Handler) dnssecAnswer(m *dns.Msg, q dns.Question, zone *reghost.Zone, keys *dnssec.ZoneKeys) bool {
+	switch q.Qtype {
+	case dns.TypeDNSKEY:
+		m.Answer = append(m.Answer, keys.DNSKEYs(zone.RecordTTL())...)
+	case dns.TypeDS:
+		ds := keys.DS()
+		ds.Hdr.Ttl = zone.RecordTTL()
+		m.Answer = append(m.Answer, ds)
+	case dns.TypeNSEC3PARAM:
+		if !h.useNSEC3() {
+			return false
+		}
+		m.Answer = append(m.Answer, dnssec.NSEC3PARAM(zone.Origin(), zone.NegativeTTL()))
+	default:
+		return false
+	}
+	return true
+}
+
+// useNSEC3 reports whether negative answers use NSEC3
+func (h *Handler) useNSEC3() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	return h.nsec3
+}
+
+// signReply adds denial of existence records and signatures to a reply
+func (h *Handler) signReply(m *dns.Msg, qname string, zone *reghost.Zone, keys *dnssec.ZoneKeys) error {
+	if m.Rcode == dns.RcodeNameError || (m.Rcode == dns.RcodeSuccess && len(m.Answer) == 0) {
+		denial := &dnssec.Denial{
+			Zone:     zone.Origin(),
+			QName:    qname,
+			NXDomain: m.Rcode == dns.RcodeNameError,
+			TTL:      zone.NegativeTTL(),
+		}
+
+		if denial.NXDomain {
+			denial.Encloser = h.closestEncloser(qname, zone)
+			denial.EncloserTypes = h.typesAt(denial.Encloser, zone)
+		} else {
+			denial.Types = h.typesAt(qname, zone)
+		}
+
+		if h.useNSEC3() {
+			m.Ns = append(m.Ns, denial.NSEC3()...)
+		} else {
+			m.Ns = append(m.Ns, denial.NSEC()...)
+		}
+	}
+
+	now := time.Now()
+	var err error
+	if m.Answer, err = keys.Sign(m.Answer, now); err != nil {
+		return err
+	}
+	if m.Ns, err = keys.Sign(m.Ns, now); err != nil {
+		return err
+	}
+	if m.Extra, err = keys.Sign(m.Extra, now); err != nil {
+		return err
+	}
+
+	m.SetEdns0(dns.DefaultMsgSize, true)
+	return nil
+}
+
+// closestEncloser returns the nearest existing ancestor of a name in a zone
+func (h *Handler) closestEncloser(name string, zone *reghost.Zone) string {
+	name = reghost.Fqdn(name)
+	for name != zone.Origin() {
+		i := strings.Index(name, ".")
+		if i < 0 || i == len(name)-1 {
+			break
+		}
+		name = name[i+1:]
+		if _, found := h.cache.Lookup(name); found {
+			return name
+		}
+	}
+	return zone.Origin()
+}
+
+// typesAt lists the record types that exist at a name in a signed zone
+func (h *Handler) typesAt(name string, zone *reghost.Zone) []uint16 {
+	var types []uint16
+	if _, found := h.cache.Lookup(name); found {
+		types = append(types, dns.TypeA)
+	}
+	if reghost.Fqdn(name) == zone.Origin() {
+		types = append(types, dns.TypeSOA, dns.TypeNS, dns.TypeDNSKEY)
+		if h.useNSEC3() {
+			types = append(types, dns.TypeNSEC3PARAM)
+		}
+	}
+	return types
+}
@@ -2,28 +2,250 @@ package dns
 
 import (
 	"net"
+	"net/netip"
 	"strings"
+	"sync"
 
+	"github.com/bilgehannal/reghost/internal/dnssec"
 	"github.com/bilgehannal/reghost/internal/utils"
+	"github.com/bilgehannal/reghost/pkg/reghost"
 	"github.com/miekg/dns"
 )
 
 // Handler handles DNS requests
 type Handler struct {
-	cache  *Cache
-	logger *utils.Logger
+	cache   *Cache
+	logger  *utils.Logger
+	keyring *keyring
+	metrics *Metrics
+
+	mu           sync.RWMutex
+	zones        []reghost.Zone
+	outOfZone    string
+	forwarders   []string
+	transfer     *reghost.Transfer
+	transferNets []netip.Prefix
+	samples      []string
+	update       *reghost.Update
+	store        RecordStore
+	keys         map[string]*dnssec.ZoneKeys
+	nsec3        bool
+	acl          []netip.Prefix
+	views        []view
+	limiter      *rateLimiter
+
+	// updateMu serializes dynamic updates from prerequisite check to apply
+	updateMu sync.Mutex
+}
+
+// view is a handler answering a group of clients from its own record set
+type view struct {
+	name    string
+	clients []netip.Prefix
+	handler *Handler
 }
 
 // NewHandler creates a new DNS handler
 func NewHandler(cache *Cache, logger *utils.Logger) *Handler {
 	return &Handler{
-		cache:  cache,
-		logger: logger,
+		cache:   cache,
+		logger:  logger,
+		keyring: newKeyring(),
+		metrics: &Metrics{},
+	}
+}
+
+// Configure applies the zone, transfer, update, DNSSEC, ACL, view and rate
+// limit settings of the configuration
+func (h *Handler) Configure(cfg *reghost.Config) {
+	h.keyring.Update(cfg.TSIGKeys)
+
+	keys, err := dnssec.LoadAll(cfg)
+	if err != nil {
+		h.logger.Error("Failed to load DNSSEC keys, zones will be served unsigned: %v", err)
+	}
+
+	// The config has been validated, so parse errors cannot happen here
+	var acl []netip.Prefix
+	if cfg.ACL != nil {
+		acl, _ = reghost.ParseNetworks(cfg.ACL.Allow)
 	}
+
+	// Keep the current buckets across reloads that leave the limits unchanged
+	h.mu.RLock()
+	limiter := h.limiter
+	h.mu.RUnlock()
+	if cfg.RateLimit == nil {
+		limiter = nil
+	} else if limiter == nil || limiter.settings != *cfg.RateLimit {
+		limiter = newRateLimiter(cfg.RateLimit)
+	}
+
+	// Views serve their record set in place of the active ones, together
+	// with the same runtime layers
+	recordSets := make([][]reghost.Record, len(cfg.Views))
+	for i, v := range cfg.Views {
+		recordSets[i] = cfg.GetRecordSet(v.RecordSet)
+	}
+	caches := h.cache.SetViews(recordSets)
+
+	views := make([]view, 0, len(cfg.Views))
+	for i, v := range cfg.Views {
+		clients, _ := reghost.ParseNetworks(v.Clients)
+		child := NewHandler(caches[i], h.logger)
+		child.keyring = h.keyring
+		child.metrics = h.metrics
+		child.limiter = limiter
+		child.apply(cfg, keys)
+		views = append(views, view{name: v.Name, clients: clients, handler: child})
+	}
+
+	h.apply(cfg, keys)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.acl = acl
+	h.views = views
+	h.limiter = limiter
 }
 
-// ServeDNS handles a DNS request
+// apply sets the zone, transfer, update and DNSSEC settings
+func (h *Handler) apply(cfg *reghost.Config, keys map[string]*dnssec.ZoneKeys) {
+	var transferNets []netip.Prefix
+	if cfg.Transfer != nil {
+		transferNets, _ = reghost.ParseNetworks(cfg.Transfer.Allow)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.zones = cfg.Zones
+	h.outOfZone = cfg.OutOfZone
+	h.forwarders = cfg.Forwarders
+	h.transfer = cfg.Transfer
+	h.transferNets = transferNets
+	h.samples = cfg.Samples
+	h.update = cfg.Update
+	h.keys = keys
+	h.nsec3 = cfg.DNSSEC != nil && cfg.DNSSEC.NSEC3
+}
+
+// Metrics returns the request counters
+func (h *Handler) Metrics() *Metrics {
+	return h.metrics
+}
+
+// TsigProvider returns the TSIG provider backed by the configured keys
+func (h *Handler) TsigProvider() dns.TsigProvider {
+	return h.keyring
+}
+
+// ServeDNS handles a DNS request. Rate limited clients are dropped before
+// anything is logged, clients outside the ACL are refused, and queries are
+// answered by the first view matching the client address. Dynamic updates
+// always apply to the default view.
 func (h *Handler) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	h.mu.RLock()
+	zones := h.zones
+	acl := h.acl
+	views := h.views
+	limiter := h.limiter
+	h.mu.RUnlock()
+
+	h.metrics.queries.Add(1)
+
+	addr, known := clientAddr(w)
+	_, overTCP := w.RemoteAddr().(*net.TCPAddr)
+	if known && !limiter.allowQuery(addr, overTCP) {
+		h.metrics.rateLimited.Add(1)
+		return
+	}
+
+	if acl != nil && (!known || !reghost.ContainsAddr(acl, addr)) {
+		h.metrics.refused.Add(1)
+		h.logger.Warn("Refusing query from %s: not allowed by ACL", w.RemoteAddr())
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		h.writeMsg(w, m)
+		return
+	}
+
+	if r.Opcode == dns.OpcodeUpdate {
+		h.serveUpdate(w, r, zones)
+		return
+	}
+
+	if known {
+		for _, v := range views {
+			if reghost.ContainsAddr(v.clients, addr) {
+				h.logger.Info("Query from %s served by view %s", addr, v.name)
+				v.handler.serve(w, r)
+				return
+			}
+		}
+	}
+
+	h.serve(w, r)
+}
+
+// serve answers a query from the handler's own records
+func (h *Handler) serve(w dns.ResponseWriter, r *dns.Msg) {
+	h.mu.RLock()
+	zones := h.zones
+	limiter := h.limiter
+	h.mu.RUnlock()
+
+	if len(zones) > 0 && len(r.Question) == 1 {
+		switch r.Question[0].Qtype {
+		case dns.TypeAXFR, dns.TypeIXFR:
+			h.serveTransfer(w, r, zones)
+			return
+		}
+	}
+
+	var m *dns.Msg
+	if len(zones) > 0 {
+		m = h.authoritativeReply(r, zones)
+	} else {
+		m = h.reply(r)
+	}
+
+	// Keep UDP responses within the size the client can receive
+	if _, overUDP := w.RemoteAddr().(*net.UDPAddr); overUDP {
+		size := dns.MinMsgSize
+		if opt := r.IsEdns0(); opt != nil {
+			size = int(opt.UDPSize())
+		}
+		m.Truncate(size)
+
+		// Response rate limiting only applies to UDP, where the source
+		// address can be spoofed
+		if addr, known := clientAddr(w); known {
+			switch limiter.checkResponse(addr, m) {
+			case rrlDrop:
+				h.metrics.rrlDropped.Add(1)
+				return
+			case rrlSlip:
+				h.metrics.rrlSlipped.Add(1)
+				m = truncated(m)
+			}
+		}
+	}
+
+	// Send response
+	h.writeMsg(w, m)
+}
+
+// writeMsg sends a response and logs write failures
+func (h *Handler) writeMsg(w dns.ResponseWriter, m *dns.Msg) {
+	if err := w.WriteMsg(m); err != nil {
+		h.logger.Error("Error writing DNS response: %v", err)
+	}
+}
+
+// reply answers a request from the active records without zone semantics
+func (h *Handler) reply(r *dns.Msg) *dns.Msg {
 	m := new(dns.Msg)
 	m.SetReply(r)
 
@@ -42,26 +264,41 @@ func (h *Handler) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
 		// Lookup in cache
 		if ip, found := h.cache.Lookup(qname); found {
 			h.logger.Info("Match found: %s -> %s", qname, ip)
-
-			// Create A record response
-			rr := &dns.A{
-				Hdr: dns.RR_Header{
-					Name:   q.Name,
-					Rrtype: dns.TypeA,
-					Class:  dns.ClassINET,
-					Ttl:    300,
-				},
-				A: net.ParseIP(ip),
-			}
-			m.Answer = append(m.Answer, rr)
+			m.Answer = append(m.Answer, newA(q.Name, ip, 300))
 		} else {
 			h.logger.Info("No match for: %s - returning NXDOMAIN", qname)
 			m.SetRcode(r, dns.RcodeNameError)
 		}
 	}
 
-	// Send response
-	if err := w.WriteMsg(m); err != nil {
-		h.logger.Error("Error writing DNS response: %v", err)
+	return m
+}
+
+// newA creates an A record response
+func newA(name, ip string, ttl uint32) *dns.A {
+	return &dns.A{
+		Hdr: dns.RR_Header{
+			Name:   name,
+			Rrtype: dns.TypeA,
+			Class:  dns.ClassINET,
+			Ttl:    ttl,
+		},
+		A: net.ParseIP(ip),
 	}
 }
+
+// clientAddr returns the source address of a request
+func clientAddr(w dns.ResponseWriter) (netip.Addr, bool) {
+	var ip net.IP
+	switch addr := w.RemoteAddr().(type) {
+	case *net.UDPAddr:
+		ip = addr.IP
+	case *net.TCPAddr:
+		ip = addr.IP
+	default:
+		return netip.Addr{}, false
+	}
+
+	addr, ok := netip.AddrFromSlice(ip)
+	return addr.Unmap(), ok
+}
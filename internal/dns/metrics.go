@@ -0,0 +1,32 @@
+package dns
+
+import "sync/atomic"
+
+// Metrics counts how requests were handled
+type Metrics struct {
+	queries     atomic.Uint64
+	refused     atomic.Uint64
+	rateLimited atomic.Uint64
+	rrlDropped  atomic.Uint64
+	rrlSlipped  atomic.Uint64
+}
+
+// MetricsSnapshot is a point-in-time copy of the counters
+type MetricsSnapshot struct {
+	Queries     uint64 `json:"queries" yaml:"queries"`
+	Refused     uint64 `json:"refused" yaml:"refused"`
+	RateLimited uint64 `json:"rateLimited" yaml:"rateLimited"`
+	RRLDropped  uint64 `json:"rrlDropped" yaml:"rrlDropped"`
+	RRLSlipped  uint64 `json:"rrlSlipped" yaml:"rrlSlipped"`
+}
+
+// Snapshot returns the current counter values
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	return MetricsSnapshot{
+		Queries:     m.queries.Load(),
+		Refused:     m.refused.Load(),
+		RateLimited: m.rateLimited.Load(),
+		RRLDropped:  m.rrlDropped.Load(),
+		RRLSlipped:  m.rrlSlipped.Load(),
+	}
+}
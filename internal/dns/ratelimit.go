@@ -0,0 +1,216 @@
+package dns
+
+import (
+	"container/list"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bilgehannal/reghost/pkg/reghost"
+	"github.com/miekg/dns"
+)
+
+// maxBuckets bounds the number of tracked buckets. Beyond it the least
+// recently used bucket is evicted, which at worst lets that key burst again.
+const maxBuckets = 10000
+
+// sweepInterval is how often buckets that refilled completely are forgotten
+const sweepInterval = time.Minute
+
+// bucket is a token bucket for a single key
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+	denied int
+}
+
+// tokenBuckets rate limits keys with one token bucket each
+type tokenBuckets struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*list.Element
+	// order holds the buckets by last use, the least recently used at the
+	// back
+	order     *list.List
+	lastSweep time.Time
+}
+
+// newTokenBuckets creates buckets refilled at rate tokens per second
+func newTokenBuckets(rate float64, burst int) *tokenBuckets {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBuckets{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// take consumes a token for key. When none is left it returns false and the
+// number of consecutive denials for the key.
+func (t *tokenBuckets) take(key string, now time.Time) (bool, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if now.Sub(t.lastSweep) >= sweepInterval {
+		t.sweep(now)
+		t.lastSweep = now
+	}
+
+	elem, ok := t.buckets[key]
+	if ok {
+		t.order.MoveToFront(elem)
+	} else {
+		if t.order.Len() >= maxBuckets {
+			t.remove(t.order.Back())
+		}
+		elem = t.order.PushFront(&bucket{key: key, tokens: t.burst, last: now})
+		t.buckets[key] = elem
+	}
+	b := elem.Value.(*bucket)
+
+	b.tokens += now.Sub(b.last).Seconds() * t.rate
+	if b.tokens > t.burst {
+		b.tokens = t.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		b.denied++
+		return false, b.denied
+	}
+	b.tokens--
+	b.denied = 0
+	return true, 0
+}
+
+// sweep forgets buckets that have refilled completely. Buckets are ordered
+// by last use, so only those at the back are looked at.
+func (t *tokenBuckets) sweep(now time.Time) {
+	full := time.Duration(t.burst / t.rate * float64(time.Second))
+	for elem := t.order.Back(); elem != nil; elem = t.order.Back() {
+		if now.Sub(elem.Value.(*bucket).last) < full {
+			return
+		}
+		t.remove(elem)
+	}
+}
+
+// remove forgets the bucket of a list element
+func (t *tokenBuckets) remove(elem *list.Element) {
+	t.order.Remove(elem)
+	delete(t.buckets, elem.Value.(*bucket).key)
+}
+
+// rateLimiter applies query and response rate limits per client prefix
+type rateLimiter struct {
+	settings  reghost.RateLimit
+	queries   *tokenBuckets
+	responses *tokenBuckets
+}
+
+// newRateLimiter creates a limiter from the settings, or nil when disabled
+func newRateLimiter(settings *reghost.RateLimit) *rateLimiter {
+	if settings == nil {
+		return nil
+	}
+
+	l := &rateLimiter{settings: *settings}
+	if settings.QueriesPerSecond > 0 {
+		l.queries = newTokenBuckets(settings.QueriesPerSecond, settings.QueryBurst())
+	}
+	if settings.ResponsesPerSecond > 0 {
+		l.responses = newTokenBuckets(settings.ResponsesPerSecond, int(settings.ResponsesPerSecond+0.5))
+	}
+	return l
+}
+
+// clientPrefix groups a client address with its neighbours
+func (l *rateLimiter) clientPrefix(addr netip.Addr) string {
+	v4, v6 := l.settings.PrefixLengths()
+	bits := v6
+	if addr.Is4() {
+		bits = v4
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return addr.String()
+	}
+	return prefix.String()
+}
+
+// allowQuery reports whether the client may send another query. Queries over
+// TCP have buckets of their own, so the TCP retries that slipped responses
+// ask for are not dropped along with the UDP flood that caused them.
+func (l *rateLimiter) allowQuery(addr netip.Addr, tcp bool) bool {
+	if l == nil || l.queries == nil {
+		return true
+	}
+	key := l.clientPrefix(addr)
+	if tcp {
+		key = "tcp/" + key
+	}
+	ok, _ := l.queries.take(key, time.Now())
+	return ok
+}
+
+// Response rate limiting verdicts
+const (
+	rrlSend = iota
+	rrlDrop
+	rrlSlip
+)
+
+// checkResponse decides whether a response may be sent to the client, has to
+// be dropped, or should be replaced by a truncated response
+func (l *rateLimiter) checkResponse(addr netip.Addr, m *dns.Msg) int {
+	if l == nil || l.responses == nil {
+		return rrlSend
+	}
+
+	key := l.clientPrefix(addr) + "/" + responseIdentity(m)
+	ok, denied := l.responses.take(key, time.Now())
+	switch {
+	case ok:
+		return rrlSend
+	case l.settings.Slip > 0 && denied%l.settings.Slip == 0:
+		return rrlSlip
+	default:
+		return rrlDrop
+	}
+}
+
+// responseIdentity groups responses the way RRL does: positive answers by
+// query name and type, negative answers by the zone that denies them, so a
+// flood of random names still counts as one response
+func responseIdentity(m *dns.Msg) string {
+	rcode := dns.RcodeToString[m.Rcode]
+	if len(m.Question) == 0 {
+		return rcode
+	}
+
+	q := m.Question[0]
+	if m.Rcode == dns.RcodeSuccess && len(m.Answer) > 0 {
+		return rcode + "/" + strings.ToLower(q.Name) + "/" + dns.TypeToString[q.Qtype]
+	}
+	for _, rr := range m.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return rcode + "/" + strings.ToLower(soa.Hdr.Name)
+		}
+	}
+	return rcode + "/" + strings.ToLower(q.Name)
+}
+
+// truncated builds the empty TC response sent instead of a slipped response
+func truncated(m *dns.Msg) *dns.Msg {
+	tc := new(dns.Msg)
+	tc.MsgHdr = m.MsgHdr
+	tc.Question = m.Question
+	tc.Truncated = true
+	return tc
+}
@@ -5,12 +5,13 @@ import (
 	"fmt"
 	"math/rand"
 	"net"
-	"os/exec"
-	"runtime"
-	"strings"
+	"strconv"
+	"sync"
 	"time"
 
-	"github.com/bilgehannal/reghost/internal/resolver"
+	"github.com/bilgehannal/reghost/internal/hosts"
+	"github.com/bilgehannal/reghost/internal/platform"
+	"github.com/bilgehannal/reghost/internal/sysstate"
 	"github.com/bilgehannal/reghost/internal/utils"
 	"github.com/bilgehannal/reghost/pkg/reghost"
 	"github.com/miekg/dns"
@@ -24,24 +25,90 @@ type Server struct {
 	udpServer          *dns.Server
 	tcpServer          *dns.Server
 	bindIP             string
+	port               int
 	resolverConfigured bool
-	originalResolvConf []byte            // Linux: backup of original resolv.conf
-	resolverManager    *resolver.Manager // Dynamic resolver file manager
+	fixedBindIP        string // Configured loopback IP, if any
+	bindIPFile         string // File persisting the picked loopback IP
+	aliasAdded         bool   // Set if the server added the alias of bindIP
+	hostsSync          *reghost.HostsSync
+	hostsManager       *hosts.Manager    // Managed block of the hosts file
+	platform           platform.Platform // Loopback aliases and system resolver
+	journal            *sysstate.Journal // Record of system changes to undo after a crash
+	checkInterval      time.Duration     // Interval of the resolver and hosts file checks
+	done               chan struct{}     // Closed on shutdown to stop the monitors
+	stopOnce           sync.Once
+	monitors           sync.WaitGroup
+	resolverMu         sync.Mutex // Serializes changes to the system resolver
 }
 
-// NewServer creates a new DNS server
-func NewServer(cache *Cache, logger *utils.Logger) *Server {
+// NewServer creates a new DNS server integrating with the system through p
+func NewServer(cache *Cache, logger *utils.Logger, p platform.Platform) *Server {
 	handler := NewHandler(cache, logger)
 
 	return &Server{
-		cache:   cache,
-		handler: handler,
-		logger:  logger,
+		cache:         cache,
+		handler:       handler,
+		logger:        logger,
+		port:          53,
+		platform:      p,
+		checkInterval: 30 * time.Second,
+		done:          make(chan struct{}),
 	}
 }
 
-// Start starts the DNS server
+// SetPort sets the port the server listens on. It defaults to 53, which
+// system resolvers require.
+func (s *Server) SetPort(port int) {
+	s.port = port
+}
+
+// SetCheckInterval sets how often the loopback alias, the resolver
+// configuration and the hosts file are checked and restored
+func (s *Server) SetCheckInterval(interval time.Duration) {
+	s.checkInterval = interval
+}
+
+// Configure applies daemon settings from the configuration, such as zones.
+// Hosts sync and bind IP settings only take effect on start.
+func (s *Server) Configure(cfg *reghost.Config) {
+	s.handler.Configure(cfg)
+	if s.hostsManager == nil && s.bindIP == "" {
+		s.hostsSync = cfg.HostsSync
+		s.fixedBindIP = cfg.BindIP
+	}
+}
+
+// SetBindIPFile sets the file persisting the picked loopback IP, so that it
+// is reused on the next start
+func (s *Server) SetBindIPFile(path string) {
+	s.bindIPFile = path
+}
+
+// SetJournal sets the journal recording the system changes of the server
+func (s *Server) SetJournal(journal *sysstate.Journal) {
+	s.journal = journal
+}
+
+// SetRecordStore sets the store used to persist dynamic DNS updates
+func (s *Server) SetRecordStore(store RecordStore) {
+	s.handler.SetRecordStore(store)
+}
+
+// Start starts the DNS server. In hosts sync mode, the hosts file is
+// maintained instead, and the DNS server is only started if configured too.
 func (s *Server) Start() error {
+	if s.hostsSync != nil {
+		if err := s.configureHostsFile(); err != nil {
+			return fmt.Errorf("failed to configure hosts file: %w", err)
+		}
+		s.startMonitor(s.monitorHostsFile)
+
+		if !s.hostsSync.DNS {
+			s.logger.Info("Hosts sync mode: not starting the DNS server")
+			return nil
+		}
+	}
+
 	// Find and bind to a random loopback IP
 	ip, err := s.bindLoopbackIP()
 	if err != nil {
@@ -49,7 +116,7 @@ func (s *Server) Start() error {
 	}
 	s.bindIP = ip
 
-	s.logger.Info("DNS server bound to: %s:53", s.bindIP)
+	s.logger.Info("DNS server bound to: %s:%d", s.bindIP, s.port)
 
 	// Configure system DNS resolver
 	if err := s.configureSystemResolver(); err != nil {
@@ -58,34 +125,38 @@ func (s *Server) Start() error {
 	}
 
 	// Start resolver configuration monitor
-	go s.monitorResolverConfig()
+	s.startMonitor(s.monitorResolverConfig)
 
 	// Create UDP server
 	s.udpServer = &dns.Server{
-		Addr:    net.JoinHostPort(s.bindIP, "53"),
-		Net:     "udp",
-		Handler: s.handler,
+		Addr:          net.JoinHostPort(s.bindIP, strconv.Itoa(s.port)),
+		Net:           "udp",
+		Handler:       s.handler,
+		TsigProvider:  s.handler.TsigProvider(),
+		MsgAcceptFunc: AcceptMsg,
 	}
 
 	// Create TCP server
 	s.tcpServer = &dns.Server{
-		Addr:    net.JoinHostPort(s.bindIP, "53"),
-		Net:     "tcp",
-		Handler: s.handler,
+		Addr:          net.JoinHostPort(s.bindIP, strconv.Itoa(s.port)),
+		Net:           "tcp",
+		Handler:       s.handler,
+		TsigProvider:  s.handler.TsigProvider(),
+		MsgAcceptFunc: AcceptMsg,
 	}
 
 	// Start servers in goroutines
 	errChan := make(chan error, 2)
 
 	go func() {
-		s.logger.Info("Starting UDP DNS server on %s:53", s.bindIP)
+		s.logger.Info("Starting UDP DNS server on %s:%d", s.bindIP, s.port)
 		if err := s.udpServer.ListenAndServe(); err != nil {
 			errChan <- fmt.Errorf("UDP server error: %w", err)
 		}
 	}()
 
 	go func() {
-		s.logger.Info("Starting TCP DNS server on %s:53", s.bindIP)
+		s.logger.Info("Starting TCP DNS server on %s:%d", s.bindIP, s.port)
 		if err := s.tcpServer.ListenAndServe(); err != nil {
 			errChan <- fmt.Errorf("TCP server error: %w", err)
 		}
@@ -103,13 +174,27 @@ func (s *Server) Start() error {
 // Shutdown gracefully shuts down the DNS server
 func (s *Server) Shutdown(ctx context.Context) error {
 	s.logger.Info("Shutting down DNS server...")
+	s.stopMonitors()
+
+	// Remove the managed block from the hosts file
+	if s.hostsManager != nil {
+		if err := s.hostsManager.Cleanup(); err != nil {
+			s.logger.Error("Failed to cleanup hosts file: %v", err)
+		} else {
+			s.logger.Info("✓ Removed managed block from %s", s.hostsManager.Path())
+			s.journal.RemoveHostsFile(s.hostsManager.Path())
+		}
+	}
 
 	// Cleanup system resolver configuration
+	s.resolverMu.Lock()
 	if s.resolverConfigured {
-		if err := s.cleanupSystemResolver(); err != nil {
+		if err := s.platform.CleanupResolver(); err != nil {
 			s.logger.Error("Failed to cleanup system resolver: %v", err)
 		}
+		s.resolverConfigured = false
 	}
+	s.resolverMu.Unlock()
 
 	// Shutdown servers
 	var err error
@@ -124,8 +209,8 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		}
 	}
 
-	// Release loopback IP
-	if s.bindIP != "" {
+	// Release loopback IP, unless it was bound before the server started
+	if s.bindIP != "" && s.aliasAdded {
 		if e := s.releaseLoopbackIP(s.bindIP); e != nil {
 			s.logger.Error("Failed to release loopback IP: %v", e)
 		}
@@ -134,9 +219,40 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	return err
 }
 
-// bindLoopbackIP finds and binds a random IP in 127.0.0.0/8 range
+// startMonitor runs a goroutine checking the system configuration
+func (s *Server) startMonitor(monitor func()) {
+	s.monitors.Add(1)
+	go func() {
+		defer s.monitors.Done()
+		monitor()
+	}()
+}
+
+// stopMonitors stops the goroutines checking the system configuration and
+// waits for them, so none restores what is cleaned up next
+func (s *Server) stopMonitors() {
+	s.stopOnce.Do(func() { close(s.done) })
+	s.monitors.Wait()
+}
+
+// bindLoopbackIP binds the configured loopback IP. Without one, it reuses
+// the IP of the previous run if it is still free, and otherwise picks a
+// random free IP in the 127.0.0.0/8 range and persists it.
 func (s *Server) bindLoopbackIP() (string, error) {
-	rand.Seed(time.Now().UnixNano())
+	if s.fixedBindIP != "" {
+		if err := s.claimIP(s.fixedBindIP, true); err != nil {
+			return "", fmt.Errorf("configured bind IP %s is not available: %w", s.fixedBindIP, err)
+		}
+		return s.fixedBindIP, nil
+	}
+
+	if previous := s.previousBindIP(); previous != "" {
+		err := s.claimIP(previous, false)
+		if err == nil {
+			return previous, nil
+		}
+		s.logger.Warn("Previous bind IP %s is not available: %v, picking another", previous, err)
+	}
 
 	maxAttempts := 100
 	for i := 0; i < maxAttempts; i++ {
@@ -151,94 +267,112 @@ func (s *Server) bindLoopbackIP() (string, error) {
 			continue
 		}
 
-		// Check if IP is already in use
-		if s.isIPInUse(ip) {
-			s.logger.Info("IP %s is already in use, trying another...", ip)
+		if err := s.claimIP(ip, false); err != nil {
+			s.logger.Info("IP %s is not available: %v, trying another...", ip, err)
 			continue
 		}
 
-		// Try to add the IP alias
-		if err := s.addLoopbackAlias(ip); err != nil {
-			s.logger.Warn("Failed to add IP %s: %v, trying another...", ip, err)
-			continue
+		if s.bindIPFile != "" {
+			if err := sysstate.SaveBindIP(s.bindIPFile, ip); err != nil {
+				s.logger.Warn("Failed to persist bind IP: %v", err)
+			}
 		}
-
 		return ip, nil
 	}
 
 	return "", fmt.Errorf("failed to find available loopback IP after %d attempts", maxAttempts)
 }
 
-// isIPInUse checks if an IP is already bound to loopback interface
-func (s *Server) isIPInUse(ip string) bool {
-	switch runtime.GOOS {
-	case "darwin":
-		cmd := exec.Command("ifconfig", "lo0")
-		output, err := cmd.Output()
-		if err != nil {
-			return false
-		}
-		return strings.Contains(string(output), ip)
+// previousBindIP returns the persisted loopback IP of the previous run
+func (s *Server) previousBindIP() string {
+	if s.bindIPFile == "" {
+		return ""
+	}
+	ip, err := sysstate.LoadBindIP(s.bindIPFile)
+	if err != nil {
+		s.logger.Warn("Failed to load the previous bind IP: %v", err)
+		return ""
+	}
+	if ip != "" && reghost.ValidateBindIP(ip) != nil {
+		s.logger.Warn("Ignoring invalid bind IP %s in %s", ip, s.bindIPFile)
+		return ""
+	}
+	return ip
+}
 
-	case "linux":
-		cmd := exec.Command("ip", "addr", "show", "lo")
-		output, err := cmd.Output()
-		if err != nil {
-			return false
+// claimIP adds ip as a loopback alias and checks that the DNS port is free
+// on it. An existing alias belongs to someone else and is only used if
+// shared is set, as for a configured IP.
+func (s *Server) claimIP(ip string, shared bool) error {
+	added := false
+	if s.platform.HasAlias(ip) {
+		if !shared {
+			return fmt.Errorf("already bound to the loopback interface")
 		}
-		return strings.Contains(string(output), ip)
+	} else {
+		if err := s.addLoopbackAlias(ip); err != nil {
+			return err
+		}
+		added = true
+	}
 
-	default:
-		return false
+	if err := s.checkPortFree(ip); err != nil {
+		if added {
+			if e := s.releaseLoopbackIP(ip); e != nil {
+				s.logger.Error("Failed to release loopback IP: %v", e)
+			}
+		}
+		return err
 	}
+
+	s.aliasAdded = added
+	return nil
 }
 
-// addLoopbackAlias adds an IP alias to the loopback interface
-func (s *Server) addLoopbackAlias(ip string) error {
-	switch runtime.GOOS {
-	case "darwin":
-		cmd := exec.Command("ifconfig", "lo0", "alias", ip, "up")
-		if output, err := cmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("ifconfig failed: %w (output: %s)", err, string(output))
-		}
-		s.logger.Info("Added loopback alias: %s", ip)
-		return nil
+// checkPortFree checks that the DNS port can be bound on ip over UDP and TCP
+func (s *Server) checkPortFree(ip string) error {
+	addr := net.JoinHostPort(ip, strconv.Itoa(s.port))
 
-	case "linux":
-		cmd := exec.Command("ip", "addr", "add", ip+"/8", "dev", "lo")
-		if output, err := cmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("ip addr add failed: %w (output: %s)", err, string(output))
-		}
-		s.logger.Info("Added loopback alias: %s", ip)
-		return nil
+	udp, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return fmt.Errorf("port %d is in use: %w", s.port, err)
+	}
+	udp.Close()
 
-	default:
-		return fmt.Errorf("unsupported OS: %s", runtime.GOOS)
+	tcp, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("port %d is in use: %w", s.port, err)
 	}
+	tcp.Close()
+	return nil
+}
+
+// addLoopbackAlias adds an IP alias to the loopback interface. The alias is
+// recorded first, so that it is removed after a crash.
+func (s *Server) addLoopbackAlias(ip string) error {
+	if err := s.journal.AddLoopbackAlias(ip); err != nil {
+		return err
+	}
+	if err := s.platform.AddAlias(ip); err != nil {
+		s.journal.RemoveLoopbackAlias(ip)
+		return err
+	}
+	s.logger.Info("Added loopback alias: %s", ip)
+	return nil
 }
 
 // releaseLoopbackIP removes the IP alias from the loopback interface
 func (s *Server) releaseLoopbackIP(ip string) error {
-	switch runtime.GOOS {
-	case "darwin":
-		cmd := exec.Command("ifconfig", "lo0", "-alias", ip)
-		if output, err := cmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("ifconfig failed: %w (output: %s)", err, string(output))
-		}
-		s.logger.Info("Released loopback alias: %s", ip)
-		return nil
-
-	case "linux":
-		cmd := exec.Command("ip", "addr", "del", ip+"/8", "dev", "lo")
-		if output, err := cmd.CombinedOutput(); err != nil {
-			return fmt.Errorf("ip addr del failed: %w (output: %s)", err, string(output))
-		}
-		s.logger.Info("Released loopback alias: %s", ip)
-		return nil
-
-	default:
-		return fmt.Errorf("unsupported OS: %s", runtime.GOOS)
+	if err := s.platform.RemoveAlias(ip); err != nil {
+		return err
 	}
+	s.logger.Info("Released loopback alias: %s", ip)
+	return s.journal.RemoveLoopbackAlias(ip)
+}
+
+// Metrics returns the request counters
+func (s *Server) Metrics() *Metrics {
+	return s.handler.Metrics()
 }
 
 // GetBindIP returns the IP address the server is bound to
@@ -246,213 +380,135 @@ func (s *Server) GetBindIP() string {
 	return s.bindIP
 }
 
-// UpdateResolverFiles updates the resolver files based on new records
+// UpdateResolverFiles reconfigures the system resolver for new records and
+// flushes its cache, so stale answers are not served
 func (s *Server) UpdateResolverFiles(records []reghost.Record) error {
-	if runtime.GOOS != "darwin" {
-		// Only supported on macOS
-		return nil
-	}
+	s.resolverMu.Lock()
+	defer s.resolverMu.Unlock()
 
-	if s.resolverManager == nil {
-		s.resolverManager = resolver.NewManager(s.bindIP, s.logger)
+	if !s.resolverConfigured {
+		return nil
 	}
-
-	return s.resolverManager.UpdateResolverFiles(records)
-}
-
-// configureSystemResolver configures the system DNS resolver
-func (s *Server) configureSystemResolver() error {
-	switch runtime.GOOS {
-	case "darwin":
-		return s.configureMacOSResolver()
-	case "linux":
-		return s.configureLinuxResolver()
-	default:
-		return fmt.Errorf("unsupported OS: %s", runtime.GOOS)
+	if err := s.platform.ConfigureResolver(s.bindIP, records); err != nil {
+		return err
 	}
+	return s.platform.FlushCache()
 }
 
-// configureMacOSResolver creates dynamic /etc/resolver files based on active records
-func (s *Server) configureMacOSResolver() error {
-	s.logger.Info("Configuring macOS resolver with dynamic domain-based files...")
+// UpdateLayer replaces the records of a runtime layer, such as those of a
+// provider, and updates the system resolver and the hosts file for them
+func (s *Server) UpdateLayer(name string, rank int, records []reghost.Record) {
+	s.cache.SetLayer(name, rank, records)
 
-	// Create resolver manager if not exists
-	if s.resolverManager == nil {
-		s.resolverManager = resolver.NewManager(s.bindIP, s.logger)
+	all := s.cache.GetRecords()
+	if err := s.UpdateResolverFiles(all); err != nil {
+		s.logger.Warn("Failed to update resolver files: %v", err)
 	}
-
-	// Get active records from cache
-	records := s.cache.GetRecords()
-
-	// Update resolver files based on active records
-	if err := s.resolverManager.UpdateResolverFiles(records); err != nil {
-		return fmt.Errorf("failed to update resolver files: %w", err)
+	if err := s.UpdateHostsFile(all); err != nil {
+		s.logger.Warn("Failed to update hosts file: %v", err)
 	}
+}
 
-	s.resolverConfigured = true
-	s.logger.Info("✓ DNS resolver configured - queries will be matched against your regex patterns")
-	s.logger.Info("Managed domains: %v", s.resolverManager.GetManagedDomains())
-
-	return nil
-} // configureLinuxResolver adds nameserver to /etc/resolv.conf on Linux
-func (s *Server) configureLinuxResolver() error {
-	resolvConfFile := "/etc/resolv.conf"
-
-	// Read and backup original resolv.conf
-	content, err := exec.Command("cat", resolvConfFile).Output()
-	if err != nil {
-		return fmt.Errorf("failed to read %s: %w", resolvConfFile, err)
+// UpdateHostsFile updates the managed block of the hosts file based on new
+// records
+func (s *Server) UpdateHostsFile(records []reghost.Record) error {
+	if s.hostsManager == nil {
+		return nil
 	}
-	s.originalResolvConf = content
-
-	s.logger.Info("Configuring Linux resolver to use %s", s.bindIP)
-
-	lines := strings.Split(string(content), "\n")
-	nameserverEntry := fmt.Sprintf("nameserver %s", s.bindIP)
+	return s.hostsManager.Update(records)
+}
 
-	// Check if already configured
-	for _, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		if trimmed == nameserverEntry {
-			s.logger.Info("✓ %s already configured in %s", s.bindIP, resolvConfFile)
-			s.resolverConfigured = true
-			return nil
-		}
+// configureHostsFile writes the active records to the managed block of the
+// hosts file
+func (s *Server) configureHostsFile() error {
+	s.hostsManager = hosts.NewManager(s.hostsSync.HostsPath(), s.logger)
+	if err := s.journal.AddHostsFile(s.hostsManager.Path()); err != nil {
+		return err
 	}
 
-	// Build new content with our nameserver first
-	var newLines []string
-	newLines = append(newLines, nameserverEntry)
-	newLines = append(newLines, lines...)
-
-	newContent := strings.Join(newLines, "\n")
-
-	// Write new config
-	cmd := exec.Command("tee", resolvConfFile)
-	cmd.Stdin = strings.NewReader(newContent)
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to write %s: %w (output: %s)", resolvConfFile, err, string(output))
+	records := s.cache.GetRecords()
+	if err := s.hostsManager.Update(records); err != nil {
+		return err
 	}
 
-	s.logger.Info("✓ Updated %s - %s is now first nameserver", resolvConfFile, s.bindIP)
-	s.resolverConfigured = true
-
+	s.logger.Info("✓ Hosts sync: %d record(s) written to %s", len(hosts.Entries(records)), s.hostsManager.Path())
 	return nil
 }
 
-// cleanupSystemResolver removes DNS resolver configuration
-func (s *Server) cleanupSystemResolver() error {
-	switch runtime.GOOS {
-	case "darwin":
-		return s.cleanupMacOSResolver()
-	case "linux":
-		return s.cleanupLinuxResolver()
-	default:
-		return fmt.Errorf("unsupported OS: %s", runtime.GOOS)
-	}
-}
-
-// cleanupMacOSResolver removes all managed resolver files on macOS
-func (s *Server) cleanupMacOSResolver() error {
-	if s.resolverManager == nil {
-		return nil
-	}
+// monitorHostsFile periodically checks that the managed block of the hosts
+// file is intact and restores it if it gets changed or removed
+func (s *Server) monitorHostsFile() {
+	ticker := time.NewTicker(s.checkInterval)
+	defer ticker.Stop()
 
-	s.logger.Info("Removing all managed macOS resolver configs...")
-	return s.resolverManager.CleanupAll()
-}
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
 
-// cleanupLinuxResolver restores original /etc/resolv.conf on Linux
-func (s *Server) cleanupLinuxResolver() error {
-	if s.originalResolvConf == nil {
-		return nil
+		restored, err := s.hostsManager.Sync()
+		if err != nil {
+			s.logger.Error("Failed to restore %s: %v", s.hostsManager.Path(), err)
+		} else if restored {
+			s.logger.Warn("⚠ Managed block of %s was changed, restored", s.hostsManager.Path())
+		}
 	}
+}
 
-	resolvConfFile := "/etc/resolv.conf"
-	s.logger.Info("Restoring original %s", resolvConfFile)
-
-	// Write back original content
-	cmd := exec.Command("tee", resolvConfFile)
-	cmd.Stdin = strings.NewReader(string(s.originalResolvConf))
-	if output, err := cmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("failed to restore %s: %w (output: %s)", resolvConfFile, err, string(output))
+// configureSystemResolver points the system resolver at the DNS server
+func (s *Server) configureSystemResolver() error {
+	s.logger.Info("Configuring %s resolver to use %s...", s.platform.Name(), s.bindIP)
+	if err := s.platform.ConfigureResolver(s.bindIP, s.cache.GetRecords()); err != nil {
+		return err
 	}
 
-	s.logger.Info("✓ Restored original %s", resolvConfFile)
-
+	s.resolverConfigured = true
+	s.logger.Info("✓ DNS resolver configured - queries will be matched against your regex patterns")
 	return nil
 }
 
-// monitorResolverConfig periodically checks if resolver configuration is intact
-// and restores it if it gets changed or deleted (e.g., by VPN changes)
+// monitorResolverConfig periodically checks if the loopback alias and the
+// resolver configuration are intact and restores them if they get changed or
+// deleted (e.g., by VPN changes)
 func (s *Server) monitorResolverConfig() {
-	ticker := time.NewTicker(30 * time.Second) // Check every 30 seconds
+	ticker := time.NewTicker(s.checkInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		if !s.resolverConfigured {
-			continue
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
 		}
 
-		switch runtime.GOOS {
-		case "darwin":
-			s.checkAndRestoreMacOSResolver()
-		case "linux":
-			s.checkAndRestoreLinuxResolver()
-		}
+		s.checkAndRestoreResolver()
 	}
 }
 
-// checkAndRestoreMacOSResolver checks if resolver files exist and restores them if needed
-func (s *Server) checkAndRestoreMacOSResolver() {
-	if s.resolverManager == nil {
-		return
-	}
+// checkAndRestoreResolver restores the loopback alias and the resolver
+// configuration if either was lost
+func (s *Server) checkAndRestoreResolver() {
+	s.resolverMu.Lock()
+	defer s.resolverMu.Unlock()
 
-	// Get current active records and update resolver files
-	records := s.cache.GetRecords()
-	if err := s.resolverManager.UpdateResolverFiles(records); err != nil {
-		s.logger.Error("Failed to restore macOS resolver: %v", err)
+	if !s.resolverConfigured {
+		return
 	}
-}
 
-// checkAndRestoreLinuxResolver checks if /etc/resolv.conf still has our nameserver
-func (s *Server) checkAndRestoreLinuxResolver() {
-	resolvConfFile := "/etc/resolv.conf"
-
-	content, err := exec.Command("cat", resolvConfFile).Output()
-	if err != nil {
-		s.logger.Error("Failed to read %s: %v", resolvConfFile, err)
+	err := s.platform.Check(s.bindIP)
+	if err == nil {
 		return
 	}
+	s.logger.Warn("⚠ %v, restoring", err)
 
-	nameserverEntry := fmt.Sprintf("nameserver %s", s.bindIP)
-
-	// Check if our nameserver is still present
-	lines := strings.Split(string(content), "\n")
-	found := false
-	for _, line := range lines {
-		if strings.TrimSpace(line) == nameserverEntry {
-			found = true
-			break
+	if !s.platform.HasAlias(s.bindIP) {
+		if err := s.platform.AddAlias(s.bindIP); err != nil {
+			s.logger.Error("Failed to restore loopback alias %s: %v", s.bindIP, err)
 		}
 	}
-
-	if !found {
-		s.logger.Warn("⚠ Nameserver %s removed from %s, restoring...", s.bindIP, resolvConfFile)
-
-		// Re-add our nameserver at the top
-		var newLines []string
-		newLines = append(newLines, nameserverEntry)
-		newLines = append(newLines, lines...)
-		newContent := strings.Join(newLines, "\n")
-
-		cmd := exec.Command("tee", resolvConfFile)
-		cmd.Stdin = strings.NewReader(newContent)
-		if output, err := cmd.CombinedOutput(); err != nil {
-			s.logger.Error("Failed to restore %s: %v (output: %s)", resolvConfFile, err, string(output))
-		} else {
-			s.logger.Info("✓ Restored nameserver in %s", resolvConfFile)
-		}
+	if err := s.platform.ConfigureResolver(s.bindIP, s.cache.GetRecords()); err != nil {
+		s.logger.Error("Failed to restore %s resolver: %v", s.platform.Name(), err)
 	}
 }
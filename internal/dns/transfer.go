@@ -0,0 +1,138 @@
+package dns
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/bilgehannal/reghost/pkg/reghost"
+	"github.com/miekg/dns"
+)
+
+const (
+	// transferChunkSize is the number of records sent per transfer message
+	transferChunkSize = 100
+)
+
+// serveTransfer answers AXFR and IXFR requests for a configured zone. The
+// zone content is the enumerable part of the active record set, and the
+// serial is the reload generation unless the config pins one.
+func (h *Handler) serveTransfer(w dns.ResponseWriter, r *dns.Msg, zones []reghost.Zone) {
+	q := r.Question[0]
+	qname := strings.ToLower(q.Name)
+	qtype := dns.TypeToString[q.Qtype]
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	zone := reghost.FindZone(zones, qname)
+	if zone == nil || zone.Origin() != qname {
+		h.logger.Warn("%s request for %s which is not a zone apex", qtype, qname)
+		m.SetRcode(r, dns.RcodeNotAuth)
+		h.writeMsg(w, m)
+		return
+	}
+
+	if r.IsTsig() != nil && w.TsigStatus() != nil {
+		h.logger.Warn("%s request for %s from %s has a bad TSIG: %v", qtype, qname, w.RemoteAddr(), w.TsigStatus())
+		m.SetRcode(r, dns.RcodeNotAuth)
+		h.writeMsg(w, m)
+		return
+	}
+
+	if !h.transferAllowed(w, r) {
+		h.logger.Warn("%s request for %s from %s refused", qtype, qname, w.RemoteAddr())
+		m.SetRcode(r, dns.RcodeRefused)
+		h.writeSigned(w, r, m)
+		return
+	}
+
+	_, overTCP := w.RemoteAddr().(*net.TCPAddr)
+	soa := h.zoneSOA(zone, zone.RecordTTL())
+
+	// AXFR is only defined over TCP
+	if q.Qtype == dns.TypeAXFR && !overTCP {
+		m.SetRcode(r, dns.RcodeRefused)
+		h.writeSigned(w, r, m)
+		return
+	}
+
+	// An up-to-date IXFR client, or any IXFR over UDP, gets the current SOA
+	// only; the latter tells the client to retry over TCP (RFC 1995 section 2)
+	if q.Qtype == dns.TypeIXFR && (ixfrUpToDate(r, soa.Serial) || !overTCP) {
+		m.Authoritative = true
+		m.Answer = []dns.RR{soa}
+		h.writeSigned(w, r, m)
+		return
+	}
+
+	// Everything else gets the full zone, which is also a valid IXFR reply
+	rrs := h.zoneContent(zone, soa)
+	ch := make(chan *dns.Envelope, len(rrs)/transferChunkSize+1)
+	for start := 0; start < len(rrs); start += transferChunkSize {
+		end := start + transferChunkSize
+		if end > len(rrs) {
+			end = len(rrs)
+		}
+		ch <- &dns.Envelope{RR: rrs[start:end]}
+	}
+	close(ch)
+
+	h.logger.Info("Serving %s of %s to %s (%d records, serial %d)", qtype, qname, w.RemoteAddr(), len(rrs), soa.Serial)
+	if err := new(dns.Transfer).Out(w, r, ch); err != nil {
+		h.logger.Error("Error writing %s of %s: %v", qtype, qname, err)
+	}
+}
+
+// zoneContent returns the records of a zone framed by its SOA
+func (h *Handler) zoneContent(zone *reghost.Zone, soa *dns.SOA) []dns.RR {
+	h.mu.RLock()
+	samples := h.samples
+	h.mu.RUnlock()
+
+	rrs := []dns.RR{soa}
+	rrs = append(rrs, zoneNS(zone)...)
+	for _, record := range h.cache.Enumerate(samples) {
+		if !zone.Contains(record.Domain) {
+			continue
+		}
+		rrs = append(rrs, newA(record.Domain, record.IP, zone.RecordTTL()))
+	}
+	return append(rrs, soa)
+}
+
+// transferAllowed checks the client against the transfer allowlist and keys
+func (h *Handler) transferAllowed(w dns.ResponseWriter, r *dns.Msg) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if h.transfer == nil {
+		return false
+	}
+
+	if key := tsigKeyName(w, r); key != "" && h.transfer.HasKey(key) {
+		return true
+	}
+
+	addr, ok := clientAddr(w)
+	return ok && reghost.ContainsAddr(h.transferNets, addr)
+}
+
+// ixfrUpToDate reports whether the serial in an IXFR request is current
+func ixfrUpToDate(r *dns.Msg, serial uint32) bool {
+	for _, rr := range r.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			// Serial number arithmetic (RFC 1982)
+			return int32(serial-soa.Serial) <= 0
+		}
+	}
+	return false
+}
+
+// writeSigned writes a reply, signing it when the request was validly signed
+func (h *Handler) writeSigned(w dns.ResponseWriter, r *dns.Msg, m *dns.Msg) {
+	if t := r.IsTsig(); t != nil && w.TsigStatus() == nil {
+		m.SetTsig(t.Hdr.Name, t.Algorithm, t.Fudge, time.Now().Unix())
+	}
+	h.writeMsg(w, m)
+}
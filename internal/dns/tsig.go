@@ -0,0 +1,102 @@
+package dns
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"sync"
+
+	"github.com/bilgehannal/reghost/pkg/reghost"
+	"github.com/miekg/dns"
+)
+
+// keyring is a dns.TsigProvider backed by the TSIG keys of the configuration.
+// Keys can be replaced on reload while the servers keep running.
+type keyring struct {
+	mu   sync.RWMutex
+	keys map[string]reghost.TSIGKey
+}
+
+// newKeyring creates an empty keyring
+func newKeyring() *keyring {
+	return &keyring{keys: make(map[string]reghost.TSIGKey)}
+}
+
+// Update replaces the keys in the keyring
+func (k *keyring) Update(keys []reghost.TSIGKey) {
+	byName := make(map[string]reghost.TSIGKey, len(keys))
+	for _, key := range keys {
+		byName[key.KeyName()] = key
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys = byName
+}
+
+// Generate implements dns.TsigProvider
+func (k *keyring) Generate(msg []byte, t *dns.TSIG) ([]byte, error) {
+	k.mu.RLock()
+	key, ok := k.keys[dns.CanonicalName(t.Hdr.Name)]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, dns.ErrSecret
+	}
+	if dns.CanonicalName(t.Algorithm) != key.AlgorithmName() {
+		return nil, dns.ErrKeyAlg
+	}
+
+	secret, err := base64.StdEncoding.DecodeString(key.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	var h hash.Hash
+	switch key.AlgorithmName() {
+	case dns.HmacSHA1:
+		h = hmac.New(sha1.New, secret)
+	case dns.HmacSHA224:
+		h = hmac.New(sha256.New224, secret)
+	case dns.HmacSHA256:
+		h = hmac.New(sha256.New, secret)
+	case dns.HmacSHA384:
+		h = hmac.New(sha512.New384, secret)
+	case dns.HmacSHA512:
+		h = hmac.New(sha512.New, secret)
+	default:
+		return nil, dns.ErrKeyAlg
+	}
+	h.Write(msg)
+	return h.Sum(nil), nil
+}
+
+// Verify implements dns.TsigProvider
+func (k *keyring) Verify(msg []byte, t *dns.TSIG) error {
+	expected, err := k.Generate(msg, t)
+	if err != nil {
+		return err
+	}
+	mac, err := hex.DecodeString(t.MAC)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(expected, mac) {
+		return dns.ErrSig
+	}
+	return nil
+}
+
+// tsigKeyName returns the name of the key that validly signed the request,
+// or an empty string when the request is unsigned or the signature is bad
+func tsigKeyName(w dns.ResponseWriter, r *dns.Msg) string {
+	t := r.IsTsig()
+	if t == nil || w.TsigStatus() != nil {
+		return ""
+	}
+	return dns.CanonicalName(t.Hdr.Name)
+}
@@ -0,0 +1,247 @@
+package dns
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/bilgehannal/reghost/internal/config"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+	"github.com/miekg/dns"
+)
+
+const (
+	// updateLayer is the cache layer holding ephemeral dynamic update records
+	updateLayer = "update"
+)
+
+// errUpdateRejected aborts a persisted update that failed its checks
+var errUpdateRejected = errors.New("update rejected")
+
+// RecordStore persists record sets changed by dynamic updates. A change
+// that leaves the config invalid fails with config.ErrInvalidConfig.
+type RecordStore interface {
+	ModifyRecordSet(name string, modify func([]reghost.Record) ([]reghost.Record, error)) error
+}
+
+// AcceptMsg extends dns.DefaultMsgAcceptFunc to accept UPDATE messages,
+// which the default rejects because they carry records in every section
+func AcceptMsg(dh dns.Header) dns.MsgAcceptAction {
+	const qrBit = 1 << 15
+	opcode := int(dh.Bits>>11) & 0xF
+	if dh.Bits&qrBit == 0 && opcode == dns.OpcodeUpdate {
+		if dh.Qdcount != 1 {
+			return dns.MsgReject
+		}
+		return dns.MsgAccept
+	}
+	return dns.DefaultMsgAcceptFunc(dh)
+}
+
+// SetRecordStore sets the store used for persisted dynamic updates
+func (h *Handler) SetRecordStore(store RecordStore) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.store = store
+}
+
+// serveUpdate handles an RFC 2136 UPDATE message. Updates must be signed
+// with a TSIG key accepted by the update policy.
+func (h *Handler) serveUpdate(w dns.ResponseWriter, r *dns.Msg, zones []reghost.Zone) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	h.mu.RLock()
+	policy := h.update
+	store := h.store
+	h.mu.RUnlock()
+
+	rcode := h.processUpdate(w, r, zones, policy, store)
+	m.SetRcode(r, rcode)
+	h.writeSigned(w, r, m)
+}
+
+// processUpdate validates and applies an UPDATE message and returns the rcode
+func (h *Handler) processUpdate(w dns.ResponseWriter, r *dns.Msg, zones []reghost.Zone, policy *reghost.Update, store RecordStore) int {
+	if len(r.Question) != 1 {
+		return dns.RcodeFormatError
+	}
+	zname := strings.ToLower(r.Question[0].Name)
+
+	if policy == nil {
+		h.logger.Warn("UPDATE for %s from %s refused: updates are disabled", zname, w.RemoteAddr())
+		return dns.RcodeRefused
+	}
+
+	key := tsigKeyName(w, r)
+	if key == "" || !policy.HasKey(key) {
+		h.logger.Warn("UPDATE for %s from %s refused: missing or invalid TSIG", zname, w.RemoteAddr())
+		return dns.RcodeNotAuth
+	}
+
+	zone := reghost.FindZone(zones, zname)
+	if zone == nil || zone.Origin() != zname {
+		return dns.RcodeNotAuth
+	}
+
+	// check evaluates the prerequisites against the records resolved by
+	// lookup, then prescans the update section
+	check := func(lookup func(string) (string, bool)) int {
+		if rcode := checkPrerequisites(zone, r.Answer, lookup); rcode != dns.RcodeSuccess {
+			h.logger.Info("UPDATE for %s: prerequisite failed (%s)", zname, dns.RcodeToString[rcode])
+			return rcode
+		}
+		return prescanUpdates(zone, r.Ns)
+	}
+
+	h.updateMu.Lock()
+	defer h.updateMu.Unlock()
+
+	if policy.Persist {
+		if store == nil {
+			h.logger.Error("UPDATE for %s: no record store configured", zname)
+			return dns.RcodeServerFailure
+		}
+
+		// Prerequisites are checked against the persisted set, which the
+		// served records only catch up with on the next config reload
+		rcode := dns.RcodeSuccess
+		applied := false
+		err := store.ModifyRecordSet(policy.RecordSet, func(records []reghost.Record) ([]reghost.Record, error) {
+			if rcode = check(reghost.NewResolver(records).Resolve); rcode != dns.RcodeSuccess {
+				return nil, errUpdateRejected
+			}
+			applied = true
+			return applyUpdates(records, r.Ns), nil
+		})
+		if rcode != dns.RcodeSuccess {
+			return rcode
+		}
+		// A config that loaded but is invalid after the change, e.g. with
+		// the active record set emptied, is refused like any other policy
+		if applied && errors.Is(err, config.ErrInvalidConfig) {
+			h.logger.Warn("UPDATE for %s refused: %v", zname, err)
+			return dns.RcodeRefused
+		}
+		if err != nil {
+			h.logger.Error("UPDATE for %s: failed to persist record set '%s': %v", zname, policy.RecordSet, err)
+			return dns.RcodeServerFailure
+		}
+	} else {
+		if rcode := check(h.cache.Lookup); rcode != dns.RcodeSuccess {
+			return rcode
+		}
+		h.cache.SetLayer(updateLayer, UpdateRank, applyUpdates(h.cache.Layer(updateLayer), r.Ns))
+	}
+
+	h.logger.Info("UPDATE for %s applied (%d change(s), key %s)", zname, len(r.Ns), key)
+	return dns.RcodeSuccess
+}
+
+// checkPrerequisites evaluates the prerequisite section (RFC 2136 section 3.2)
+// against the records resolved by lookup
+func checkPrerequisites(zone *reghost.Zone, prereqs []dns.RR, lookup func(string) (string, bool)) int {
+	for _, rr := range prereqs {
+		hdr := rr.Header()
+		if !zone.Contains(hdr.Name) {
+			return dns.RcodeNotZone
+		}
+
+		ip, found := lookup(hdr.Name)
+		apex := reghost.Fqdn(hdr.Name) == zone.Origin()
+		exists := rrsetExists(hdr.Rrtype, found, apex)
+
+		switch hdr.Class {
+		case dns.ClassANY:
+			if hdr.Ttl != 0 {
+				return dns.RcodeFormatError
+			}
+			if hdr.Rrtype == dns.TypeANY && !found && !apex {
+				return dns.RcodeNameError
+			}
+			if hdr.Rrtype != dns.TypeANY && !exists {
+				return dns.RcodeNXRrset
+			}
+		case dns.ClassNONE:
+			if hdr.Ttl != 0 {
+				return dns.RcodeFormatError
+			}
+			if hdr.Rrtype == dns.TypeANY && (found || apex) {
+				return dns.RcodeYXDomain
+			}
+			if hdr.Rrtype != dns.TypeANY && exists {
+				return dns.RcodeYXRrset
+			}
+		case dns.ClassINET:
+			// Value dependent: only A rrsets can be compared
+			a, ok := rr.(*dns.A)
+			if !ok || !found || a.A.String() != ip {
+				return dns.RcodeNXRrset
+			}
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// rrsetExists reports whether an rrset of the type exists at a name
+func rrsetExists(rrtype uint16, found, apex bool) bool {
+	switch rrtype {
+	case dns.TypeA:
+		return found
+	case dns.TypeSOA, dns.TypeNS:
+		return apex
+	default:
+		return false
+	}
+}
+
+// prescanUpdates checks the update section before anything is applied
+// (RFC 2136 section 3.4.1). Only A records can be added.
+func prescanUpdates(zone *reghost.Zone, updates []dns.RR) int {
+	for _, rr := range updates {
+		hdr := rr.Header()
+		if !zone.Contains(hdr.Name) {
+			return dns.RcodeNotZone
+		}
+
+		switch hdr.Class {
+		case dns.ClassINET:
+			if _, ok := rr.(*dns.A); !ok {
+				return dns.RcodeRefused
+			}
+		case dns.ClassANY, dns.ClassNONE:
+			if hdr.Ttl != 0 {
+				return dns.RcodeFormatError
+			}
+		default:
+			return dns.RcodeFormatError
+		}
+	}
+	return dns.RcodeSuccess
+}
+
+// applyUpdates applies the update section to a record list. reghost keeps a
+// single address per name, so adding an A record replaces earlier addresses.
+func applyUpdates(records []reghost.Record, updates []dns.RR) []reghost.Record {
+	for _, rr := range updates {
+		hdr := rr.Header()
+		domain := strings.TrimSuffix(strings.ToLower(hdr.Name), ".")
+
+		switch hdr.Class {
+		case dns.ClassINET:
+			a := rr.(*dns.A)
+			records = reghost.UpsertRecord(records, reghost.Record{Domain: domain, IP: a.A.String()})
+		case dns.ClassANY:
+			if hdr.Rrtype == dns.TypeA || hdr.Rrtype == dns.TypeANY {
+				records = reghost.RemoveRecords(records, domain, "")
+			}
+		case dns.ClassNONE:
+			if a, ok := rr.(*dns.A); ok && a.A != nil {
+				records = reghost.RemoveRecords(records, domain, a.A.String())
+			}
+		}
+	}
+	return records
+}
@@ -0,0 +1,190 @@
+package dns
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	"github.com/bilgehannal/reghost/pkg/reghost"
+	"github.com/miekg/dns"
+)
+
+const (
+	// forwardTimeout bounds a single exchange with a forwarder
+	forwardTimeout = 2 * time.Second
+)
+
+// authoritativeReply answers a request with zone semantics: answers inside a
+// zone carry the AA bit and negative answers carry the zone SOA
+func (h *Handler) authoritativeReply(r *dns.Msg, zones []reghost.Zone) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	if len(r.Question) != 1 {
+		m.SetRcode(r, dns.RcodeFormatError)
+		return m
+	}
+
+	q := r.Question[0]
+	qname := strings.ToLower(q.Name)
+
+	h.logger.Info("DNS Query: %s (type: %s)", qname, dns.TypeToString[q.Qtype])
+
+	zone := reghost.FindZone(zones, qname)
+	if zone == nil {
+		return h.outOfZoneReply(r)
+	}
+
+	m.Authoritative = true
+	apex := qname == zone.Origin()
+	ip, found := h.cache.Lookup(qname)
+	keys := h.zoneKeys(zone)
+
+	switch {
+	case apex && keys != nil && h.dnssecAnswer(m, q, zone, keys):
+		// DNSKEY, DS or NSEC3PARAM query at the apex of a signed zone
+	case apex && q.Qtype == dns.TypeSOA:
+		m.Answer = append(m.Answer, h.zoneSOA(zone, zone.RecordTTL()))
+	case apex && q.Qtype == dns.TypeNS:
+		m.Answer = append(m.Answer, zoneNS(zone)...)
+		m.Extra = append(m.Extra, h.zoneGlue(zone)...)
+	case found && (q.Qtype == dns.TypeA || q.Qtype == dns.TypeANY):
+		h.logger.Info("Match found: %s -> %s (zone %s)", qname, ip, zone.Origin())
+		m.Answer = append(m.Answer, newA(q.Name, ip, zone.RecordTTL()))
+	case found || apex:
+		h.logger.Info("No %s data for: %s - returning NODATA", dns.TypeToString[q.Qtype], qname)
+		m.Ns = append(m.Ns, h.zoneSOA(zone, zone.NegativeTTL()))
+	default:
+		h.logger.Info("No match for: %s - returning NXDOMAIN (zone %s)", qname, zone.Origin())
+		m.SetRcode(r, dns.RcodeNameError)
+		m.Ns = append(m.Ns, h.zoneSOA(zone, zone.NegativeTTL()))
+	}
+
+	if keys != nil && wantsDNSSEC(r) {
+		if err := h.signReply(m, qname, zone, keys); err != nil {
+			h.logger.Error("Failed to sign reply for %s: %v", qname, err)
+			m = new(dns.Msg)
+			m.SetRcode(r, dns.RcodeServerFailure)
+		}
+	}
+
+	return m
+}
+
+// outOfZoneReply answers a request for a name outside every configured zone.
+// Names matched by the active records are still answered (without the AA
+// bit); everything else is refused or forwarded depending on the policy.
+func (h *Handler) outOfZoneReply(r *dns.Msg) *dns.Msg {
+	q := r.Question[0]
+	if _, found := h.cache.Lookup(q.Name); found {
+		return h.reply(r)
+	}
+
+	h.mu.RLock()
+	policy := h.outOfZone
+	forwarders := h.forwarders
+	h.mu.RUnlock()
+
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	if policy == reghost.OutOfZoneForward {
+		resp, err := h.forward(r, forwarders)
+		if err == nil {
+			return resp
+		}
+		h.logger.Warn("Failed to forward %s: %v", q.Name, err)
+		m.SetRcode(r, dns.RcodeServerFailure)
+		return m
+	}
+
+	h.logger.Info("%s is outside all zones - returning REFUSED", strings.ToLower(q.Name))
+	m.SetRcode(r, dns.RcodeRefused)
+	return m
+}
+
+// forward relays a request to the first forwarder that answers
+func (h *Handler) forward(r *dns.Msg, forwarders []string) (*dns.Msg, error) {
+	client := &dns.Client{Timeout: forwardTimeout}
+
+	var lastErr error
+	for _, forwarder := range forwarders {
+		addr := forwarder
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "53")
+		}
+
+		resp, _, err := client.Exchange(r, addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return resp, nil
+	}
+
+	return nil, lastErr
+}
+
+// zoneSOA builds the SOA record of a zone. A zero serial in the config means
+// the reload generation is used, so the serial changes on every reload.
+func (h *Handler) zoneSOA(zone *reghost.Zone, ttl uint32) *dns.SOA {
+	serial := zone.SOA.Serial
+	if serial == 0 {
+		serial = h.cache.Generation()
+	}
+
+	return &dns.SOA{
+		Hdr: dns.RR_Header{
+			Name:   zone.Origin(),
+			Rrtype: dns.TypeSOA,
+			Class:  dns.ClassINET,
+			Ttl:    ttl,
+		},
+		Ns:      dns.Fqdn(zone.SOA.MName),
+		Mbox:    dns.Fqdn(strings.Replace(zone.SOA.RName, "@", ".", 1)),
+		Serial:  serial,
+		Refresh: orDefault(zone.SOA.Refresh, reghost.DefaultSOARefresh),
+		Retry:   orDefault(zone.SOA.Retry, reghost.DefaultSOARetry),
+		Expire:  orDefault(zone.SOA.Expire, reghost.DefaultSOAExpire),
+		Minttl:  orDefault(zone.SOA.Minimum, reghost.DefaultSOAMinimum),
+	}
+}
+
+// zoneNS builds the NS records of a zone apex
+func zoneNS(zone *reghost.Zone) []dns.RR {
+	records := make([]dns.RR, 0, len(zone.NS))
+	for _, ns := range zone.NS {
+		records = append(records, &dns.NS{
+			Hdr: dns.RR_Header{
+				Name:   zone.Origin(),
+				Rrtype: dns.TypeNS,
+				Class:  dns.ClassINET,
+				Ttl:    zone.RecordTTL(),
+			},
+			Ns: dns.Fqdn(ns),
+		})
+	}
+	return records
+}
+
+// zoneGlue returns A records for name servers that live inside the zone
+func (h *Handler) zoneGlue(zone *reghost.Zone) []dns.RR {
+	var glue []dns.RR
+	for _, ns := range zone.NS {
+		if !zone.Contains(ns) {
+			continue
+		}
+		if ip, found := h.cache.Lookup(ns); found {
+			glue = append(glue, newA(dns.Fqdn(ns), ip, zone.RecordTTL()))
+		}
+	}
+	return glue
+}
+
+// orDefault returns value, or fallback when value is zero
+func orDefault(value, fallback uint32) uint32 {
+	if value == 0 {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,192 @@
+package dnssec
+
+import (
+	"crypto"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bilgehannal/reghost/pkg/reghost"
+	"github.com/miekg/dns"
+)
+
+// DNSKEY flags
+const (
+	zskFlags = 256
+	kskFlags = 257
+)
+
+// ZoneKeys holds the key signing and zone signing keys of a zone
+type ZoneKeys struct {
+	Zone string
+	KSK  *dns.DNSKEY
+	ZSK  *dns.DNSKEY
+
+	kskSigner crypto.Signer
+	zskSigner crypto.Signer
+}
+
+// LoadOrGenerate loads the keys of a zone from the key directory, generating
+// and storing a new KSK/ZSK pair when none exist yet
+func LoadOrGenerate(settings *reghost.DNSSEC, zone string) (*ZoneKeys, error) {
+	return loadZoneKeys(settings, zone, true)
+}
+
+// Load loads the keys of a zone from the key directory. It returns an
+// ErrNotFound if the zone has no keys yet.
+func Load(settings *reghost.DNSSEC, zone string) (*ZoneKeys, error) {
+	return loadZoneKeys(settings, zone, false)
+}
+
+// loadZoneKeys loads the KSK and ZSK of a zone, generating missing ones if
+// generate is set
+func loadZoneKeys(settings *reghost.DNSSEC, zone string, generate bool) (*ZoneKeys, error) {
+	zone = reghost.Fqdn(zone)
+	algorithm, ok := dns.StringToAlgorithm[settings.AlgorithmName()]
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm '%s'", settings.AlgorithmName())
+	}
+
+	dir := filepath.Join(settings.KeyDirectory(), strings.TrimSuffix(zone, "."))
+	if generate {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create key directory: %w", err)
+		}
+	}
+
+	keys := &ZoneKeys{Zone: zone}
+	for _, flags := range []uint16{kskFlags, zskFlags} {
+		key, signer, err := loadKey(dir, zone, algorithm, flags)
+		if err != nil {
+			return nil, err
+		}
+		if key == nil {
+			if !generate {
+				return nil, reghost.NotFound("no keys for zone %s in %s", zone, dir)
+			}
+			key, signer, err = generateKey(dir, zone, algorithm, flags, settings.KeyBits())
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if flags == kskFlags {
+			keys.KSK, keys.kskSigner = key, signer
+		} else {
+			keys.ZSK, keys.zskSigner = key, signer
+		}
+	}
+
+	return keys, nil
+}
+
+// LoadAll loads or generates the keys of every configured zone, keyed by origin
+func LoadAll(cfg *reghost.Config) (map[string]*ZoneKeys, error) {
+	all := make(map[string]*ZoneKeys)
+	if cfg.DNSSEC == nil {
+		return all, nil
+	}
+
+	for i := range cfg.Zones {
+		keys, err := LoadOrGenerate(cfg.DNSSEC, cfg.Zones[i].Origin())
+		if err != nil {
+			return nil, fmt.Errorf("zone %s: %w", cfg.Zones[i].Origin(), err)
+		}
+		all[keys.Zone] = keys
+	}
+	return all, nil
+}
+
+// DS returns the SHA-256 DS record of the key signing key, to be installed
+// in the parent zone
+func (k *ZoneKeys) DS() *dns.DS {
+	return k.KSK.ToDS(dns.SHA256)
+}
+
+// DNSKEYs returns the DNSKEY rrset of the zone with the given TTL
+func (k *ZoneKeys) DNSKEYs(ttl uint32) []dns.RR {
+	ksk := *k.KSK
+	zsk := *k.ZSK
+	ksk.Hdr.Ttl = ttl
+	zsk.Hdr.Ttl = ttl
+	return []dns.RR{&ksk, &zsk}
+}
+
+// loadKey reads the first key with the given flags from the key directory.
+// It returns a nil key when there is none.
+func loadKey(dir, zone string, algorithm uint8, flags uint16) (*dns.DNSKEY, crypto.Signer, error) {
+	pattern := filepath.Join(dir, fmt.Sprintf("K%s+%03d+*.key", zone, algorithm))
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, path := range matches {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		rr, err := dns.NewRR(string(data))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		key, ok := rr.(*dns.DNSKEY)
+		if !ok || key.Flags != flags {
+			continue
+		}
+
+		privatePath := strings.TrimSuffix(path, ".key") + ".private"
+		privateFile, err := os.Open(privatePath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open %s: %w", privatePath, err)
+		}
+		private, err := key.ReadPrivateKey(privateFile, privatePath)
+		privateFile.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse %s: %w", privatePath, err)
+		}
+
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, nil, fmt.Errorf("%s does not hold a signing key", privatePath)
+		}
+		return key, signer, nil
+	}
+
+	return nil, nil, nil
+}
+
+// generateKey creates a new key and stores it in BIND's K<zone>+<alg>+<tag> format
+func generateKey(dir, zone string, algorithm uint8, flags uint16, bits int) (*dns.DNSKEY, crypto.Signer, error) {
+	key := &dns.DNSKEY{
+		Hdr: dns.RR_Header{
+			Name:   zone,
+			Rrtype: dns.TypeDNSKEY,
+			Class:  dns.ClassINET,
+			Ttl:    reghost.DefaultZoneTTL,
+		},
+		Flags:     flags,
+		Protocol:  3,
+		Algorithm: algorithm,
+	}
+
+	private, err := key.Generate(bits)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, nil, fmt.Errorf("generated key cannot sign")
+	}
+
+	base := filepath.Join(dir, fmt.Sprintf("K%s+%03d+%05d", zone, algorithm, key.KeyTag()))
+	if err := os.WriteFile(base+".private", []byte(key.PrivateKeyString(private)), 0600); err != nil {
+		return nil, nil, fmt.Errorf("failed to write private key: %w", err)
+	}
+	if err := os.WriteFile(base+".key", []byte(key.String()+"\n"), 0644); err != nil {
+		return nil, nil, fmt.Errorf("failed to write public key: %w", err)
+	}
+
+	return key, signer, nil
+}
@@ -0,0 +1,301 @@
+package dnssec
+
+import (
+	"encoding/base32"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// signatureValidity is how long online signatures stay valid
+	signatureValidity = 7 * 24 * time.Hour
+	// signatureSkew backdates the inception to tolerate clock differences
+	signatureSkew = time.Hour
+)
+
+// nsec3Encoding is the unpadded base32hex alphabet used for NSEC3 hashes
+var nsec3Encoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+// Sign returns the records with an RRSIG appended after each rrset. DNSKEY
+// rrsets are signed with the KSK and everything else with the ZSK; OPT,
+// TSIG and RRSIG records are passed through unsigned.
+func (k *ZoneKeys) Sign(rrs []dns.RR, now time.Time) ([]dns.RR, error) {
+	var signed []dns.RR
+	for _, rrset := range groupRRsets(rrs) {
+		signed = append(signed, rrset...)
+
+		switch rrset[0].Header().Rrtype {
+		case dns.TypeOPT, dns.TypeTSIG, dns.TypeRRSIG:
+			continue
+		}
+
+		sig, err := k.sign(rrset, now)
+		if err != nil {
+			return nil, err
+		}
+		signed = append(signed, sig)
+	}
+	return signed, nil
+}
+
+// sign creates the RRSIG of a single rrset
+func (k *ZoneKeys) sign(rrset []dns.RR, now time.Time) (*dns.RRSIG, error) {
+	key, signer := k.ZSK, k.zskSigner
+	if rrset[0].Header().Rrtype == dns.TypeDNSKEY {
+		key, signer = k.KSK, k.kskSigner
+	}
+
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Ttl: rrset[0].Header().Ttl},
+		Algorithm:  key.Algorithm,
+		SignerName: k.Zone,
+		KeyTag:     key.KeyTag(),
+		Inception:  uint32(now.Add(-signatureSkew).Unix()),
+		Expiration: uint32(now.Add(signatureValidity).Unix()),
+	}
+	if err := sig.Sign(signer, rrset); err != nil {
+		return nil, fmt.Errorf("failed to sign %s %s: %w", rrset[0].Header().Name, dns.TypeToString[rrset[0].Header().Rrtype], err)
+	}
+	return sig, nil
+}
+
+// groupRRsets splits records into rrsets, keeping the order of first appearance
+func groupRRsets(rrs []dns.RR) [][]dns.RR {
+	var sets [][]dns.RR
+	index := make(map[string]int)
+	for _, rr := range rrs {
+		hdr := rr.Header()
+		key := fmt.Sprintf("%s/%d/%d", dns.CanonicalName(hdr.Name), hdr.Rrtype, hdr.Class)
+		if i, ok := index[key]; ok {
+			sets[i] = append(sets[i], rr)
+			continue
+		}
+		index[key] = len(sets)
+		sets = append(sets, []dns.RR{rr})
+	}
+	return sets
+}
+
+// Denial describes a negative answer that needs a proof of non-existence.
+// Proofs are generated on the fly with minimally covering records
+// ("white lies", RFC 4470 and RFC 7129 appendix B), since regex rules make
+// it impossible to walk the zone.
+type Denial struct {
+	Zone  string
+	QName string
+	// Types lists the types that exist at QName, for NODATA answers
+	Types []uint16
+	// NXDomain is set when QName does not exist at all
+	NXDomain bool
+	// Encloser is the closest existing ancestor of QName, for NXDOMAIN
+	Encloser string
+	// EncloserTypes lists the types that exist at Encloser
+	EncloserTypes []uint16
+	TTL           uint32
+}
+
+// NSEC returns the NSEC records proving the denial
+func (d *Denial) NSEC() []dns.RR {
+	qname := dns.CanonicalName(d.QName)
+	if !d.NXDomain {
+		return []dns.RR{d.nsec(qname, `\000.`+qname, withTypes(d.Types, dns.TypeRRSIG, dns.TypeNSEC))}
+	}
+
+	encloser := dns.CanonicalName(d.Encloser)
+	return []dns.RR{
+		// Covers the query name itself
+		d.nsec(predecessor(qname), `\000.`+qname, []uint16{dns.TypeRRSIG, dns.TypeNSEC}),
+		// Covers the wildcard below the closest encloser
+		d.nsec(`\000.`+encloser, "+."+encloser, []uint16{dns.TypeRRSIG, dns.TypeNSEC}),
+	}
+}
+
+// NSEC3 returns the NSEC3 records proving the denial, using no salt and no
+// extra iterations as recommended by RFC 9276
+func (d *Denial) NSEC3() []dns.RR {
+	qname := dns.CanonicalName(d.QName)
+	if !d.NXDomain {
+		return []dns.RR{d.nsec3Matching(qname, withTypes(d.Types, dns.TypeRRSIG))}
+	}
+
+	encloser := dns.CanonicalName(d.Encloser)
+	labels := dns.SplitDomainName(qname)
+	nextCloser := dns.Fqdn(strings.Join(labels[len(labels)-dns.CountLabel(encloser)-1:], "."))
+
+	return []dns.RR{
+		d.nsec3Matching(encloser, withTypes(d.EncloserTypes, dns.TypeRRSIG)),
+		d.nsec3Covering(nextCloser),
+		d.nsec3Covering("*." + encloser),
+	}
+}
+
+// nsec builds an NSEC record
+func (d *Denial) nsec(owner, next string, types []uint16) *dns.NSEC {
+	return &dns.NSEC{
+		Hdr: dns.RR_Header{
+			Name:   owner,
+			Rrtype: dns.TypeNSEC,
+			Class:  dns.ClassINET,
+			Ttl:    d.TTL,
+		},
+		NextDomain: next,
+		TypeBitMap: sortedTypes(types),
+	}
+}
+
+// nsec3Matching builds an NSEC3 record whose owner is the hash of name
+func (d *Denial) nsec3Matching(name string, types []uint16) *dns.NSEC3 {
+	hash := dns.HashName(name, dns.SHA1, 0, "")
+	return d.nsec3(hash, shiftHash(hash, 1), types)
+}
+
+// nsec3Covering builds an NSEC3 record whose range covers the hash of name
+func (d *Denial) nsec3Covering(name string) *dns.NSEC3 {
+	hash := dns.HashName(name, dns.SHA1, 0, "")
+	return d.nsec3(shiftHash(hash, -1), shiftHash(hash, 1), nil)
+}
+
+// nsec3 builds an NSEC3 record
+func (d *Denial) nsec3(ownerHash, nextHash string, types []uint16) *dns.NSEC3 {
+	return &dns.NSEC3{
+		Hdr: dns.RR_Header{
+			Name:   strings.ToLower(ownerHash) + "." + dns.CanonicalName(d.Zone),
+			Rrtype: dns.TypeNSEC3,
+			Class:  dns.ClassINET,
+			Ttl:    d.TTL,
+		},
+		Hash:       dns.SHA1,
+		HashLength: 20,
+		NextDomain: nextHash,
+		TypeBitMap: sortedTypes(types),
+	}
+}
+
+// NSEC3PARAM returns the NSEC3PARAM record matching the generated NSEC3 records
+func NSEC3PARAM(zone string, ttl uint32) *dns.NSEC3PARAM {
+	return &dns.NSEC3PARAM{
+		Hdr: dns.RR_Header{
+			Name:   dns.CanonicalName(zone),
+			Rrtype: dns.TypeNSEC3PARAM,
+			Class:  dns.ClassINET,
+			Ttl:    ttl,
+		},
+		Hash: dns.SHA1,
+	}
+}
+
+// shiftHash adds delta to a base32hex encoded hash, wrapping around
+func shiftHash(hash string, delta int) string {
+	raw, err := nsec3Encoding.DecodeString(strings.ToUpper(hash))
+	if err != nil {
+		return hash
+	}
+
+	carry := delta
+	for i := len(raw) - 1; i >= 0 && carry != 0; i-- {
+		value := int(raw[i]) + carry
+		carry = 0
+		if value > 0xff {
+			value -= 0x100
+			carry = 1
+		} else if value < 0 {
+			value += 0x100
+			carry = -1
+		}
+		raw[i] = byte(value)
+	}
+	return nsec3Encoding.EncodeToString(raw)
+}
+
+// predecessor returns a name that sorts immediately before name in canonical
+// order (RFC 4034 section 6.1), by decrementing the last octet of the first
+// label and appending the highest octet
+func predecessor(name string) string {
+	labels := dns.SplitDomainName(name)
+	if len(labels) == 0 {
+		return name
+	}
+
+	parent := dns.Fqdn(strings.Join(labels[1:], "."))
+	first := unescapeLabel(labels[0])
+	last := first[len(first)-1]
+	if last == 0 {
+		if len(first) == 1 {
+			return parent
+		}
+		first = first[:len(first)-1]
+	} else {
+		first[len(first)-1] = last - 1
+		if len(first) < 63 {
+			first = append(first, 0xff)
+		}
+	}
+
+	if parent == "." {
+		return escapeLabel(first) + "."
+	}
+	return escapeLabel(first) + "." + parent
+}
+
+// unescapeLabel converts a presentation format label into raw octets
+func unescapeLabel(label string) []byte {
+	var raw []byte
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		if c != '\\' || i+1 >= len(label) {
+			raw = append(raw, c)
+			continue
+		}
+		if i+3 < len(label) && isDigit(label[i+1]) && isDigit(label[i+2]) && isDigit(label[i+3]) {
+			raw = append(raw, (label[i+1]-'0')*100+(label[i+2]-'0')*10+(label[i+3]-'0'))
+			i += 3
+			continue
+		}
+		raw = append(raw, label[i+1])
+		i++
+	}
+	return raw
+}
+
+// escapeLabel converts raw octets into a presentation format label
+func escapeLabel(raw []byte) string {
+	var b strings.Builder
+	for _, c := range raw {
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || isDigit(c) || c == '-' || c == '_' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "\\%03d", c)
+	}
+	return b.String()
+}
+
+// isDigit reports whether c is an ASCII digit
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// withTypes returns a new slice holding types followed by extra
+func withTypes(types []uint16, extra ...uint16) []uint16 {
+	combined := make([]uint16, 0, len(types)+len(extra))
+	combined = append(combined, types...)
+	return append(combined, extra...)
+}
+
+// sortedTypes returns the types sorted and without duplicates
+func sortedTypes(types []uint16) []uint16 {
+	sorted := make([]uint16, 0, len(types))
+	seen := make(map[uint16]bool)
+	for _, t := range types {
+		if !seen[t] {
+			seen[t] = true
+			sorted = append(sorted, t)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
@@ -0,0 +1,177 @@
+package hosts
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/bilgehannal/reghost/internal/utils"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+// Markers delimiting the block of a hosts file managed by reghost
+const (
+	BeginMarker = "# BEGIN reghost managed block - do not edit"
+	EndMarker   = "# END reghost managed block"
+)
+
+// Manager keeps the exact-match records in a managed block of a hosts file
+type Manager struct {
+	mu      sync.Mutex
+	path    string
+	logger  *utils.Logger
+	records []reghost.Record
+	// active is set once the block was written, so that Sync does not add
+	// it back after Cleanup
+	active bool
+}
+
+// NewManager creates a manager for the hosts file at path
+func NewManager(path string, logger *utils.Logger) *Manager {
+	return &Manager{
+		path:   path,
+		logger: logger,
+	}
+}
+
+// Path returns the hosts file being managed
+func (m *Manager) Path() string {
+	return m.path
+}
+
+// Update writes the exact-match records among records to the managed block
+func (m *Manager) Update(records []reghost.Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.records = Entries(records)
+	m.active = true
+	_, err := m.sync()
+	return err
+}
+
+// Sync rewrites the managed block if it was removed or edited since the
+// last update. It reports whether the file was rewritten.
+func (m *Manager) Sync() (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.active {
+		return false, nil
+	}
+	return m.sync()
+}
+
+// Cleanup removes the managed block from the hosts file
+func (m *Manager) Cleanup() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.active = false
+	m.records = nil
+	_, err := m.sync()
+	return err
+}
+
+// sync writes the managed block for the current records, leaving the file
+// untouched if it is already up to date. The caller holds the mutex.
+func (m *Manager) sync() (bool, error) {
+	content, err := os.ReadFile(m.path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read %s: %w", m.path, err)
+	}
+
+	updated := Render(content, m.records)
+	if bytes.Equal(content, updated) {
+		return false, nil
+	}
+	if err := utils.WriteFileAtomic(m.path, updated, 0644); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Entries returns the records a hosts file can hold: the effective record
+// of every exact-match domain, without regex rules and shadowed records
+func Entries(records []reghost.Record) []reghost.Record {
+	entries := reghost.NewMatcher(records).Enumerate(nil)
+	for i := range entries {
+		entries[i].Domain = strings.TrimSuffix(entries[i].Domain, ".")
+	}
+	return entries
+}
+
+// Render returns the content of a hosts file with its managed block
+// replaced by one holding records. The block keeps its position, or is
+// appended when the file has none. Without records the block is removed.
+func Render(content []byte, records []reghost.Record) []byte {
+	var block []string
+	if len(records) > 0 {
+		block = append(block, BeginMarker)
+		for _, record := range records {
+			block = append(block, record.IP+"\t"+record.Domain)
+		}
+		block = append(block, EndMarker)
+	}
+
+	text := string(content)
+	var lines []string
+	if text != "" {
+		lines = strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	}
+
+	var result []string
+	placed := false
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == EndMarker {
+			// A stray end marker is dropped
+			continue
+		}
+		if line != BeginMarker {
+			result = append(result, lines[i])
+			continue
+		}
+
+		// Skip the old block. Without an end marker only the begin marker
+		// is dropped, so that no user lines are lost.
+		if end := blockEnd(lines, i); end > i {
+			i = end
+		}
+		// Drop the blank line separating a removed block at the end
+		if len(block) == 0 && i == len(lines)-1 && len(result) > 0 && strings.TrimSpace(result[len(result)-1]) == "" {
+			result = result[:len(result)-1]
+		}
+		if !placed {
+			result = append(result, block...)
+			placed = true
+		}
+	}
+	if !placed && len(block) > 0 {
+		if len(result) > 0 && strings.TrimSpace(result[len(result)-1]) != "" {
+			result = append(result, "")
+		}
+		result = append(result, block...)
+	}
+
+	if len(result) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(result, "\n") + "\n")
+}
+
+// blockEnd returns the line of the end marker closing the block starting at
+// begin, or -1
+func blockEnd(lines []string, begin int) int {
+	for i := begin + 1; i < len(lines); i++ {
+		switch strings.TrimSpace(lines[i]) {
+		case EndMarker:
+			return i
+		case BeginMarker:
+			return -1
+		}
+	}
+	return -1
+}
@@ -0,0 +1,117 @@
+//go:build darwin
+
+package platform
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/bilgehannal/reghost/internal/resolver"
+	"github.com/bilgehannal/reghost/internal/sysstate"
+	"github.com/bilgehannal/reghost/internal/utils"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+// Darwin integrates with macOS through ifconfig and per-domain files in
+// /etc/resolver
+type Darwin struct {
+	logger          *utils.Logger
+	journal         *sysstate.Journal
+	resolverManager *resolver.Manager // Dynamic resolver file manager
+}
+
+// newPlatform returns the platform of the running system
+func newPlatform(logger *utils.Logger, journal *sysstate.Journal) Platform {
+	return &Darwin{
+		logger:  logger,
+		journal: journal,
+	}
+}
+
+// Name identifies the platform in logs
+func (d *Darwin) Name() string {
+	return "macOS"
+}
+
+// HasAlias checks if an IP is already bound to the loopback interface
+func (d *Darwin) HasAlias(ip string) bool {
+	output, err := exec.Command("ifconfig", "lo0").Output()
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(output), "inet "+ip+" ")
+}
+
+// AddAlias adds an IP alias to the loopback interface
+func (d *Darwin) AddAlias(ip string) error {
+	cmd := exec.Command("ifconfig", "lo0", "alias", ip, "up")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ifconfig failed: %w (output: %s)", err, string(output))
+	}
+	return nil
+}
+
+// RemoveAlias removes an IP alias from the loopback interface
+func (d *Darwin) RemoveAlias(ip string) error {
+	cmd := exec.Command("ifconfig", "lo0", "-alias", ip)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ifconfig failed: %w (output: %s)", err, string(output))
+	}
+	return nil
+}
+
+// HasLink reports false, as reghost creates no links on macOS
+func (d *Darwin) HasLink(name string) bool {
+	return false
+}
+
+// RemoveLink is not supported on macOS
+func (d *Darwin) RemoveLink(name string) error {
+	return fmt.Errorf("removing links is not supported on macOS")
+}
+
+// ConfigureResolver creates /etc/resolver files for the domain suffixes of
+// the records
+func (d *Darwin) ConfigureResolver(bindIP string, records []reghost.Record) error {
+	if d.resolverManager == nil {
+		d.resolverManager = resolver.NewManager(bindIP, d.logger)
+		d.resolverManager.SetJournal(d.journal)
+	}
+
+	if err := d.resolverManager.UpdateResolverFiles(records); err != nil {
+		return fmt.Errorf("failed to update resolver files: %w", err)
+	}
+	d.logger.Info("Managed domains: %v", d.resolverManager.GetManagedDomains())
+	return nil
+}
+
+// CleanupResolver removes all managed resolver files
+func (d *Darwin) CleanupResolver() error {
+	if d.resolverManager == nil {
+		return nil
+	}
+
+	d.logger.Info("Removing all managed macOS resolver configs...")
+	return d.resolverManager.CleanupAll()
+}
+
+// FlushCache flushes the macOS DNS cache
+func (d *Darwin) FlushCache() error {
+	if d.resolverManager == nil {
+		return nil
+	}
+	d.resolverManager.FlushDNSCache()
+	return nil
+}
+
+// Check reports an error if the alias or a resolver file is missing
+func (d *Darwin) Check(bindIP string) error {
+	if !d.HasAlias(bindIP) {
+		return fmt.Errorf("loopback alias %s is missing", bindIP)
+	}
+	if d.resolverManager == nil {
+		return nil
+	}
+	return d.resolverManager.Check()
+}
@@ -0,0 +1,161 @@
+package platform
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/bilgehannal/reghost/internal/resolver"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+// Fake is an in-memory platform. It changes nothing on the system, so the
+// daemon lifecycle can be exercised without root.
+type Fake struct {
+	mu         sync.Mutex
+	aliases    map[string]bool
+	links      map[string]bool
+	resolverIP string
+	domains    []string
+	flushes    int
+}
+
+// NewFake returns an empty in-memory platform
+func NewFake() *Fake {
+	return &Fake{
+		aliases: make(map[string]bool),
+		links:   make(map[string]bool),
+	}
+}
+
+// Name identifies the platform in logs
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+// HasAlias checks if an IP alias was added
+func (f *Fake) HasAlias(ip string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.aliases[ip]
+}
+
+// AddAlias records an IP alias
+func (f *Fake) AddAlias(ip string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.aliases[ip] = true
+	return nil
+}
+
+// RemoveAlias forgets an IP alias
+func (f *Fake) RemoveAlias(ip string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.aliases[ip] {
+		return fmt.Errorf("alias %s does not exist", ip)
+	}
+	delete(f.aliases, ip)
+	return nil
+}
+
+// HasLink checks if a link was added
+func (f *Fake) HasLink(name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.links[name]
+}
+
+// AddLink records a link
+func (f *Fake) AddLink(name string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.links[name] = true
+}
+
+// RemoveLink forgets a link
+func (f *Fake) RemoveLink(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.links[name] {
+		return fmt.Errorf("link %s does not exist", name)
+	}
+	delete(f.links, name)
+	return nil
+}
+
+// ConfigureResolver records the resolver target and the domain suffixes
+// of records
+func (f *Fake) ConfigureResolver(bindIP string, records []reghost.Record) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.resolverIP = bindIP
+	f.domains = resolver.DomainSuffixes(records)
+	return nil
+}
+
+// CleanupResolver forgets the resolver configuration
+func (f *Fake) CleanupResolver() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.resolverIP = ""
+	f.domains = nil
+	return nil
+}
+
+// FlushCache counts cache flushes
+func (f *Fake) FlushCache() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.flushes++
+	return nil
+}
+
+// Check reports an error if the alias is missing or the resolver does not
+// point at bindIP
+func (f *Fake) Check(bindIP string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.aliases[bindIP] {
+		return fmt.Errorf("loopback alias %s is missing", bindIP)
+	}
+	if f.resolverIP != bindIP {
+		return fmt.Errorf("resolver does not point at %s", bindIP)
+	}
+	return nil
+}
+
+// Resolver returns the resolver target and its domain suffixes
+func (f *Fake) Resolver() (string, []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.resolverIP, append([]string(nil), f.domains...)
+}
+
+// Flushes returns the number of cache flushes
+func (f *Fake) Flushes() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.flushes
+}
+
+// Aliases returns the recorded IP aliases, sorted
+func (f *Fake) Aliases() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	aliases := make([]string, 0, len(f.aliases))
+	for ip := range f.aliases {
+		aliases = append(aliases, ip)
+	}
+	sort.Strings(aliases)
+	return aliases
+}
+
+// BreakResolver simulates another program overwriting the resolver
+// configuration
+func (f *Fake) BreakResolver() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.resolverIP = ""
+	f.domains = nil
+}
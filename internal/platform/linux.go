@@ -0,0 +1,134 @@
+//go:build linux
+
+package platform
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/bilgehannal/reghost/internal/resolver"
+	"github.com/bilgehannal/reghost/internal/sysstate"
+	"github.com/bilgehannal/reghost/internal/utils"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+// Linux integrates with Linux through rtnetlink and either systemd-resolved
+// or resolv.conf
+type Linux struct {
+	logger  *utils.Logger
+	journal *sysstate.Journal
+	backend resolver.Backend // systemd-resolved or resolv.conf, chosen on first use
+}
+
+// newPlatform returns the platform of the running system
+func newPlatform(logger *utils.Logger, journal *sysstate.Journal) Platform {
+	return &Linux{
+		logger:  logger,
+		journal: journal,
+	}
+}
+
+// Name identifies the platform in logs
+func (l *Linux) Name() string {
+	if l.backend != nil {
+		return "Linux (" + l.backend.Name() + ")"
+	}
+	return "Linux"
+}
+
+// HasAlias checks if an IP is already bound to the loopback interface
+func (l *Linux) HasAlias(ip string) bool {
+	iface, err := net.InterfaceByName(loopbackName)
+	if err != nil {
+		return false
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.String() == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// AddAlias adds an IP alias to the loopback interface
+func (l *Linux) AddAlias(ip string) error {
+	if err := addAddress(loopbackName, net.ParseIP(ip), 8); err != nil {
+		return fmt.Errorf("failed to add %s to %s: %w", ip, loopbackName, err)
+	}
+	return nil
+}
+
+// RemoveAlias removes an IP alias from the loopback interface
+func (l *Linux) RemoveAlias(ip string) error {
+	if err := deleteAddress(loopbackName, net.ParseIP(ip), 8); err != nil {
+		return fmt.Errorf("failed to remove %s from %s: %w", ip, loopbackName, err)
+	}
+	return nil
+}
+
+// HasLink checks if a network link exists
+func (l *Linux) HasLink(name string) bool {
+	_, err := net.InterfaceByName(name)
+	return err == nil
+}
+
+// AddDummyLink creates a dummy link and sets it up
+func (l *Linux) AddDummyLink(name string) error {
+	if err := addDummyLink(name); err != nil && !errors.Is(err, syscall.EEXIST) {
+		return fmt.Errorf("failed to create link %s: %w", name, err)
+	}
+	return nil
+}
+
+// RemoveLink deletes a network link
+func (l *Linux) RemoveLink(name string) error {
+	if err := deleteLink(name); err != nil {
+		return fmt.Errorf("failed to delete link %s: %w", name, err)
+	}
+	return nil
+}
+
+// ConfigureResolver points the resolver at the DNS server, through
+// systemd-resolved when it manages resolv.conf and by editing resolv.conf
+// otherwise
+func (l *Linux) ConfigureResolver(bindIP string, records []reghost.Record) error {
+	if l.backend == nil {
+		l.backend = resolver.DetectLinuxBackend(resolver.ExecRunner{}, l, resolver.ResolvConfPath, l.logger, l.journal)
+	}
+	return l.backend.Configure(bindIP, records)
+}
+
+// CleanupResolver reverts the resolver configuration
+func (l *Linux) CleanupResolver() error {
+	if l.backend == nil {
+		return nil
+	}
+	return l.backend.Cleanup()
+}
+
+// FlushCache flushes the cache of systemd-resolved. Without it, Linux has
+// no system-wide cache to flush.
+func (l *Linux) FlushCache() error {
+	if resolved, ok := l.backend.(*resolver.ResolvedBackend); ok {
+		return resolved.FlushCache()
+	}
+	return nil
+}
+
+// Check reports an error if the alias is missing or the resolver no longer
+// sends queries to bindIP
+func (l *Linux) Check(bindIP string) error {
+	if !l.HasAlias(bindIP) {
+		return fmt.Errorf("loopback alias %s is missing", bindIP)
+	}
+	if l.backend == nil {
+		return nil
+	}
+	return l.backend.Check(bindIP)
+}
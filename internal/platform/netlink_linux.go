@@ -0,0 +1,142 @@
+//go:build linux
+
+package platform
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// loopbackName is the loopback interface of Linux
+const loopbackName = "lo"
+
+// addAddress adds an address to an interface through rtnetlink
+func addAddress(ifname string, ip net.IP, prefixLen int) error {
+	return changeAddress(unix.RTM_NEWADDR, unix.NLM_F_CREATE|unix.NLM_F_EXCL, ifname, ip, prefixLen)
+}
+
+// deleteAddress removes an address from an interface through rtnetlink
+func deleteAddress(ifname string, ip net.IP, prefixLen int) error {
+	return changeAddress(unix.RTM_DELADDR, 0, ifname, ip, prefixLen)
+}
+
+// changeAddress sends an address request for an IPv4 address of an interface
+func changeAddress(msgType uint16, flags uint16, ifname string, ip net.IP, prefixLen int) error {
+	iface, err := net.InterfaceByName(ifname)
+	if err != nil {
+		return err
+	}
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return fmt.Errorf("%s is not an IPv4 address", ip)
+	}
+
+	// struct ifaddrmsg
+	msg := make([]byte, unix.SizeofIfAddrmsg)
+	msg[0] = unix.AF_INET
+	msg[1] = byte(prefixLen)
+	msg[3] = unix.RT_SCOPE_HOST
+	binary.NativeEndian.PutUint32(msg[4:], uint32(iface.Index))
+
+	msg = appendAttr(msg, unix.IFA_LOCAL, ip4)
+	msg = appendAttr(msg, unix.IFA_ADDRESS, ip4)
+	return netlinkRequest(msgType, flags, msg)
+}
+
+// addDummyLink creates a dummy link and sets it up through rtnetlink
+func addDummyLink(name string) error {
+	msg := ifinfomsg(0, unix.IFF_UP, unix.IFF_UP)
+	msg = appendAttr(msg, unix.IFLA_IFNAME, append([]byte(name), 0))
+	kind := appendAttr(nil, unix.IFLA_INFO_KIND, []byte("dummy"))
+	msg = appendAttr(msg, unix.IFLA_LINKINFO|unix.NLA_F_NESTED, kind)
+	return netlinkRequest(unix.RTM_NEWLINK, unix.NLM_F_CREATE|unix.NLM_F_EXCL, msg)
+}
+
+// deleteLink deletes a link through rtnetlink
+func deleteLink(name string) error {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return err
+	}
+	return netlinkRequest(unix.RTM_DELLINK, 0, ifinfomsg(iface.Index, 0, 0))
+}
+
+// ifinfomsg returns a struct ifinfomsg
+func ifinfomsg(index int, flags, change uint32) []byte {
+	msg := make([]byte, unix.SizeofIfInfomsg)
+	msg[0] = unix.AF_UNSPEC
+	binary.NativeEndian.PutUint32(msg[4:], uint32(index))
+	binary.NativeEndian.PutUint32(msg[8:], flags)
+	binary.NativeEndian.PutUint32(msg[12:], change)
+	return msg
+}
+
+// appendAttr appends a route attribute, padded to the netlink alignment
+func appendAttr(b []byte, attrType uint16, data []byte) []byte {
+	length := unix.SizeofRtAttr + len(data)
+	attr := make([]byte, rtaAlign(length))
+	binary.NativeEndian.PutUint16(attr[0:], uint16(length))
+	binary.NativeEndian.PutUint16(attr[2:], attrType)
+	copy(attr[unix.SizeofRtAttr:], data)
+	return append(b, attr...)
+}
+
+// rtaAlign rounds a length up to the netlink attribute alignment
+func rtaAlign(length int) int {
+	return (length + unix.RTA_ALIGNTO - 1) &^ (unix.RTA_ALIGNTO - 1)
+}
+
+// netlinkRequest sends a request to the kernel routing subsystem and waits
+// for its acknowledgement
+func netlinkRequest(msgType uint16, flags uint16, body []byte) error {
+	fd, err := unix.Socket(unix.AF_NETLINK, unix.SOCK_RAW|unix.SOCK_CLOEXEC, unix.NETLINK_ROUTE)
+	if err != nil {
+		return fmt.Errorf("failed to open netlink socket: %w", err)
+	}
+	defer unix.Close(fd)
+
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return fmt.Errorf("failed to bind netlink socket: %w", err)
+	}
+
+	const seq = 1
+	req := make([]byte, unix.NLMSG_HDRLEN, unix.NLMSG_HDRLEN+len(body))
+	binary.NativeEndian.PutUint32(req[0:], uint32(unix.NLMSG_HDRLEN+len(body)))
+	binary.NativeEndian.PutUint16(req[4:], msgType)
+	binary.NativeEndian.PutUint16(req[6:], flags|unix.NLM_F_REQUEST|unix.NLM_F_ACK)
+	binary.NativeEndian.PutUint32(req[8:], seq)
+	req = append(req, body...)
+
+	if err := unix.Sendto(fd, req, 0, &unix.SockaddrNetlink{Family: unix.AF_NETLINK}); err != nil {
+		return fmt.Errorf("failed to send netlink request: %w", err)
+	}
+
+	buf := make([]byte, unix.Getpagesize())
+	for {
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		if err != nil {
+			return fmt.Errorf("failed to read netlink response: %w", err)
+		}
+		msgs, err := syscall.ParseNetlinkMessage(buf[:n])
+		if err != nil {
+			return fmt.Errorf("failed to parse netlink response: %w", err)
+		}
+		for _, msg := range msgs {
+			if msg.Header.Seq != seq || msg.Header.Type != unix.NLMSG_ERROR {
+				continue
+			}
+			if len(msg.Data) < 4 {
+				return errors.New("short netlink error message")
+			}
+			if errno := int32(binary.NativeEndian.Uint32(msg.Data)); errno != 0 {
+				return syscall.Errno(-errno)
+			}
+			return nil
+		}
+	}
+}
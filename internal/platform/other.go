@@ -0,0 +1,39 @@
+//go:build !linux && !darwin
+
+package platform
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/bilgehannal/reghost/internal/sysstate"
+	"github.com/bilgehannal/reghost/internal/utils"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+// unsupported is the platform of systems reghost does not integrate with
+type unsupported struct{}
+
+// newPlatform returns the platform of the running system
+func newPlatform(logger *utils.Logger, journal *sysstate.Journal) Platform {
+	return unsupported{}
+}
+
+func (unsupported) Name() string                 { return runtime.GOOS }
+func (unsupported) HasAlias(ip string) bool      { return false }
+func (unsupported) AddAlias(ip string) error     { return errUnsupported() }
+func (unsupported) RemoveAlias(ip string) error  { return errUnsupported() }
+func (unsupported) HasLink(name string) bool     { return false }
+func (unsupported) RemoveLink(name string) error { return errUnsupported() }
+func (unsupported) CleanupResolver() error       { return nil }
+func (unsupported) FlushCache() error            { return nil }
+func (unsupported) Check(bindIP string) error    { return nil }
+
+func (unsupported) ConfigureResolver(bindIP string, records []reghost.Record) error {
+	return errUnsupported()
+}
+
+// errUnsupported returns the error of operations on unsupported systems
+func errUnsupported() error {
+	return fmt.Errorf("unsupported OS: %s", runtime.GOOS)
+}
@@ -0,0 +1,47 @@
+package platform
+
+import (
+	"github.com/bilgehannal/reghost/internal/sysstate"
+	"github.com/bilgehannal/reghost/internal/utils"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+// Platform is the system integration of the daemon: the loopback aliases it
+// binds to, the links it creates, the system resolver pointing at it and the
+// cache of that resolver. It also satisfies sysstate.Network, so leftovers
+// of a crashed daemon are undone through it.
+type Platform interface {
+	// Name identifies the platform in logs
+	Name() string
+
+	// HasAlias checks if an IP is bound to the loopback interface
+	HasAlias(ip string) bool
+	// AddAlias adds an IP alias to the loopback interface
+	AddAlias(ip string) error
+	// RemoveAlias removes an IP alias from the loopback interface
+	RemoveAlias(ip string) error
+
+	// HasLink checks if a network link exists
+	HasLink(name string) bool
+	// RemoveLink deletes a network link
+	RemoveLink(name string) error
+
+	// ConfigureResolver points the system resolver at the DNS server at
+	// bindIP for the domains of records. It is called again when the
+	// records change and to restore a configuration that was lost.
+	ConfigureResolver(bindIP string, records []reghost.Record) error
+	// CleanupResolver reverts the resolver configuration
+	CleanupResolver() error
+	// FlushCache flushes the cache of the system resolver
+	FlushCache() error
+
+	// Check reports an error if the DNS server at bindIP lost its alias or
+	// the system resolver no longer sends queries to it
+	Check(bindIP string) error
+}
+
+// New returns the platform of the running system. Changes are recorded in
+// journal, which may be nil.
+func New(logger *utils.Logger, journal *sysstate.Journal) Platform {
+	return newPlatform(logger, journal)
+}
@@ -0,0 +1,110 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/bilgehannal/reghost/internal/convert"
+	"github.com/bilgehannal/reghost/internal/utils"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+	"github.com/fsnotify/fsnotify"
+)
+
+// Dir serves the records of the files in a directory. Files are read in
+// name order, so a file takes precedence over the ones after it, and their
+// format follows their extension. The directory is watched and read again
+// whenever a file changes.
+type Dir struct {
+	name   string
+	path   string
+	logger *utils.Logger
+}
+
+// NewDir creates a provider for the record files in a directory
+func NewDir(name, path string, logger *utils.Logger) *Dir {
+	return &Dir{
+		name:   name,
+		path:   path,
+		logger: logger,
+	}
+}
+
+// Name names the provider and its layer
+func (d *Dir) Name() string {
+	return d.name
+}
+
+// Run serves the records of the directory until ctx is canceled
+func (d *Dir) Run(ctx context.Context, update func([]reghost.Record)) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %w", err)
+	}
+	defer watcher.Close()
+
+	// Watch before reading, so no change in between is missed
+	if err := watcher.Add(d.path); err != nil {
+		return fmt.Errorf("failed to watch %s: %w", d.path, err)
+	}
+
+	records := d.read()
+	update(records)
+	d.logger.Info("Provider %s: serving %d record(s) from %s", d.name, len(records), d.path)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if convert.FormatForFile(event.Name) == "" {
+				continue
+			}
+
+			current := d.read()
+			if !slices.Equal(current, records) {
+				records = current
+				update(records)
+				d.logger.Info("Provider %s: %s changed, serving %d record(s)", d.name, filepath.Base(event.Name), len(records))
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			d.logger.Error("Provider %s: watcher error: %v", d.name, err)
+		}
+	}
+}
+
+// read returns the records of the files in the directory. Files that
+// cannot be read are logged and left out.
+func (d *Dir) read() []reghost.Record {
+	entries, err := os.ReadDir(d.path)
+	if err != nil {
+		d.logger.Error("Provider %s: %v", d.name, err)
+		return nil
+	}
+
+	var records []reghost.Record
+	for _, entry := range entries {
+		format := convert.FormatForFile(entry.Name())
+		if entry.IsDir() || format == "" {
+			continue
+		}
+
+		fileRecords, err := importFile(d.name, format, filepath.Join(d.path, entry.Name()), d.logger)
+		if err != nil {
+			d.logger.Error("Provider %s: %v", d.name, err)
+			continue
+		}
+		records = append(records, fileRecords...)
+	}
+	return records
+}
@@ -0,0 +1,251 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bilgehannal/reghost/internal/utils"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+// Container labels the Docker provider derives domains from
+const (
+	DomainLabel         = "reghost.domain"
+	ComposeProjectLabel = "com.docker.compose.project"
+	ComposeServiceLabel = "com.docker.compose.service"
+)
+
+// dockerEvents are the events that change the records of containers
+var dockerEvents = []string{"start", "die", "destroy", "rename", "connect", "disconnect"}
+
+// Docker serves records for the running containers of a Docker Engine. It
+// lists them through the Engine API and follows its event stream to add and
+// remove records as containers start and stop.
+type Docker struct {
+	socket string
+	suffix string
+	logger *utils.Logger
+	client *http.Client
+	retry  time.Duration // Wait before reconnecting to the Engine
+}
+
+// dockerContainer is a container as listed by the Engine API
+type dockerContainer struct {
+	Names           []string          `json:"Names"`
+	Labels          map[string]string `json:"Labels"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress string `json:"IPAddress"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// dockerEvent is a message of the Engine API event stream
+type dockerEvent struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+}
+
+// NewDocker creates a provider for the Docker Engine configured by cfg
+func NewDocker(cfg *reghost.Docker, logger *utils.Logger) *Docker {
+	socket := cfg.SocketPath()
+	return &Docker{
+		socket: socket,
+		suffix: cfg.DomainSuffix(),
+		logger: logger,
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+		retry: 5 * time.Second,
+	}
+}
+
+// SetRetryInterval sets how long to wait before reconnecting to the Engine
+func (d *Docker) SetRetryInterval(interval time.Duration) {
+	d.retry = interval
+}
+
+// Name names the provider and its layer
+func (d *Docker) Name() string {
+	return "docker"
+}
+
+// Run follows the containers of the Docker Engine until ctx is canceled,
+// reconnecting whenever the connection is lost. The records of the last
+// listing are kept while the Engine is unreachable.
+func (d *Docker) Run(ctx context.Context, update func([]reghost.Record)) error {
+	for {
+		err := d.watch(ctx, update)
+		if ctx.Err() != nil {
+			return nil
+		}
+		d.logger.Warn("Docker provider: %v, retrying in %s", err, d.retry)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(d.retry):
+		}
+	}
+}
+
+// watch subscribes to the event stream, sends the records of the running
+// containers and then sends them again after every relevant event. It only
+// returns on an error.
+func (d *Docker) watch(ctx context.Context, update func([]reghost.Record)) error {
+	// Subscribe before listing, so no change in between is missed
+	filters, _ := json.Marshal(map[string][]string{
+		"type":  {"container", "network"},
+		"event": dockerEvents,
+	})
+	events, err := d.get(ctx, "/events?filters="+url.QueryEscape(string(filters)))
+	if err != nil {
+		return err
+	}
+	defer events.Close()
+
+	records, err := d.records(ctx)
+	if err != nil {
+		return err
+	}
+	update(records)
+	d.logger.Info("Docker provider: serving %d record(s)", len(records))
+
+	decoder := json.NewDecoder(events)
+	for {
+		var event dockerEvent
+		if err := decoder.Decode(&event); err != nil {
+			return fmt.Errorf("event stream closed: %w", err)
+		}
+		if !slices.Contains(dockerEvents, event.Action) {
+			continue
+		}
+
+		current, err := d.records(ctx)
+		if err != nil {
+			return err
+		}
+		if !slices.Equal(current, records) {
+			records = current
+			update(records)
+		}
+	}
+}
+
+// records lists the running containers and derives their records
+func (d *Docker) records(ctx context.Context) ([]reghost.Record, error) {
+	body, err := d.get(ctx, "/containers/json")
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var containers []dockerContainer
+	if err := json.NewDecoder(body).Decode(&containers); err != nil {
+		return nil, fmt.Errorf("failed to decode containers: %w", err)
+	}
+	return containerRecords(containers, d.suffix, d.Name()), nil
+}
+
+// get sends a GET request to the Engine API and returns the response body
+func (d *Docker) get(ctx context.Context, path string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach Docker at %s: %w", d.socket, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Docker API %s returned %s", path, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// containerRecords derives the records of containers. Containers are taken
+// in name order and the first one claiming a domain gets it, so replicas of
+// a compose service resolve to the first replica.
+func containerRecords(containers []dockerContainer, suffix, set string) []reghost.Record {
+	sort.Slice(containers, func(i, j int) bool {
+		return containerName(containers[i]) < containerName(containers[j])
+	})
+
+	var records []reghost.Record
+	seen := make(map[string]bool)
+	for _, c := range containers {
+		ip := containerIP(c)
+		if ip == "" {
+			continue
+		}
+		for _, domain := range containerDomains(c, suffix) {
+			if seen[domain] {
+				continue
+			}
+			seen[domain] = true
+			records = append(records, reghost.Record{Domain: domain, IP: ip, Set: set})
+		}
+	}
+	return records
+}
+
+// containerName returns the name of a container without the leading slash
+func containerName(c dockerContainer) string {
+	if len(c.Names) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// containerIP returns the address of a container on the first of its
+// networks, in name order, that has one
+func containerIP(c dockerContainer) string {
+	networks := make([]string, 0, len(c.NetworkSettings.Networks))
+	for name := range c.NetworkSettings.Networks {
+		networks = append(networks, name)
+	}
+	sort.Strings(networks)
+
+	for _, name := range networks {
+		if ip := c.NetworkSettings.Networks[name].IPAddress; ip != "" {
+			return ip
+		}
+	}
+	return ""
+}
+
+// containerDomains returns the domains of a container: those of its
+// reghost.domain label, its compose service and its name
+func containerDomains(c dockerContainer, suffix string) []string {
+	var domains []string
+	for _, domain := range strings.Split(c.Labels[DomainLabel], ",") {
+		if domain = strings.TrimSuffix(strings.TrimSpace(domain), "."); domain != "" {
+			domains = append(domains, strings.ToLower(domain))
+		}
+	}
+
+	project, service := c.Labels[ComposeProjectLabel], c.Labels[ComposeServiceLabel]
+	if project != "" && service != "" {
+		domains = append(domains, strings.ToLower(service+"."+project+"."+suffix))
+	}
+
+	if name := containerName(c); name != "" {
+		domains = append(domains, strings.ToLower(name+"."+suffix))
+	}
+	return domains
+}
@@ -0,0 +1,91 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bilgehannal/reghost/internal/convert"
+	"github.com/bilgehannal/reghost/internal/utils"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+// Exec serves the records printed by a command as a JSON array, in the
+// format of 'reghostctl export -f json'. The command runs periodically; when
+// it fails, the records of its last successful run are kept.
+type Exec struct {
+	name     string
+	command  []string
+	interval time.Duration
+	logger   *utils.Logger
+}
+
+// NewExec creates a provider running command every interval
+func NewExec(name string, command []string, interval time.Duration, logger *utils.Logger) *Exec {
+	return &Exec{
+		name:     name,
+		command:  command,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Name names the provider and its layer
+func (e *Exec) Name() string {
+	return e.name
+}
+
+// Run runs the command until ctx is canceled
+func (e *Exec) Run(ctx context.Context, update func([]reghost.Record)) error {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	var records []reghost.Record
+	first := true
+	for {
+		current, err := e.run(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			e.logger.Warn("Provider %s: %v", e.name, err)
+		} else if first || !slices.Equal(current, records) {
+			records = current
+			first = false
+			update(records)
+			e.logger.Info("Provider %s: serving %d record(s)", e.name, len(records))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// run runs the command once and parses its output. A run may take up to
+// the interval.
+func (e *Exec) run(ctx context.Context) ([]reghost.Record, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.interval)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.command[0], e.command[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && stderr.Len() > 0 {
+			return nil, fmt.Errorf("%s failed: %w: %s", e.command[0], err, strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("%s failed: %w", e.command[0], err)
+	}
+
+	return importRecords(e.name, convert.FormatJSON, &stdout, e.command[0], e.logger)
+}
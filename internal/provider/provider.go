@@ -0,0 +1,50 @@
+package provider
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bilgehannal/reghost/internal/convert"
+	"github.com/bilgehannal/reghost/internal/utils"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+// New creates the built-in provider declared by source
+func New(source reghost.ProviderSource, logger *utils.Logger) reghost.Provider {
+	if source.Dir != "" {
+		return NewDir(source.Name, source.Dir, logger)
+	}
+	return NewExec(source.Name, source.Exec, source.RunInterval(), logger)
+}
+
+// importRecords reads records in an import format and annotates them with
+// the provider name. Entries that are not translated are logged.
+func importRecords(name, format string, r io.Reader, source string, logger *utils.Logger) ([]reghost.Record, error) {
+	records, issues, err := convert.Import(format, r, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, issue := range issues {
+		logger.Warn("Provider %s: skipped %s in %s", name, issue, source)
+	}
+	for i := range records {
+		records[i].Set = name
+	}
+	return records, nil
+}
+
+// importFile reads the records of a file in an import format
+func importFile(name, format, path string, logger *utils.Logger) ([]reghost.Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records, err := importRecords(name, format, file, path, logger)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return records, nil
+}
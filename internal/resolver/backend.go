@@ -0,0 +1,88 @@
+package resolver
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/bilgehannal/reghost/internal/sysstate"
+	"github.com/bilgehannal/reghost/internal/utils"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+// ResolvConfPath is the resolver configuration file on Linux
+const ResolvConfPath = "/etc/resolv.conf"
+
+// Backend points the system resolver of Linux at the reghost DNS server
+type Backend interface {
+	// Name identifies the backend in logs
+	Name() string
+	// Configure routes queries to the DNS server at bindIP. It is called
+	// again when the records change and periodically to restore a
+	// configuration that was lost, so it only changes what is missing.
+	Configure(bindIP string, records []reghost.Record) error
+	// Check reports an error if queries no longer reach the DNS server at
+	// bindIP
+	Check(bindIP string) error
+	// Cleanup reverts the configuration
+	Cleanup() error
+}
+
+// Links creates and deletes network links
+type Links interface {
+	HasLink(name string) bool
+	// AddDummyLink creates a dummy link and sets it up
+	AddDummyLink(name string) error
+	RemoveLink(name string) error
+}
+
+// Runner runs system commands
+type Runner interface {
+	Run(name string, args ...string) ([]byte, error)
+}
+
+// ExecRunner runs commands as child processes
+type ExecRunner struct{}
+
+// Run runs a command and returns its combined output
+func (ExecRunner) Run(name string, args ...string) ([]byte, error) {
+	return exec.Command(name, args...).CombinedOutput()
+}
+
+// DetectLinuxBackend returns the systemd-resolved backend if systemd-resolved
+// manages resolvConf, and the resolv.conf editing backend otherwise
+func DetectLinuxBackend(runner Runner, links Links, resolvConf string, logger *utils.Logger, journal *sysstate.Journal) Backend {
+	if ResolvedInUse(resolvConf) {
+		if _, err := runner.Run("resolvectl", "status"); err == nil {
+			return NewResolvedBackend(runner, links, logger, journal)
+		}
+		logger.Warn("resolv.conf points at systemd-resolved, but resolvectl is not available")
+	}
+	return NewResolvConfBackend(resolvConf, logger, journal)
+}
+
+// ResolvedInUse reports whether resolvConf hands queries to systemd-resolved,
+// either as a symlink into /run/systemd/resolve or by listing its stub
+// listener
+func ResolvedInUse(resolvConf string) bool {
+	if target, err := os.Readlink(resolvConf); err == nil {
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(resolvConf), target)
+		}
+		if strings.HasPrefix(filepath.Clean(target), "/run/systemd/resolve/") {
+			return true
+		}
+	}
+
+	content, err := os.ReadFile(resolvConf)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "nameserver" && fields[1] == resolvedStubAddress {
+			return true
+		}
+	}
+	return false
+}
@@ -6,8 +6,10 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
+	"github.com/bilgehannal/reghost/internal/sysstate"
 	"github.com/bilgehannal/reghost/internal/utils"
 	"github.com/bilgehannal/reghost/pkg/reghost"
 )
@@ -22,6 +24,7 @@ type Manager struct {
 	bindIP           string
 	managedDomains   map[string]bool // Track which domains we've created files for
 	resolverFilesDir string
+	journal          *sysstate.Journal
 }
 
 // NewManager creates a new resolver manager
@@ -34,10 +37,15 @@ func NewManager(bindIP string, logger *utils.Logger) *Manager {
 	}
 }
 
+// SetJournal sets the journal recording the resolver files created
+func (m *Manager) SetJournal(journal *sysstate.Journal) {
+	m.journal = journal
+}
+
 // UpdateResolverFiles creates/updates resolver files based on active records
 func (m *Manager) UpdateResolverFiles(records []reghost.Record) error {
 	// Extract unique domain suffixes from records
-	suffixes := m.extractDomainSuffixes(records)
+	suffixes := DomainSuffixes(records)
 
 	if len(suffixes) == 0 {
 		m.logger.Warn("No domain suffixes found in active records")
@@ -86,14 +94,15 @@ func (m *Manager) UpdateResolverFiles(records []reghost.Record) error {
 	// Only flush DNS cache if changes were made
 	if changesMade {
 		m.logger.Info("Resolver configuration updated for domains: %v", suffixes)
-		m.flushDNSCache()
+		m.FlushDNSCache()
 	}
 
 	return nil
 }
 
-// extractDomainSuffixes extracts domain suffixes from record patterns
-func (m *Manager) extractDomainSuffixes(records []reghost.Record) []string {
+// DomainSuffixes extracts the domain suffixes to route to reghost from
+// record patterns, sorted
+func DomainSuffixes(records []reghost.Record) []string {
 	suffixMap := make(map[string]bool)
 
 	for _, record := range records {
@@ -105,7 +114,7 @@ func (m *Manager) extractDomainSuffixes(records []reghost.Record) []string {
 		}
 
 		// Extract suffix from different pattern types
-		suffix := m.extractSuffix(domain)
+		suffix := extractSuffix(domain)
 		if suffix != "" {
 			suffixMap[suffix] = true
 		}
@@ -116,12 +125,13 @@ func (m *Manager) extractDomainSuffixes(records []reghost.Record) []string {
 	for suffix := range suffixMap {
 		suffixes = append(suffixes, suffix)
 	}
+	sort.Strings(suffixes)
 
 	return suffixes
 }
 
 // extractSuffix extracts the domain suffix from a pattern
-func (m *Manager) extractSuffix(pattern string) string {
+func extractSuffix(pattern string) string {
 	// Remove trailing dot if present
 	pattern = strings.TrimSuffix(pattern, ".")
 
@@ -204,6 +214,11 @@ func (m *Manager) createResolverFile(suffix string) error {
 		m.logger.Info("Resolver file %s has incorrect content, updating...", filePath)
 	}
 
+	// Record the file first, so that it is removed after a crash
+	if err := m.journal.AddResolverFile(filePath); err != nil {
+		return err
+	}
+
 	// Write the file
 	cmd := exec.Command("tee", filePath)
 	cmd.Stdin = strings.NewReader(expectedContent)
@@ -226,7 +241,7 @@ func (m *Manager) removeResolverFile(suffix string) error {
 
 	m.logger.Info("✓ Removed resolver file: %s", filePath)
 	delete(m.managedDomains, suffix)
-	return nil
+	return m.journal.RemoveResolverFile(filePath)
 }
 
 // CleanupAll removes all managed resolver files
@@ -239,19 +254,33 @@ func (m *Manager) CleanupAll() error {
 		}
 	}
 
-	m.flushDNSCache()
+	m.FlushDNSCache()
 	m.managedDomains = make(map[string]bool)
 
 	return nil
 }
 
-// flushDNSCache flushes the macOS DNS cache
-func (m *Manager) flushDNSCache() {
+// FlushDNSCache flushes the macOS DNS cache
+func (m *Manager) FlushDNSCache() {
 	exec.Command("dscacheutil", "-flushcache").Run()
 	exec.Command("killall", "-HUP", "mDNSResponder").Run()
 	m.logger.Info("✓ DNS cache flushed")
 }
 
+// Check reports an error if a managed resolver file is missing or no longer
+// points at the DNS server
+func (m *Manager) Check() error {
+	expectedContent := fmt.Sprintf("nameserver %s\nport 53\n", m.bindIP)
+	for domain := range m.managedDomains {
+		filePath := filepath.Join(m.resolverFilesDir, domain)
+		content, err := os.ReadFile(filePath)
+		if err != nil || string(content) != expectedContent {
+			return fmt.Errorf("resolver file %s is missing or changed", filePath)
+		}
+	}
+	return nil
+}
+
 // GetManagedDomains returns the list of currently managed domain suffixes
 func (m *Manager) GetManagedDomains() []string {
 	domains := make([]string, 0, len(m.managedDomains))
@@ -0,0 +1,106 @@
+package resolver
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bilgehannal/reghost/internal/sysstate"
+	"github.com/bilgehannal/reghost/internal/utils"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+// ResolvConfBackend adds reghost as the first nameserver of resolv.conf.
+// All queries then go to reghost, which answers or forwards them.
+type ResolvConfBackend struct {
+	path    string
+	logger  *utils.Logger
+	journal *sysstate.Journal
+	// original is the content before the nameserver was added
+	original []byte
+}
+
+// NewResolvConfBackend creates a backend editing the resolv.conf at path
+func NewResolvConfBackend(path string, logger *utils.Logger, journal *sysstate.Journal) *ResolvConfBackend {
+	return &ResolvConfBackend{
+		path:    path,
+		logger:  logger,
+		journal: journal,
+	}
+}
+
+// Name identifies the backend in logs
+func (b *ResolvConfBackend) Name() string {
+	return "resolv.conf"
+}
+
+// Configure adds the nameserver at the top of resolv.conf unless it is
+// listed. The records are not needed, as all queries go to reghost.
+func (b *ResolvConfBackend) Configure(bindIP string, records []reghost.Record) error {
+	content, err := os.ReadFile(b.path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", b.path, err)
+	}
+
+	lines := strings.Split(string(content), "\n")
+	nameserverEntry := fmt.Sprintf("nameserver %s", bindIP)
+
+	// Check if already configured
+	for _, line := range lines {
+		if strings.TrimSpace(line) == nameserverEntry {
+			return nil
+		}
+	}
+
+	// Record the backup first, so that it is restored after a crash
+	if b.original == nil {
+		b.original = content
+		backup := &sysstate.ResolvConfBackup{Path: b.path, Nameserver: nameserverEntry, Original: string(content)}
+		if err := b.journal.SetResolvConf(backup); err != nil {
+			return err
+		}
+	} else {
+		b.logger.Warn("⚠ Nameserver %s removed from %s, restoring...", bindIP, b.path)
+	}
+
+	// Build new content with our nameserver first; resolv.conf may be a
+	// symlink, so it is written in place
+	newContent := nameserverEntry + "\n" + string(content)
+	if err := os.WriteFile(b.path, []byte(newContent), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", b.path, err)
+	}
+
+	b.logger.Info("✓ Updated %s - %s is now first nameserver", b.path, bindIP)
+	return nil
+}
+
+// Check reports an error unless resolv.conf lists the nameserver at bindIP
+func (b *ResolvConfBackend) Check(bindIP string) error {
+	content, err := os.ReadFile(b.path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", b.path, err)
+	}
+	nameserverEntry := fmt.Sprintf("nameserver %s", bindIP)
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.TrimSpace(line) == nameserverEntry {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s does not list %s", b.path, bindIP)
+}
+
+// Cleanup restores the original resolv.conf
+func (b *ResolvConfBackend) Cleanup() error {
+	if b.original == nil {
+		return nil
+	}
+
+	b.logger.Info("Restoring original %s", b.path)
+	if err := os.WriteFile(b.path, b.original, 0644); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", b.path, err)
+	}
+	b.original = nil
+
+	b.logger.Info("✓ Restored original %s", b.path)
+	return b.journal.SetResolvConf(nil)
+}
@@ -0,0 +1,169 @@
+package resolver
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bilgehannal/reghost/internal/sysstate"
+	"github.com/bilgehannal/reghost/internal/utils"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+const (
+	// ResolvedLink is the dummy link reghost registers with systemd-resolved.
+	// systemd-resolved ignores DNS settings of the loopback interface.
+	ResolvedLink = "reghost0"
+	// resolvedStubAddress is the stub listener of systemd-resolved
+	resolvedStubAddress = "127.0.0.53"
+)
+
+// ResolvedBackend registers reghost with systemd-resolved as the DNS server
+// of a dummy link, with the domain suffixes of the active records as routing
+// domains. Only queries for those domains reach reghost.
+type ResolvedBackend struct {
+	runner  Runner
+	links   Links
+	logger  *utils.Logger
+	journal *sysstate.Journal
+	// created is set once the link exists
+	created bool
+}
+
+// NewResolvedBackend creates a systemd-resolved backend
+func NewResolvedBackend(runner Runner, links Links, logger *utils.Logger, journal *sysstate.Journal) *ResolvedBackend {
+	return &ResolvedBackend{
+		runner:  runner,
+		links:   links,
+		logger:  logger,
+		journal: journal,
+	}
+}
+
+// Name identifies the backend in logs
+func (b *ResolvedBackend) Name() string {
+	return "systemd-resolved"
+}
+
+// Configure creates the link if needed and sets its DNS server and routing
+// domains, unless systemd-resolved already has them
+func (b *ResolvedBackend) Configure(bindIP string, records []reghost.Record) error {
+	if err := b.ensureLink(); err != nil {
+		return err
+	}
+
+	domains := make([]string, 0)
+	for _, suffix := range DomainSuffixes(records) {
+		domains = append(domains, "~"+suffix)
+	}
+
+	servers, err := b.linkSetting("dns")
+	if err != nil {
+		return err
+	}
+	current, err := b.linkSetting("domain")
+	if err != nil {
+		return err
+	}
+	if slices.Equal(servers, []string{bindIP}) && slices.Equal(sorted(current), domains) {
+		return nil
+	}
+
+	if err := b.run("resolvectl", "dns", ResolvedLink, bindIP); err != nil {
+		return err
+	}
+	if err := b.run("resolvectl", append([]string{"domain", ResolvedLink}, domains...)...); err != nil {
+		return err
+	}
+	// Only the routing domains go to reghost, never other queries
+	if err := b.run("resolvectl", "default-route", ResolvedLink, "false"); err != nil {
+		return err
+	}
+
+	b.logger.Info("✓ systemd-resolved routes %v to %s via %s", domains, bindIP, ResolvedLink)
+	return nil
+}
+
+// Check reports an error unless systemd-resolved sends queries for the
+// link to bindIP
+func (b *ResolvedBackend) Check(bindIP string) error {
+	if !b.links.HasLink(ResolvedLink) {
+		return fmt.Errorf("link %s is missing", ResolvedLink)
+	}
+	servers, err := b.linkSetting("dns")
+	if err != nil {
+		return err
+	}
+	if !slices.Equal(servers, []string{bindIP}) {
+		return fmt.Errorf("systemd-resolved does not send queries for %s to %s", ResolvedLink, bindIP)
+	}
+	return nil
+}
+
+// FlushCache flushes the cache of systemd-resolved
+func (b *ResolvedBackend) FlushCache() error {
+	return b.run("resolvectl", "flush-caches")
+}
+
+// Cleanup deletes the link, which drops its settings in systemd-resolved
+func (b *ResolvedBackend) Cleanup() error {
+	if !b.created {
+		return nil
+	}
+
+	b.run("resolvectl", "revert", ResolvedLink)
+	if err := b.links.RemoveLink(ResolvedLink); err != nil {
+		return err
+	}
+	b.created = false
+
+	b.logger.Info("✓ Removed %s from systemd-resolved", ResolvedLink)
+	return b.journal.RemoveLink(ResolvedLink)
+}
+
+// ensureLink creates the dummy link unless it exists. The link is recorded
+// first, so that it is deleted after a crash.
+func (b *ResolvedBackend) ensureLink() error {
+	if b.links.HasLink(ResolvedLink) {
+		b.created = true
+		return nil
+	}
+
+	if err := b.journal.AddLink(ResolvedLink); err != nil {
+		return err
+	}
+	if err := b.links.AddDummyLink(ResolvedLink); err != nil {
+		b.journal.RemoveLink(ResolvedLink)
+		return err
+	}
+	b.created = true
+
+	b.logger.Info("Created link %s for systemd-resolved", ResolvedLink)
+	return nil
+}
+
+// linkSetting returns the values resolvectl shows for a setting of the link,
+// e.g. "Link 7 (reghost0): ~dev ~local" for domain
+func (b *ResolvedBackend) linkSetting(setting string) ([]string, error) {
+	output, err := b.runner.Run("resolvectl", setting, ResolvedLink)
+	if err != nil {
+		return nil, fmt.Errorf("resolvectl %s failed: %w (output: %s)", setting, err, strings.TrimSpace(string(output)))
+	}
+	_, values, _ := strings.Cut(string(output), ":")
+	return strings.Fields(values), nil
+}
+
+// run runs a command, including its output in the error
+func (b *ResolvedBackend) run(name string, args ...string) error {
+	if output, err := b.runner.Run(name, args...); err != nil {
+		return fmt.Errorf("%s %s failed: %w (output: %s)", name, strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// sorted returns a sorted copy of values
+func sorted(values []string) []string {
+	values = slices.Clone(values)
+	slices.Sort(values)
+	return values
+}
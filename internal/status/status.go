@@ -0,0 +1,69 @@
+package status
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bilgehannal/reghost/internal/dns"
+	"github.com/bilgehannal/reghost/internal/utils"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+const (
+	// DefaultPath is where reghostd publishes its status
+	DefaultPath = "/var/run/reghost/status.json"
+	// Interval is how often reghostd refreshes the status file
+	Interval = 10 * time.Second
+)
+
+// Status is the daemon state published for reghostctl
+type Status struct {
+	PID          int                    `json:"pid"`
+	StartedAt    time.Time              `json:"startedAt"`
+	UpdatedAt    time.Time              `json:"updatedAt"`
+	BindIP       string                 `json:"bindIP"`
+	ActiveRecord reghost.RecordSetNames `json:"activeRecord"`
+	Metrics      dns.MetricsSnapshot    `json:"metrics"`
+}
+
+// Stale reports whether the daemon has stopped refreshing the status
+func (s *Status) Stale(now time.Time) bool {
+	return now.Sub(s.UpdatedAt) > 3*Interval
+}
+
+// Write atomically replaces the status file
+func Write(path string, s *Status) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal status: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create status directory: %w", err)
+	}
+
+	if err := utils.WriteFileAtomic(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write status: %w", err)
+	}
+	return nil
+}
+
+// Read loads the status file
+func Read(path string) (*Status, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("reghostd is not running (no status at %s)", path)
+		}
+		return nil, fmt.Errorf("failed to read status: %w", err)
+	}
+
+	var s Status
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse status: %w", err)
+	}
+	return &s, nil
+}
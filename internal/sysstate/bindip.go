@@ -0,0 +1,40 @@
+package sysstate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bilgehannal/reghost/internal/utils"
+)
+
+// DefaultBindIPPath is where reghostd keeps the loopback address it picked,
+// so that resolvers configured with it, such as the dns setting of Docker's
+// daemon.json, keep working across restarts
+const DefaultBindIPPath = "/var/lib/reghost/bind-ip"
+
+// LoadBindIP reads the persisted bind address. It returns an empty string
+// if none is persisted yet.
+func LoadBindIP(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read bind IP: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// SaveBindIP persists the bind address
+func SaveBindIP(path, ip string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	if err := utils.WriteFileAtomic(path, []byte(ip+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write bind IP: %w", err)
+	}
+	return nil
+}
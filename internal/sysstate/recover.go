@@ -0,0 +1,239 @@
+package sysstate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bilgehannal/reghost/internal/hosts"
+	"github.com/bilgehannal/reghost/internal/utils"
+)
+
+// Network manages the loopback aliases and network links reghost adds
+type Network interface {
+	HasAlias(ip string) bool
+	RemoveAlias(ip string) error
+	HasLink(name string) bool
+	RemoveLink(name string) error
+}
+
+// Paths are the files reghostd changes. Only changes to them are undone,
+// whatever else a state file names.
+type Paths struct {
+	ResolvConf string
+	// ResolverDir holds the resolver files
+	ResolverDir string
+	HostsFiles  []string
+}
+
+// DefaultPaths returns the files reghostd changes, with hostsPath as the
+// hosts file of hosts sync mode
+func DefaultPaths(hostsPath string) Paths {
+	return Paths{
+		ResolvConf:  "/etc/resolv.conf",
+		ResolverDir: "/etc/resolver",
+		HostsFiles:  []string{hostsPath},
+	}
+}
+
+// allowsResolvConf reports whether path is the resolv.conf reghostd changes
+func (p Paths) allowsResolvConf(path string) bool {
+	return p.ResolvConf != "" && filepath.Clean(path) == filepath.Clean(p.ResolvConf)
+}
+
+// allowsResolverFile reports whether path is a file of the resolver
+// directory
+func (p Paths) allowsResolverFile(path string) bool {
+	return p.ResolverDir != "" && filepath.IsAbs(path) &&
+		filepath.Dir(filepath.Clean(path)) == filepath.Clean(p.ResolverDir)
+}
+
+// allowsHostsFile reports whether path is a hosts file reghostd maintains
+func (p Paths) allowsHostsFile(path string) bool {
+	return slices.ContainsFunc(p.HostsFiles, func(hosts string) bool {
+		return hosts != "" && filepath.Clean(path) == filepath.Clean(hosts)
+	})
+}
+
+// Leftover is a recorded system change that is still in place
+type Leftover struct {
+	Description string
+	// Fix undoes the change and removes it from the state
+	Fix func() error
+}
+
+// Leftovers returns the changes recorded in state that are still in place.
+// Changes that are already gone, and changes to files outside paths, are
+// dropped from state.
+func Leftovers(state *State, network Network, paths Paths) []Leftover {
+	var leftovers []Leftover
+
+	for _, ip := range slices.Clone(state.LoopbackAliases) {
+		if !network.HasAlias(ip) {
+			state.LoopbackAliases = removeItem(state.LoopbackAliases, ip)
+			continue
+		}
+		leftovers = append(leftovers, Leftover{
+			Description: fmt.Sprintf("loopback alias %s", ip),
+			Fix: func() error {
+				if err := network.RemoveAlias(ip); err != nil {
+					return err
+				}
+				state.LoopbackAliases = removeItem(state.LoopbackAliases, ip)
+				return nil
+			},
+		})
+	}
+
+	// Deleting a link also drops the DNS settings of systemd-resolved for it
+	for _, name := range slices.Clone(state.Links) {
+		if !network.HasLink(name) {
+			state.Links = removeItem(state.Links, name)
+			continue
+		}
+		leftovers = append(leftovers, Leftover{
+			Description: fmt.Sprintf("network link %s", name),
+			Fix: func() error {
+				if err := network.RemoveLink(name); err != nil {
+					return err
+				}
+				state.Links = removeItem(state.Links, name)
+				return nil
+			},
+		})
+	}
+
+	if backup := state.ResolvConf; backup != nil {
+		if !paths.allowsResolvConf(backup.Path) {
+			state.ResolvConf = nil
+		} else if content, err := os.ReadFile(backup.Path); err == nil && hasLine(content, backup.Nameserver) {
+			leftovers = append(leftovers, Leftover{
+				Description: fmt.Sprintf("'%s' in %s", backup.Nameserver, backup.Path),
+				Fix: func() error {
+					if err := restoreResolvConf(backup); err != nil {
+						return err
+					}
+					state.ResolvConf = nil
+					return nil
+				},
+			})
+		} else {
+			state.ResolvConf = nil
+		}
+	}
+
+	for _, path := range slices.Clone(state.ResolverFiles) {
+		if !paths.allowsResolverFile(path) || !utils.FileExists(path) {
+			state.ResolverFiles = removeItem(state.ResolverFiles, path)
+			continue
+		}
+		leftovers = append(leftovers, Leftover{
+			Description: fmt.Sprintf("resolver file %s", path),
+			Fix: func() error {
+				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+					return fmt.Errorf("failed to remove %s: %w", path, err)
+				}
+				state.ResolverFiles = removeItem(state.ResolverFiles, path)
+				return nil
+			},
+		})
+	}
+
+	for _, path := range slices.Clone(state.HostsFiles) {
+		if !paths.allowsHostsFile(path) {
+			state.HostsFiles = removeItem(state.HostsFiles, path)
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil || !hasLine(content, hosts.BeginMarker) {
+			state.HostsFiles = removeItem(state.HostsFiles, path)
+			continue
+		}
+		leftovers = append(leftovers, Leftover{
+			Description: fmt.Sprintf("managed block in %s", path),
+			Fix: func() error {
+				if err := utils.WriteFileAtomic(path, hosts.Render(content, nil), 0644); err != nil {
+					return err
+				}
+				state.HostsFiles = removeItem(state.HostsFiles, path)
+				return nil
+			},
+		})
+	}
+
+	return leftovers
+}
+
+// Repair undoes the changes left behind by a daemon that did not shut down
+// cleanly, as recorded in the state file at path. It returns the changes it
+// found. The state file is removed once all of them are undone, and kept
+// with the remaining ones otherwise. Only files in paths are changed. It
+// returns ErrRunning, and changes nothing, while that daemon still runs.
+func Repair(path string, network Network, paths Paths) ([]Leftover, error) {
+	state, err := Load(path)
+	if err != nil || state == nil {
+		return nil, err
+	}
+	if state.Running() {
+		return nil, fmt.Errorf("%w with pid %d", ErrRunning, state.PID)
+	}
+
+	leftovers := Leftovers(state, network, paths)
+	var errs []error
+	for _, leftover := range leftovers {
+		if err := leftover.Fix(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to undo %s: %w", leftover.Description, err))
+		}
+	}
+
+	if state.Empty() {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("failed to remove state: %w", err))
+		}
+	} else if err := save(path, state); err != nil {
+		errs = append(errs, err)
+	}
+	return leftovers, errors.Join(errs...)
+}
+
+// restoreResolvConf undoes the nameserver added to resolv.conf. The backup
+// is restored if nothing else changed the file since; otherwise only the
+// nameserver line is removed.
+func restoreResolvConf(backup *ResolvConfBackup) error {
+	content, err := os.ReadFile(backup.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", backup.Path, err)
+	}
+
+	restored := []byte(backup.Original)
+	if string(content) != backup.Nameserver+"\n"+backup.Original {
+		var lines []string
+		for _, line := range strings.Split(string(content), "\n") {
+			if strings.TrimSpace(line) != backup.Nameserver {
+				lines = append(lines, line)
+			}
+		}
+		restored = []byte(strings.Join(lines, "\n"))
+	}
+
+	// resolv.conf is often a symlink, so it is written in place
+	if err := os.WriteFile(backup.Path, restored, 0644); err != nil {
+		return fmt.Errorf("failed to restore %s: %w", backup.Path, err)
+	}
+	return nil
+}
+
+// hasLine reports whether content has a line equal to line, ignoring
+// surrounding whitespace
+func hasLine(content []byte, line string) bool {
+	for _, l := range bytes.Split(content, []byte("\n")) {
+		if string(bytes.TrimSpace(l)) == line {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,28 @@
+package sysstate
+
+import (
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// bootTime returns when the system booted, or the zero time where it is
+// unknown. macOS has no boot id, so a state from before a reboot is told
+// apart by this instead.
+func bootTime() time.Time {
+	tv, err := unix.SysctlTimeval("kern.boottime")
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(tv.Unix())
+}
+
+// processStartTime returns when a process started, or the zero time where it
+// is unknown
+func processStartTime(pid int) time.Time {
+	info, err := unix.SysctlKinfoProc("kern.proc.pid", pid)
+	if err != nil || info.Proc.P_starttime.Sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(info.Proc.P_starttime.Unix())
+}
@@ -0,0 +1,17 @@
+//go:build !darwin
+
+package sysstate
+
+import "time"
+
+// bootTime returns the zero time: elsewhere the boot id tells a state from
+// before a reboot apart
+func bootTime() time.Time {
+	return time.Time{}
+}
+
+// processStartTime returns the zero time: elsewhere the executable tells a
+// process reusing the pid apart
+func processStartTime(pid int) time.Time {
+	return time.Time{}
+}
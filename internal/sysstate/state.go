@@ -0,0 +1,304 @@
+package sysstate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bilgehannal/reghost/internal/utils"
+)
+
+// DefaultPath is where reghostd records the system changes it made. It is
+// kept outside /var/run so that it survives a reboot, like resolv.conf.
+const DefaultPath = "/var/lib/reghost/state.json"
+
+// ErrRunning is returned when the daemon that made the changes still runs
+var ErrRunning = errors.New("reghostd is running")
+
+// State records every change reghostd made to the system, so that they can
+// be undone after the daemon was killed or the machine lost power
+type State struct {
+	PID       int       `json:"pid"`
+	StartedAt time.Time `json:"startedAt"`
+	// BootID and Executable identify the process beyond its pid, which is
+	// reused after a reboot. They are empty where the system does not tell.
+	BootID     string `json:"bootID,omitempty"`
+	Executable string `json:"executable,omitempty"`
+	// LoopbackAliases are the addresses added to the loopback interface
+	LoopbackAliases []string `json:"loopbackAliases,omitempty"`
+	// Links are the network links created, such as the one systemd-resolved
+	// routes the reghost domains through
+	Links []string `json:"links,omitempty"`
+	// ResolvConf is set while a nameserver is added to resolv.conf
+	ResolvConf *ResolvConfBackup `json:"resolvConf,omitempty"`
+	// ResolverFiles are the macOS /etc/resolver files created
+	ResolverFiles []string `json:"resolverFiles,omitempty"`
+	// HostsFiles are the hosts files holding a managed block
+	HostsFiles []string `json:"hostsFiles,omitempty"`
+}
+
+// ResolvConfBackup is the content of resolv.conf before a nameserver was
+// added to it
+type ResolvConfBackup struct {
+	Path       string `json:"path"`
+	Nameserver string `json:"nameserver"`
+	Original   string `json:"original"`
+}
+
+// Empty reports whether no changes are recorded
+func (s *State) Empty() bool {
+	return len(s.LoopbackAliases) == 0 && len(s.Links) == 0 && s.ResolvConf == nil &&
+		len(s.ResolverFiles) == 0 && len(s.HostsFiles) == 0
+}
+
+// Running reports whether the process that recorded the state still runs.
+// A process that reuses the pid after a reboot, or runs another executable,
+// does not count.
+func (s *State) Running() bool {
+	if s.PID <= 0 || s.PID == os.Getpid() {
+		return false
+	}
+	if !processExists(s.PID) {
+		return false
+	}
+
+	if boot := bootID(); s.BootID != "" && boot != "" && s.BootID != boot {
+		return false
+	}
+	if exe := processExecutable(s.PID); s.Executable != "" && exe != "" && s.Executable != exe {
+		return false
+	}
+
+	// Where there is no boot id or executable, a process that started after
+	// the state was recorded, or a state from before the boot, is not the
+	// daemon that recorded it
+	if s.StartedAt.IsZero() {
+		return true
+	}
+	if boot := bootTime(); !boot.IsZero() && s.StartedAt.Before(boot) {
+		return false
+	}
+	if start := processStartTime(s.PID); !start.IsZero() && start.After(s.StartedAt) {
+		return false
+	}
+	return true
+}
+
+// bootID returns the id of the running boot, or "" where it is unknown
+func bootID() string {
+	data, err := os.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// processExecutable returns the executable of a process, or "" where it is
+// unknown. An executable replaced by an upgrade still counts as the same.
+func processExecutable(pid int) string {
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(exe, " (deleted)")
+}
+
+// Load reads a state file. It returns nil if there is none. Since the state
+// names files to change as root, a file that anyone but root could have
+// written is refused: it must be owned by root, or by the effective user
+// where that is not root, and have mode 0600.
+func Load(path string) (*State, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+	if err := checkTrusted(path, info); err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state: %w", err)
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse state %s: %w", path, err)
+	}
+	return &state, nil
+}
+
+// checkTrusted refuses a state file that others than root could have written
+func checkTrusted(path string, info os.FileInfo) error {
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("refusing state %s: not a regular file", path)
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return fmt.Errorf("refusing state %s: mode %04o, expected 0600", path, perm)
+	}
+	if owner, ok := fileOwner(info); ok && owner != 0 && owner != os.Geteuid() {
+		return fmt.Errorf("refusing state %s: owned by uid %d, expected root", path, owner)
+	}
+	return nil
+}
+
+// save atomically replaces a state file
+func save(path string, state *State) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	if err := utils.WriteFileAtomic(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	return nil
+}
+
+// Journal records the system changes of the running daemon. A change is
+// recorded before it is made, so that a crash in between leaves at most a
+// change to undo that was not made. All methods do nothing on a nil Journal.
+type Journal struct {
+	mu    sync.Mutex
+	path  string
+	state State
+}
+
+// NewJournal creates a journal for the running process writing to path
+func NewJournal(path string) *Journal {
+	return &Journal{
+		path: path,
+		state: State{
+			PID:        os.Getpid(),
+			StartedAt:  time.Now(),
+			BootID:     bootID(),
+			Executable: processExecutable(os.Getpid()),
+		},
+	}
+}
+
+// State returns a copy of the recorded changes
+func (j *Journal) State() State {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	state := j.state
+	state.LoopbackAliases = slices.Clone(j.state.LoopbackAliases)
+	state.Links = slices.Clone(j.state.Links)
+	state.ResolverFiles = slices.Clone(j.state.ResolverFiles)
+	state.HostsFiles = slices.Clone(j.state.HostsFiles)
+	return state
+}
+
+// AddLoopbackAlias records an address about to be added to the loopback
+// interface
+func (j *Journal) AddLoopbackAlias(ip string) error {
+	return j.update(func(s *State) { s.LoopbackAliases = addItem(s.LoopbackAliases, ip) })
+}
+
+// RemoveLoopbackAlias records an address removed from the loopback interface
+func (j *Journal) RemoveLoopbackAlias(ip string) error {
+	return j.update(func(s *State) { s.LoopbackAliases = removeItem(s.LoopbackAliases, ip) })
+}
+
+// AddLink records a network link about to be created
+func (j *Journal) AddLink(name string) error {
+	return j.update(func(s *State) { s.Links = addItem(s.Links, name) })
+}
+
+// RemoveLink records a network link deleted
+func (j *Journal) RemoveLink(name string) error {
+	return j.update(func(s *State) { s.Links = removeItem(s.Links, name) })
+}
+
+// SetResolvConf records the backup of resolv.conf taken before adding a
+// nameserver, or nil once it was restored
+func (j *Journal) SetResolvConf(backup *ResolvConfBackup) error {
+	return j.update(func(s *State) { s.ResolvConf = backup })
+}
+
+// AddResolverFile records a resolver file about to be created
+func (j *Journal) AddResolverFile(path string) error {
+	return j.update(func(s *State) { s.ResolverFiles = addItem(s.ResolverFiles, path) })
+}
+
+// RemoveResolverFile records a resolver file removed
+func (j *Journal) RemoveResolverFile(path string) error {
+	return j.update(func(s *State) { s.ResolverFiles = removeItem(s.ResolverFiles, path) })
+}
+
+// AddHostsFile records a hosts file about to get a managed block
+func (j *Journal) AddHostsFile(path string) error {
+	return j.update(func(s *State) { s.HostsFiles = addItem(s.HostsFiles, path) })
+}
+
+// RemoveHostsFile records a hosts file whose managed block was removed
+func (j *Journal) RemoveHostsFile(path string) error {
+	return j.update(func(s *State) { s.HostsFiles = removeItem(s.HostsFiles, path) })
+}
+
+// Close removes the state file after a clean shutdown. If some changes
+// could not be undone, the file is kept so the next start undoes them.
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if !j.state.Empty() {
+		return save(j.path, &j.state)
+	}
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove state: %w", err)
+	}
+	return nil
+}
+
+// update applies a change to the state and writes it, unless it changed
+// nothing
+func (j *Journal) update(change func(*State)) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	before, _ := json.Marshal(j.state)
+	change(&j.state)
+	if after, _ := json.Marshal(j.state); string(before) == string(after) {
+		return nil
+	}
+	return save(j.path, &j.state)
+}
+
+// addItem appends item to items unless it is already there
+func addItem(items []string, item string) []string {
+	if slices.Contains(items, item) {
+		return items
+	}
+	return append(items, item)
+}
+
+// removeItem returns items without item
+func removeItem(items []string, item string) []string {
+	return slices.DeleteFunc(items, func(other string) bool { return other == item })
+}
@@ -188,8 +188,11 @@ func (l *Logger) Error(format string, args ...interface{}) {
 	l.log("ERROR", format, args...)
 }
 
-// log writes a formatted log message
+// log writes a formatted log message. A nil logger discards it.
 func (l *Logger) log(level, format string, args ...interface{}) {
+	if l == nil {
+		return
+	}
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
 	message := fmt.Sprintf(format, args...)
 	logLine := fmt.Sprintf("[%s] [%s] %s\n", timestamp, level, message)
@@ -9,12 +9,15 @@ import (
 	"github.com/fsnotify/fsnotify"
 )
 
-// Watcher watches the configuration file for changes
+// Watcher watches the configuration file, its fragment directory, included
+// files and registered project files for changes
 type Watcher struct {
 	configPath string
 	logger     *utils.Logger
 	watcher    *fsnotify.Watcher
 	onChange   func(*config.Config) error
+	patterns   []string
+	dirs       map[string]bool
 }
 
 // NewWatcher creates a new file watcher
@@ -29,6 +32,7 @@ func NewWatcher(configPath string, logger *utils.Logger, onChange func(*config.C
 		logger:     logger,
 		watcher:    fw,
 		onChange:   onChange,
+		dirs:       make(map[string]bool),
 	}
 
 	// Watch the config file
@@ -41,10 +45,50 @@ func NewWatcher(configPath string, logger *utils.Logger, onChange func(*config.C
 	if err := w.watcher.Add(dir); err != nil {
 		w.logger.Warn("Failed to watch config directory: %v", err)
 	}
+	w.dirs[dir] = true
+
+	// Watch the fragment directory and the directories of included and
+	// project files
+	cfg, _ := config.Load(configPath)
+	w.watchIncludes(cfg)
 
 	return w, nil
 }
 
+// watchIncludes watches the directories that may hold fragment or project
+// files. Directories that do not exist yet are picked up on a later reload.
+func (w *Watcher) watchIncludes(cfg *config.Config) {
+	w.patterns = config.WatchPatterns(w.configPath, cfg)
+	for _, pattern := range w.patterns {
+		dir := filepath.Dir(pattern)
+		if w.dirs[dir] {
+			continue
+		}
+		if err := w.watcher.Add(dir); err != nil {
+			continue
+		}
+		w.dirs[dir] = true
+		w.logger.Info("Watching config files in: %s", dir)
+	}
+}
+
+// isConfigFile reports whether a path is the config file, a fragment or a
+// project file
+func (w *Watcher) isConfigFile(path string) bool {
+	if path == w.configPath || filepath.Base(path) == filepath.Base(w.configPath) {
+		return true
+	}
+	if path == config.FragmentDir(w.configPath) {
+		return true
+	}
+	for _, pattern := range w.patterns {
+		if matched, _ := filepath.Match(pattern, path); matched {
+			return true
+		}
+	}
+	return false
+}
+
 // Start starts watching for file changes
 func (w *Watcher) Start() {
 	go w.watch()
@@ -61,13 +105,17 @@ func (w *Watcher) watch() {
 				return
 			}
 
-			// Check if the event is for our config file
-			if event.Name != w.configPath && filepath.Base(event.Name) != filepath.Base(w.configPath) {
+			// Check if the event is for our config file or a fragment
+			if !w.isConfigFile(event.Name) {
 				continue
 			}
 
-			// Handle write and create events (covers atomic renames too)
-			if event.Op&fsnotify.Write == fsnotify.Write || event.Op&fsnotify.Create == fsnotify.Create {
+			// Handle write and create events (covers atomic renames too).
+			// Removed fragments drop their record sets, while a removed
+			// main file is ignored until it is written again.
+			changed := event.Op&(fsnotify.Write|fsnotify.Create) != 0
+			removed := event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 && filepath.Base(event.Name) != filepath.Base(w.configPath)
+			if changed || removed {
 				w.logger.Info("Config file changed, reloading...")
 				if err := w.reloadConfig(); err != nil {
 					w.logger.Error("Failed to reload config: %v", err)
@@ -90,6 +138,9 @@ func (w *Watcher) reloadConfig() error {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
+	// Included files may have changed
+	w.watchIncludes(cfg)
+
 	if w.onChange != nil {
 		if err := w.onChange(cfg); err != nil {
 			return fmt.Errorf("onChange callback failed: %w", err)
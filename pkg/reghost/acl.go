@@ -0,0 +1,46 @@
+package reghost
+
+import "fmt"
+
+// ACL restricts which clients may query the server. Clients outside Allow
+// are answered with REFUSED.
+type ACL struct {
+	Allow []string `yaml:"allow"`
+}
+
+// View answers clients from the listed networks with a specific record set
+// instead of the active one. Records of dynamic updates and providers are
+// served in every view. The first view matching a client wins.
+type View struct {
+	Name      string   `yaml:"name"`
+	Clients   []string `yaml:"clients"`
+	RecordSet string   `yaml:"recordSet"`
+}
+
+// validate checks the ACL networks
+func (a *ACL) validate() error {
+	if len(a.Allow) == 0 {
+		return fmt.Errorf("acl.allow must list at least one network")
+	}
+	if _, err := ParseNetworks(a.Allow); err != nil {
+		return fmt.Errorf("invalid acl.allow: %w", err)
+	}
+	return nil
+}
+
+// validate checks the view against the declared record sets
+func (v *View) validate(records map[string][]Record) error {
+	if v.Name == "" {
+		return fmt.Errorf("view name is empty")
+	}
+	if len(v.Clients) == 0 {
+		return fmt.Errorf("view '%s' must list at least one client network", v.Name)
+	}
+	if _, err := ParseNetworks(v.Clients); err != nil {
+		return fmt.Errorf("invalid clients in view '%s': %w", v.Name, err)
+	}
+	if _, exists := records[v.RecordSet]; !exists {
+		return fmt.Errorf("view '%s' references unknown record set '%s'", v.Name, v.RecordSet)
+	}
+	return nil
+}
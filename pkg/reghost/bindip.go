@@ -0,0 +1,23 @@
+package reghost
+
+import (
+	"fmt"
+	"net"
+)
+
+// ValidateBindIP checks that ip can be used as the address of the DNS
+// server: an IPv4 address in 127.0.0.0/8 other than 127.0.0.1, which the
+// daemon adds to and removes from the loopback interface
+func ValidateBindIP(ip string) error {
+	parsed := net.ParseIP(ip).To4()
+	if parsed == nil {
+		return fmt.Errorf("bindIP '%s' is not an IPv4 address", ip)
+	}
+	if parsed[0] != 127 {
+		return fmt.Errorf("bindIP '%s' is not in 127.0.0.0/8", ip)
+	}
+	if parsed.Equal(net.IPv4(127, 0, 0, 1)) {
+		return fmt.Errorf("bindIP must not be 127.0.0.1")
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package reghost
+
+import "fmt"
+
+const (
+	// DefaultDNSSECKeyDir is where zone signing keys are stored by default
+	DefaultDNSSECKeyDir = "/var/lib/reghost/keys"
+	// DefaultDNSSECAlgorithm is the signing algorithm used by default
+	DefaultDNSSECAlgorithm = "ECDSAP256SHA256"
+)
+
+// supportedDNSSECAlgorithms maps algorithm names to their key size in bits
+var supportedDNSSECAlgorithms = map[string]int{
+	"RSASHA256":       2048,
+	"ECDSAP256SHA256": 256,
+	"ECDSAP384SHA384": 384,
+	"ED25519":         256,
+}
+
+// DNSSEC enables online signing of the configured zones. Keys are generated
+// on first use and stored in KeyDir.
+type DNSSEC struct {
+	KeyDir    string `yaml:"keyDir,omitempty"`
+	Algorithm string `yaml:"algorithm,omitempty"`
+	// NSEC3 selects NSEC3 instead of NSEC for negative answers
+	NSEC3 bool `yaml:"nsec3,omitempty"`
+}
+
+// KeyDirectory returns the key directory, falling back to the default
+func (d *DNSSEC) KeyDirectory() string {
+	if d.KeyDir == "" {
+		return DefaultDNSSECKeyDir
+	}
+	return d.KeyDir
+}
+
+// AlgorithmName returns the signing algorithm, falling back to the default
+func (d *DNSSEC) AlgorithmName() string {
+	if d.Algorithm == "" {
+		return DefaultDNSSECAlgorithm
+	}
+	return d.Algorithm
+}
+
+// KeyBits returns the key size for the signing algorithm
+func (d *DNSSEC) KeyBits() int {
+	return supportedDNSSECAlgorithms[d.AlgorithmName()]
+}
+
+// validate checks the DNSSEC settings
+func (d *DNSSEC) validate(zones []Zone) error {
+	if _, ok := supportedDNSSECAlgorithms[d.AlgorithmName()]; !ok {
+		return fmt.Errorf("unsupported dnssec algorithm '%s'", d.Algorithm)
+	}
+	if len(zones) == 0 {
+		return fmt.Errorf("dnssec requires at least one zone")
+	}
+	return nil
+}
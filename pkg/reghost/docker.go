@@ -0,0 +1,49 @@
+package reghost
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Defaults of the Docker provider
+const (
+	DefaultDockerSocket = "/var/run/docker.sock"
+	DefaultDockerSuffix = "docker"
+)
+
+// Docker serves records for the running containers of a Docker Engine.
+// Each container resolves as <name>.<suffix>, compose services as
+// <service>.<project>.<suffix>, and the comma-separated domains of a
+// reghost.domain label as they are.
+type Docker struct {
+	Socket string `yaml:"socket,omitempty"`
+	Suffix string `yaml:"suffix,omitempty"`
+}
+
+// SocketPath returns the Unix socket of the Docker Engine API
+func (d *Docker) SocketPath() string {
+	if d.Socket != "" {
+		return d.Socket
+	}
+	return DefaultDockerSocket
+}
+
+// DomainSuffix returns the domain container names are served under
+func (d *Docker) DomainSuffix() string {
+	if d.Suffix != "" {
+		return strings.ToLower(d.Suffix)
+	}
+	return DefaultDockerSuffix
+}
+
+// validate checks the Docker provider settings
+func (d *Docker) validate() error {
+	if d.Socket != "" && !filepath.IsAbs(d.Socket) {
+		return fmt.Errorf("docker.socket must be an absolute path, got '%s'", d.Socket)
+	}
+	if strings.HasPrefix(d.Suffix, ".") || strings.HasSuffix(d.Suffix, ".") || strings.ContainsAny(d.Suffix, " \t") {
+		return fmt.Errorf("invalid docker.suffix '%s'", d.Suffix)
+	}
+	return nil
+}
@@ -1,15 +1,34 @@
 package reghost
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // Configuration errors
 var (
 	ErrMissingActiveRecord  = fmt.Errorf("activeRecord is missing")
 	ErrNoRecords            = fmt.Errorf("no records defined")
 	ErrActiveRecordNotFound = fmt.Errorf("activeRecord does not exist in records")
+	ErrNoForwarders         = fmt.Errorf("outOfZone is 'forward' but no forwarders are defined")
 )
 
-// ErrEmptyRecordSet indicates a record set has no records
+// ErrNotFound indicates that a record set, record or other named item does
+// not exist
+type ErrNotFound struct {
+	Message string
+}
+
+func (e *ErrNotFound) Error() string {
+	return e.Message
+}
+
+// NotFound returns an ErrNotFound with a formatted message
+func NotFound(format string, args ...interface{}) error {
+	return &ErrNotFound{Message: fmt.Sprintf(format, args...)}
+}
+
+// ErrEmptyRecordSet indicates an active record set has no records
 type ErrEmptyRecordSet struct {
 	Name string
 }
@@ -28,3 +47,32 @@ type ErrInvalidRecord struct {
 func (e *ErrInvalidRecord) Error() string {
 	return fmt.Sprintf("invalid record in '%s' at index %d: %s", e.RecordSet, e.Index, e.Reason)
 }
+
+// ErrInvalidZone indicates an invalid zone declaration
+type ErrInvalidZone struct {
+	Name   string
+	Reason string
+}
+
+func (e *ErrInvalidZone) Error() string {
+	return fmt.Sprintf("invalid zone '%s': %s", e.Name, e.Reason)
+}
+
+// ErrInvalidTSIGKey indicates an invalid TSIG key declaration
+type ErrInvalidTSIGKey struct {
+	Name   string
+	Reason string
+}
+
+func (e *ErrInvalidTSIGKey) Error() string {
+	return fmt.Sprintf("invalid TSIG key '%s': %s", e.Name, e.Reason)
+}
+
+// ErrExtendsCycle indicates record sets that inherit from each other
+type ErrExtendsCycle struct {
+	Path []string
+}
+
+func (e *ErrExtendsCycle) Error() string {
+	return fmt.Sprintf("record set inheritance cycle: %s", strings.Join(e.Path, " -> "))
+}
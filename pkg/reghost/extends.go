@@ -0,0 +1,193 @@
+package reghost
+
+import (
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// rawConfig has the fields of Config without its YAML methods
+type rawConfig Config
+
+// UnmarshalYAML decodes the config. A record set is either a list of records
+// or a mapping with "extends" (the sets it inherits from) and "records".
+func (c *Config) UnmarshalYAML(value *yaml.Node) error {
+	value, extends, err := extractExtends(value)
+	if err != nil {
+		return err
+	}
+
+	var raw rawConfig
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+
+	*c = Config(raw)
+	c.SetActive(c.ActiveRecords)
+	if len(extends) > 0 {
+		c.Extends = extends
+	}
+	return nil
+}
+
+// MarshalYAML encodes the config, writing record sets that inherit from
+// other sets in the mapping form
+func (c Config) MarshalYAML() (interface{}, error) {
+	c.SetActive(c.Active())
+
+	var node yaml.Node
+	if err := node.Encode(rawConfig(c)); err != nil {
+		return nil, err
+	}
+
+	records := mappingValue(&node, "records")
+	if records == nil || len(c.Extends) == 0 {
+		return &node, nil
+	}
+
+	for i := 0; i+1 < len(records.Content); i += 2 {
+		parents := c.Extends[records.Content[i].Value]
+		if len(parents) == 0 {
+			continue
+		}
+
+		var extends yaml.Node
+		if err := extends.Encode(parents); err != nil {
+			return nil, err
+		}
+		records.Content[i+1] = &yaml.Node{
+			Kind: yaml.MappingNode,
+			Tag:  "!!map",
+			Content: []*yaml.Node{
+				{Kind: yaml.ScalarNode, Tag: "!!str", Value: "extends"},
+				&extends,
+				{Kind: yaml.ScalarNode, Tag: "!!str", Value: "records"},
+				records.Content[i+1],
+			},
+		}
+	}
+	return &node, nil
+}
+
+// extractExtends returns a copy of the config node in which every record set
+// in mapping form is replaced by its records, along with the inherited sets
+// of each record set. The original node is left untouched.
+func extractExtends(value *yaml.Node) (*yaml.Node, map[string][]string, error) {
+	if value.Kind != yaml.MappingNode {
+		return value, nil, nil
+	}
+
+	root := *value
+	root.Content = append([]*yaml.Node(nil), value.Content...)
+
+	var extends map[string][]string
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "records" || root.Content[i+1].Kind != yaml.MappingNode {
+			continue
+		}
+
+		records := *root.Content[i+1]
+		records.Content = append([]*yaml.Node(nil), records.Content...)
+		root.Content[i+1] = &records
+
+		for j := 0; j+1 < len(records.Content); j += 2 {
+			name := records.Content[j].Value
+			set := records.Content[j+1]
+			if set.Kind != yaml.MappingNode {
+				continue
+			}
+
+			list := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+			for k := 0; k+1 < len(set.Content); k += 2 {
+				switch key := set.Content[k].Value; key {
+				case "extends":
+					var parents RecordSetNames
+					if err := set.Content[k+1].Decode(&parents); err != nil {
+						return nil, nil, fmt.Errorf("record set '%s': invalid extends: %w", name, err)
+					}
+					if extends == nil {
+						extends = make(map[string][]string)
+					}
+					extends[name] = parents
+				case "records":
+					list = set.Content[k+1]
+				default:
+					return nil, nil, fmt.Errorf("record set '%s': unknown key '%s'", name, key)
+				}
+			}
+			records.Content[j+1] = list
+		}
+	}
+
+	return &root, extends, nil
+}
+
+// mappingValue returns the value of key in a mapping node, or nil
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// resolveRecordSet returns the records of a set followed by the records it
+// inherits, each annotated with the set that defines it. Local rules take
+// precedence over inherited ones, and earlier parents over later ones.
+func (c *Config) resolveRecordSet(name string, path []string) ([]Record, error) {
+	for i, visited := range path {
+		if visited == name {
+			cycle := append(append([]string(nil), path[i:]...), name)
+			return nil, &ErrExtendsCycle{Path: cycle}
+		}
+	}
+
+	local := make([]Record, 0, len(c.Records[name]))
+	for _, record := range c.Records[name] {
+		record.Set = name
+		local = append(local, record)
+	}
+
+	path = append(append([]string(nil), path...), name)
+	layers := [][]Record{local}
+	for _, parent := range c.Extends[name] {
+		if _, exists := c.Records[parent]; !exists {
+			return nil, fmt.Errorf("record set '%s' extends unknown record set '%s'", name, parent)
+		}
+		inherited, err := c.resolveRecordSet(parent, path)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, inherited)
+	}
+
+	return mergeLayers(layers), nil
+}
+
+// validateExtends checks that every inherited set exists and that
+// inheritance has no cycles
+func (c *Config) validateExtends() error {
+	names := make([]string, 0, len(c.Extends))
+	for name := range c.Extends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, exists := c.Records[name]; !exists {
+			return fmt.Errorf("extends declared for unknown record set '%s'", name)
+		}
+		if _, err := c.resolveRecordSet(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package reghost
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// DefaultHostsPath is the hosts file maintained in hosts sync mode
+const DefaultHostsPath = "/etc/hosts"
+
+// HostsSync makes the daemon keep the exact-match records of the active
+// record sets in a managed block of a hosts file, for machines where the
+// system resolver cannot be pointed at reghost. Regex rules cannot be
+// written to a hosts file and are left out. The DNS server is only started
+// as well when DNS is set.
+type HostsSync struct {
+	Path string `yaml:"path,omitempty"`
+	DNS  bool   `yaml:"dns,omitempty"`
+}
+
+// HostsPath returns the hosts file to maintain. It is the default one on a
+// nil HostsSync.
+func (h *HostsSync) HostsPath() string {
+	if h != nil && h.Path != "" {
+		return h.Path
+	}
+	return DefaultHostsPath
+}
+
+// validate checks the hosts sync settings
+func (h *HostsSync) validate() error {
+	if h.Path != "" && !filepath.IsAbs(h.Path) {
+		return fmt.Errorf("hostsSync.path must be an absolute path, got '%s'", h.Path)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package reghost
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RecordSetNames is an ordered list of record set names. In YAML it is
+// written as a single name or as a list of names.
+type RecordSetNames []string
+
+// UnmarshalYAML accepts either a scalar or a sequence of names
+func (n *RecordSetNames) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	if err := unmarshal(&single); err == nil {
+		if single == "" {
+			*n = nil
+		} else {
+			*n = RecordSetNames{single}
+		}
+		return nil
+	}
+
+	var list []string
+	if err := unmarshal(&list); err != nil {
+		return fmt.Errorf("activeRecord must be a record set name or a list of names")
+	}
+	*n = list
+	return nil
+}
+
+// MarshalYAML writes a single name as a scalar so existing configs keep
+// their shape
+func (n RecordSetNames) MarshalYAML() (interface{}, error) {
+	if len(n) == 1 {
+		return n[0], nil
+	}
+	return []string(n), nil
+}
+
+// Contains reports whether the list holds the named set
+func (n RecordSetNames) Contains(name string) bool {
+	return n.Index(name) >= 0
+}
+
+// Index returns the position of the named set, or -1
+func (n RecordSetNames) Index(name string) int {
+	for i, existing := range n {
+		if existing == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// String joins the names in precedence order
+func (n RecordSetNames) String() string {
+	return strings.Join(n, ", ")
+}
+
+// Activate returns the names with name pushed on top, where it takes
+// precedence over all other sets. A set that is already active is moved.
+func (n RecordSetNames) Activate(name string) RecordSetNames {
+	layers := RecordSetNames{name}
+	for _, existing := range n {
+		if existing != name {
+			layers = append(layers, existing)
+		}
+	}
+	return layers
+}
+
+// Deactivate returns the names without name
+func (n RecordSetNames) Deactivate(name string) RecordSetNames {
+	var layers RecordSetNames
+	for _, existing := range n {
+		if existing != name {
+			layers = append(layers, existing)
+		}
+	}
+	return layers
+}
+
+// mergeLayers concatenates layers of records in precedence order. Rules
+// whose domain is already defined by a layer with higher precedence are
+// shadowed and left out.
+func mergeLayers(layers [][]Record) []Record {
+	var merged []Record
+	shadowed := make(map[string]bool)
+	for _, layer := range layers {
+		var defined []string
+		for _, record := range layer {
+			key := layerKey(record.Domain)
+			if shadowed[key] {
+				continue
+			}
+			defined = append(defined, key)
+			merged = append(merged, record)
+		}
+		for _, key := range defined {
+			shadowed[key] = true
+		}
+	}
+	return merged
+}
+
+// layerKey normalizes a domain for comparing rules across sets
+func layerKey(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(domain, "."))
+}
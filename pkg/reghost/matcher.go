@@ -39,6 +39,12 @@ func (m *Matcher) compilePatterns() {
 
 // Match finds the IP address for a given domain
 func (m *Matcher) Match(domain string) (string, bool) {
+	record, ok := m.MatchRecord(domain)
+	return record.IP, ok
+}
+
+// MatchRecord finds the first record matching a given domain
+func (m *Matcher) MatchRecord(domain string) (Record, bool) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
@@ -58,18 +64,18 @@ func (m *Matcher) Match(domain string) (string, bool) {
 		}
 
 		if recordDomain == domain {
-			return record.IP, true
+			return record, true
 		}
 
 		// Try regex match if it's a regex pattern
 		if re, ok := m.regexCache[record.Domain]; ok {
 			if re.MatchString(domain) {
-				return record.IP, true
+				return record, true
 			}
 		}
 	}
 
-	return "", false
+	return Record{}, false
 }
 
 // Update replaces the current records with new ones
@@ -104,3 +110,35 @@ func (m *Matcher) GetRecords() []Record {
 	copy(records, m.records)
 	return records
 }
+
+// Enumerate returns the effective record of every name that can be listed:
+// the exact-match domains plus any sample hostnames that match a rule.
+// Regex rules cannot be enumerated and are only represented through samples.
+// Each name is resolved through Match, so shadowed rules are left out.
+func (m *Matcher) Enumerate(samples []string) []Record {
+	m.mu.RLock()
+	names := make([]string, 0, len(m.records)+len(samples))
+	for _, record := range m.records {
+		if strings.HasPrefix(record.Domain, "^") {
+			continue
+		}
+		names = append(names, record.Domain)
+	}
+	m.mu.RUnlock()
+	names = append(names, samples...)
+
+	seen := make(map[string]bool)
+	var records []Record
+	for _, name := range names {
+		fqdn := Fqdn(name)
+		if seen[fqdn] {
+			continue
+		}
+		seen[fqdn] = true
+
+		if ip, ok := m.Match(fqdn); ok {
+			records = append(records, Record{Domain: fqdn, IP: ip})
+		}
+	}
+	return records
+}
@@ -0,0 +1,49 @@
+package reghost
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ProjectSetPrefix namespaces the record sets of registered projects
+const ProjectSetPrefix = "project/"
+
+// Project is a directory holding a project-level .reghost.yml whose records
+// are served as the record set "project/<name>"
+type Project struct {
+	Name string `yaml:"name"`
+	Path string `yaml:"path"`
+}
+
+// SetName returns the namespaced record set name of the project
+func (p *Project) SetName() string {
+	return ProjectSetPrefix + p.Name
+}
+
+// isProjectSet reports whether name is the record set of a registered project
+func (c *Config) isProjectSet(name string) bool {
+	for i := range c.Projects {
+		if c.Projects[i].SetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// validateProjects checks the registered projects
+func validateProjects(projects []Project) error {
+	seen := make(map[string]bool)
+	for _, project := range projects {
+		if project.Name == "" || strings.ContainsAny(project.Name, "/ ") {
+			return fmt.Errorf("invalid project name '%s'", project.Name)
+		}
+		if project.Path == "" {
+			return fmt.Errorf("project '%s' has no path", project.Name)
+		}
+		if seen[project.Name] {
+			return fmt.Errorf("project '%s' is registered more than once", project.Name)
+		}
+		seen[project.Name] = true
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package reghost
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// DefaultExecInterval is how often an exec provider runs its command
+const DefaultExecInterval = time.Minute
+
+// Layer names that providers cannot use
+var reservedProviderNames = map[string]bool{"update": true, "docker": true}
+
+// Provider is a source of records that change while the daemon runs, such
+// as a directory of files, a command or the containers of a Docker Engine.
+// The daemon serves the records of each provider as a layer of its own,
+// below the config file and the records of dynamic updates.
+//
+// The config file is not a provider: besides its records it holds the
+// zones, keys, views and server settings that a reload applies together,
+// and a file that fails to validate keeps the previous config in place as
+// a whole.
+type Provider interface {
+	// Name names the provider and its layer
+	Name() string
+	// Run calls update with the complete set of records of the provider
+	// whenever it changes, until ctx is canceled. Records are annotated
+	// with the provider name as their set.
+	Run(ctx context.Context, update func([]Record)) error
+}
+
+// ProviderSource declares a built-in provider. Exactly one of Dir and Exec
+// is set. Providers take precedence in the order they are listed, and all of
+// them over the Docker provider.
+type ProviderSource struct {
+	Name string `yaml:"name"`
+	// Dir is a directory of record files, read in name order. The format
+	// of a file follows its extension: .json, .hosts, .conf (dnsmasq) or
+	// .zone.
+	Dir string `yaml:"dir,omitempty"`
+	// Exec is a command and its arguments printing records as a JSON
+	// array, in the format of 'reghostctl export -f json'
+	Exec []string `yaml:"exec,omitempty"`
+	// Interval is how often the command runs, e.g. 30s
+	Interval string `yaml:"interval,omitempty"`
+}
+
+// RunInterval returns how often the command of an exec provider runs
+func (p *ProviderSource) RunInterval() time.Duration {
+	if interval, err := time.ParseDuration(p.Interval); err == nil && interval > 0 {
+		return interval
+	}
+	return DefaultExecInterval
+}
+
+// validateProviders checks the provider declarations
+func validateProviders(sources []ProviderSource) error {
+	names := make(map[string]bool)
+	for i := range sources {
+		p := &sources[i]
+		if p.Name == "" {
+			return fmt.Errorf("provider at index %d has no name", i)
+		}
+		if names[p.Name] || reservedProviderNames[p.Name] {
+			return fmt.Errorf("provider name '%s' is already in use", p.Name)
+		}
+		names[p.Name] = true
+
+		if (p.Dir == "") == (len(p.Exec) == 0) {
+			return fmt.Errorf("provider '%s' needs exactly one of dir and exec", p.Name)
+		}
+		if p.Dir != "" && !filepath.IsAbs(p.Dir) {
+			return fmt.Errorf("provider '%s': dir must be an absolute path, got '%s'", p.Name, p.Dir)
+		}
+		if p.Interval != "" {
+			if p.Dir != "" {
+				return fmt.Errorf("provider '%s': interval only applies to exec", p.Name)
+			}
+			if interval, err := time.ParseDuration(p.Interval); err != nil || interval <= 0 {
+				return fmt.Errorf("provider '%s': invalid interval '%s'", p.Name, p.Interval)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package reghost
+
+import "fmt"
+
+// Default client prefix lengths used to group clients for rate limiting
+const (
+	DefaultIPv4Prefix = 24
+	DefaultIPv6Prefix = 56
+)
+
+// RateLimit throttles clients before their queries are processed or logged.
+// Clients are grouped by network prefix, and each group gets a token bucket
+// refilled at QueriesPerSecond and holding up to Burst tokens.
+//
+// ResponsesPerSecond enables response rate limiting (RRL): identical UDP
+// responses to the same client group beyond this rate are dropped, except
+// every Slip-th one, which is sent truncated so that legitimate clients retry
+// over TCP. A zero Slip drops all of them.
+type RateLimit struct {
+	QueriesPerSecond   float64 `yaml:"queriesPerSecond,omitempty"`
+	Burst              int     `yaml:"burst,omitempty"`
+	ResponsesPerSecond float64 `yaml:"responsesPerSecond,omitempty"`
+	Slip               int     `yaml:"slip,omitempty"`
+	IPv4Prefix         int     `yaml:"ipv4Prefix,omitempty"`
+	IPv6Prefix         int     `yaml:"ipv6Prefix,omitempty"`
+}
+
+// QueryBurst returns the query bucket size, defaulting to one second of queries
+func (r *RateLimit) QueryBurst() int {
+	if r.Burst > 0 {
+		return r.Burst
+	}
+	return int(r.QueriesPerSecond + 0.5)
+}
+
+// PrefixLengths returns the prefix lengths used to group IPv4 and IPv6 clients
+func (r *RateLimit) PrefixLengths() (int, int) {
+	v4, v6 := r.IPv4Prefix, r.IPv6Prefix
+	if v4 == 0 {
+		v4 = DefaultIPv4Prefix
+	}
+	if v6 == 0 {
+		v6 = DefaultIPv6Prefix
+	}
+	return v4, v6
+}
+
+// validate checks the rate limit settings
+func (r *RateLimit) validate() error {
+	if r.QueriesPerSecond < 0 || r.ResponsesPerSecond < 0 {
+		return fmt.Errorf("rateLimit rates must not be negative")
+	}
+	if r.QueriesPerSecond == 0 && r.ResponsesPerSecond == 0 {
+		return fmt.Errorf("rateLimit requires queriesPerSecond or responsesPerSecond")
+	}
+	if r.Burst < 0 || r.Slip < 0 {
+		return fmt.Errorf("rateLimit burst and slip must not be negative")
+	}
+	if r.IPv4Prefix < 0 || r.IPv4Prefix > 32 {
+		return fmt.Errorf("rateLimit.ipv4Prefix must be between 1 and 32, or 0 for the default of %d", DefaultIPv4Prefix)
+	}
+	if r.IPv6Prefix < 0 || r.IPv6Prefix > 128 {
+		return fmt.Errorf("rateLimit.ipv6Prefix must be between 1 and 128, or 0 for the default of %d", DefaultIPv6Prefix)
+	}
+	return nil
+}
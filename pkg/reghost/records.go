@@ -0,0 +1,65 @@
+package reghost
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// derivedIDLength is the number of hex digits of a derived record ID
+const derivedIDLength = 8
+
+// RecordID returns the ID of a record: its explicit id, or else a hash of its
+// domain and IP. A derived ID changes when the record is edited.
+func (r Record) RecordID() string {
+	if r.ID != "" {
+		return r.ID
+	}
+	sum := sha256.Sum256([]byte(r.Domain + "\x00" + r.IP))
+	return hex.EncodeToString(sum[:])[:derivedIDLength]
+}
+
+// SameRecord reports whether two records hold the same rule, ignoring the
+// set they came from
+func SameRecord(a, b Record) bool {
+	return a.ID == b.ID && a.Domain == b.Domain && a.IP == b.IP
+}
+
+// SameDomain reports whether two domains are equal, ignoring case and the
+// trailing dot
+func SameDomain(a, b string) bool {
+	return Fqdn(a) == Fqdn(b)
+}
+
+// UpsertRecord replaces the records for the record's domain with the record,
+// keeping the position of the first one, or appends it when there is none
+func UpsertRecord(records []Record, record Record) []Record {
+	result := make([]Record, 0, len(records)+1)
+	replaced := false
+	for _, existing := range records {
+		if !SameDomain(existing.Domain, record.Domain) {
+			result = append(result, existing)
+			continue
+		}
+		if !replaced {
+			result = append(result, record)
+			replaced = true
+		}
+	}
+	if !replaced {
+		result = append(result, record)
+	}
+	return result
+}
+
+// RemoveRecords removes the records for a domain. When ip is not empty only
+// records pointing to that IP are removed.
+func RemoveRecords(records []Record, domain, ip string) []Record {
+	result := make([]Record, 0, len(records))
+	for _, existing := range records {
+		if SameDomain(existing.Domain, domain) && (ip == "" || existing.IP == ip) {
+			continue
+		}
+		result = append(result, existing)
+	}
+	return result
+}
@@ -17,6 +17,11 @@ func (r *Resolver) Resolve(domain string) (string, bool) {
 	return r.matcher.Match(domain)
 }
 
+// ResolveRecord returns the record answering for a given domain
+func (r *Resolver) ResolveRecord(domain string) (Record, bool) {
+	return r.matcher.MatchRecord(domain)
+}
+
 // UpdateRecords updates the resolver with new records
 func (r *Resolver) UpdateRecords(records []Record) {
 	r.matcher.Update(records)
@@ -31,3 +36,8 @@ func (r *Resolver) GetDomains() []string {
 func (r *Resolver) GetRecords() []Record {
 	return r.matcher.GetRecords()
 }
+
+// Enumerate returns the listable records, expanding regex rules via samples
+func (r *Resolver) Enumerate(samples []string) []Record {
+	return r.matcher.Enumerate(samples)
+}
@@ -0,0 +1,87 @@
+package reghost
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// DefaultTSIGAlgorithm is used when a TSIG key does not name an algorithm
+const DefaultTSIGAlgorithm = "hmac-sha256."
+
+// supportedTSIGAlgorithms lists the HMAC algorithms accepted for TSIG keys
+var supportedTSIGAlgorithms = map[string]bool{
+	"hmac-sha1.":   true,
+	"hmac-sha224.": true,
+	"hmac-sha256.": true,
+	"hmac-sha384.": true,
+	"hmac-sha512.": true,
+}
+
+// TSIGKey is a shared secret used to authenticate zone transfers and updates
+type TSIGKey struct {
+	Name      string `yaml:"name"`
+	Algorithm string `yaml:"algorithm,omitempty"`
+	Secret    string `yaml:"secret"`
+}
+
+// KeyName returns the key name as a lowercase FQDN, the form used on the wire
+func (k *TSIGKey) KeyName() string {
+	return Fqdn(k.Name)
+}
+
+// AlgorithmName returns the HMAC algorithm as a lowercase FQDN
+func (k *TSIGKey) AlgorithmName() string {
+	if k.Algorithm == "" {
+		return DefaultTSIGAlgorithm
+	}
+	return Fqdn(k.Algorithm)
+}
+
+// validate checks the key declaration
+func (k *TSIGKey) validate() error {
+	if k.Name == "" {
+		return &ErrInvalidTSIGKey{Name: k.Name, Reason: "name is empty"}
+	}
+	if !supportedTSIGAlgorithms[k.AlgorithmName()] {
+		return &ErrInvalidTSIGKey{Name: k.Name, Reason: fmt.Sprintf("unsupported algorithm '%s'", k.Algorithm)}
+	}
+	if _, err := base64.StdEncoding.DecodeString(k.Secret); err != nil || k.Secret == "" {
+		return &ErrInvalidTSIGKey{Name: k.Name, Reason: "secret must be non-empty base64"}
+	}
+	return nil
+}
+
+// Transfer controls which clients may transfer zones (AXFR/IXFR). A client
+// is allowed when its address is in Allow or it signs with one of Keys.
+type Transfer struct {
+	Allow []string `yaml:"allow,omitempty"`
+	Keys  []string `yaml:"keys,omitempty"`
+}
+
+// HasKey reports whether the transfer policy accepts the named TSIG key
+func (t *Transfer) HasKey(name string) bool {
+	for _, key := range t.Keys {
+		if Fqdn(key) == Fqdn(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateKeyRefs checks that every referenced key name is declared
+func validateKeyRefs(section string, refs []string, keys []TSIGKey) error {
+	for _, ref := range refs {
+		found := false
+		for i := range keys {
+			if keys[i].KeyName() == Fqdn(ref) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s references unknown TSIG key '%s'", section, strings.TrimSuffix(ref, "."))
+		}
+	}
+	return nil
+}
@@ -1,20 +1,90 @@
 package reghost
 
+import "fmt"
+
 // Config represents the complete configuration structure
 type Config struct {
-	ActiveRecord string              `yaml:"activeRecord"`
-	Records      map[string][]Record `yaml:"records"`
+	// ActiveRecord is the active record set, or the one on top when several
+	// are active. Setting it replaces the top set of ActiveRecords.
+	ActiveRecord string `yaml:"-"`
+	// ActiveRecords lists the active record sets, highest precedence first.
+	// In YAML, activeRecord holds a single name or a list of names.
+	ActiveRecords RecordSetNames      `yaml:"activeRecord"`
+	Records       map[string][]Record `yaml:"records"`
+	// Extends lists, per record set, the sets it inherits records from. It
+	// is read from and written to the mapping form of a record set.
+	Extends map[string][]string `yaml:"-"`
+	// Include lists glob patterns of files holding more record sets
+	Include []string `yaml:"include,omitempty"`
+	// Sources maps each record set to the file that defines it. It is set
+	// by the loader so edits can be written back to the right file.
+	Sources    map[string]string `yaml:"-"`
+	Zones      []Zone            `yaml:"zones,omitempty"`
+	OutOfZone  string            `yaml:"outOfZone,omitempty"`
+	Forwarders []string          `yaml:"forwarders,omitempty"`
+	TSIGKeys   []TSIGKey         `yaml:"tsigKeys,omitempty"`
+	Transfer   *Transfer         `yaml:"transfer,omitempty"`
+	Update     *Update           `yaml:"update,omitempty"`
+	DNSSEC     *DNSSEC           `yaml:"dnssec,omitempty"`
+	ACL        *ACL              `yaml:"acl,omitempty"`
+	Views      []View            `yaml:"views,omitempty"`
+	RateLimit  *RateLimit        `yaml:"rateLimit,omitempty"`
+	// Projects are registered project directories whose records are
+	// served after the active record sets
+	Projects []Project `yaml:"projects,omitempty"`
+	// Samples are hostnames used to expand regex rules wherever records
+	// have to be enumerated, such as zone transfers
+	Samples []string `yaml:"samples,omitempty"`
+	// HostsSync maintains the active records in a hosts file, instead of
+	// or in addition to serving them over DNS
+	HostsSync *HostsSync `yaml:"hostsSync,omitempty"`
+	// BindIP fixes the loopback address the DNS server binds to. Without
+	// it, an address is picked at random once and reused across restarts.
+	BindIP string `yaml:"bindIP,omitempty"`
+	// Providers are sources of records that change at runtime, in
+	// precedence order
+	Providers []ProviderSource `yaml:"providers,omitempty"`
+	// Docker serves records for running containers
+	Docker *Docker `yaml:"docker,omitempty"`
 }
 
 // Record represents a single DNS record rule
 type Record struct {
+	// ID optionally names the record, so that it can be addressed even
+	// when its domain, IP or position change. See RecordID.
+	ID     string `yaml:"id,omitempty"`
 	Domain string `yaml:"domain"`
 	IP     string `yaml:"ip"`
+	// Set is the record set the rule came from. It is filled in when
+	// record sets are merged and never written to the config file.
+	Set string `yaml:"-"`
+}
+
+// Active returns the active record sets, highest precedence first. An
+// ActiveRecord that differs from the top of ActiveRecords replaces it.
+func (c *Config) Active() RecordSetNames {
+	if c.ActiveRecord == "" || (len(c.ActiveRecords) > 0 && c.ActiveRecords[0] == c.ActiveRecord) {
+		return c.ActiveRecords
+	}
+	if len(c.ActiveRecords) == 0 {
+		return RecordSetNames{c.ActiveRecord}
+	}
+	return append(RecordSetNames{c.ActiveRecord}, c.ActiveRecords[1:].Deactivate(c.ActiveRecord)...)
+}
+
+// SetActive sets the active record sets, highest precedence first
+func (c *Config) SetActive(names RecordSetNames) {
+	c.ActiveRecords = names
+	c.ActiveRecord = ""
+	if len(names) > 0 {
+		c.ActiveRecord = names[0]
+	}
 }
 
 // Validate checks if the configuration is valid
 func (c *Config) Validate() error {
-	if c.ActiveRecord == "" {
+	active := c.Active()
+	if len(active) == 0 {
 		return ErrMissingActiveRecord
 	}
 
@@ -22,17 +92,34 @@ func (c *Config) Validate() error {
 		return ErrNoRecords
 	}
 
-	if _, exists := c.Records[c.ActiveRecord]; !exists {
-		return ErrActiveRecordNotFound
+	for i, name := range active {
+		if _, exists := c.Records[name]; !exists {
+			return fmt.Errorf("%w: '%s'", ErrActiveRecordNotFound, name)
+		}
+		if active.Index(name) != i {
+			return fmt.Errorf("activeRecord lists '%s' more than once", name)
+		}
+		// Empty sets may be prepared, but would serve nothing when active.
+		// Projects whose file is missing or invalid load as empty sets.
+		if len(c.Records[name]) == 0 && len(c.Extends[name]) == 0 && !c.isProjectSet(name) {
+			return &ErrEmptyRecordSet{Name: name}
+		}
 	}
 
 	// Validate each record
 	for name, records := range c.Records {
-		if len(records) == 0 {
-			return &ErrEmptyRecordSet{Name: name}
-		}
-
+		ids := make(map[string]bool)
 		for i, record := range records {
+			if record.ID != "" {
+				if ids[record.ID] {
+					return &ErrInvalidRecord{
+						RecordSet: name,
+						Index:     i,
+						Reason:    fmt.Sprintf("id '%s' is used by another record", record.ID),
+					}
+				}
+				ids[record.ID] = true
+			}
 			if record.Domain == "" {
 				return &ErrInvalidRecord{
 					RecordSet: name,
@@ -50,13 +137,125 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	if err := c.validateExtends(); err != nil {
+		return err
+	}
+
+	if err := validateProjects(c.Projects); err != nil {
+		return err
+	}
+
+	// Validate zones
+	for i := range c.Zones {
+		if err := c.Zones[i].validate(); err != nil {
+			return err
+		}
+	}
+
+	switch c.OutOfZone {
+	case "", OutOfZoneRefuse:
+	case OutOfZoneForward:
+		if len(c.Forwarders) == 0 {
+			return ErrNoForwarders
+		}
+	default:
+		return fmt.Errorf("invalid outOfZone policy '%s'", c.OutOfZone)
+	}
+
+	// Validate TSIG keys and the transfer policy
+	for i := range c.TSIGKeys {
+		if err := c.TSIGKeys[i].validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Transfer != nil {
+		if _, err := ParseNetworks(c.Transfer.Allow); err != nil {
+			return fmt.Errorf("invalid transfer.allow: %w", err)
+		}
+		if err := validateKeyRefs("transfer", c.Transfer.Keys, c.TSIGKeys); err != nil {
+			return err
+		}
+	}
+
+	if c.Update != nil {
+		if err := c.Update.validate(c.TSIGKeys); err != nil {
+			return err
+		}
+	}
+
+	if c.DNSSEC != nil {
+		if err := c.DNSSEC.validate(c.Zones); err != nil {
+			return err
+		}
+	}
+
+	if c.ACL != nil {
+		if err := c.ACL.validate(); err != nil {
+			return err
+		}
+	}
+
+	for i := range c.Views {
+		if err := c.Views[i].validate(c.Records); err != nil {
+			return err
+		}
+	}
+
+	if c.RateLimit != nil {
+		if err := c.RateLimit.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.HostsSync != nil {
+		if err := c.HostsSync.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.BindIP != "" {
+		if err := ValidateBindIP(c.BindIP); err != nil {
+			return err
+		}
+	}
+
+	if err := validateProviders(c.Providers); err != nil {
+		return err
+	}
+
+	if c.Docker != nil {
+		if err := c.Docker.validate(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-// GetActiveRecords returns the currently active record set
+// GetActiveRecords returns the active record sets merged in precedence
+// order, followed by the record sets of loaded projects. Each record is
+// annotated with the set it came from.
 func (c *Config) GetActiveRecords() []Record {
-	if records, ok := c.Records[c.ActiveRecord]; ok {
-		return records
+	active := c.Active()
+	layers := make([][]Record, 0, len(active)+len(c.Projects))
+	for _, name := range active {
+		layers = append(layers, c.GetRecordSet(name))
 	}
-	return nil
+	for i := range c.Projects {
+		if name := c.Projects[i].SetName(); !active.Contains(name) {
+			layers = append(layers, c.GetRecordSet(name))
+		}
+	}
+	return mergeLayers(layers)
+}
+
+// GetRecordSet returns the records of the named set including the records
+// it inherits, each annotated with the set that defines it
+func (c *Config) GetRecordSet(name string) []Record {
+	records, err := c.resolveRecordSet(name, nil)
+	if err != nil {
+		return nil
+	}
+	return records
 }
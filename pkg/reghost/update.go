@@ -0,0 +1,33 @@
+package reghost
+
+import "fmt"
+
+// Update controls RFC 2136 dynamic updates. Updates must be signed with one
+// of Keys and change RecordSet, either in the config file (Persist) or as
+// ephemeral runtime records that are lost on restart.
+type Update struct {
+	Keys      []string `yaml:"keys"`
+	RecordSet string   `yaml:"recordSet,omitempty"`
+	Persist   bool     `yaml:"persist,omitempty"`
+}
+
+// HasKey reports whether the update policy accepts the named TSIG key
+func (u *Update) HasKey(name string) bool {
+	for _, key := range u.Keys {
+		if Fqdn(key) == Fqdn(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks the update policy against the declared TSIG keys
+func (u *Update) validate(keys []TSIGKey) error {
+	if len(u.Keys) == 0 {
+		return fmt.Errorf("update requires at least one TSIG key")
+	}
+	if u.Persist && u.RecordSet == "" {
+		return fmt.Errorf("update.persist requires update.recordSet")
+	}
+	return validateKeyRefs("update", u.Keys, keys)
+}
@@ -0,0 +1,115 @@
+package reghost
+
+import "strings"
+
+// Out-of-zone policies
+const (
+	// OutOfZoneRefuse answers unmatched names outside every zone with REFUSED
+	OutOfZoneRefuse = "refuse"
+	// OutOfZoneForward sends unmatched names outside every zone to the forwarders
+	OutOfZoneForward = "forward"
+)
+
+// Default zone timers used when the config leaves them unset
+const (
+	DefaultZoneTTL    = 300
+	DefaultSOARefresh = 3600
+	DefaultSOARetry   = 600
+	DefaultSOAExpire  = 604800
+	DefaultSOAMinimum = 300
+)
+
+// Zone declares a zone apex reghost is authoritative for
+type Zone struct {
+	Name string   `yaml:"name"`
+	TTL  uint32   `yaml:"ttl,omitempty"`
+	SOA  SOA      `yaml:"soa"`
+	NS   []string `yaml:"ns"`
+}
+
+// SOA holds the start of authority data of a zone
+type SOA struct {
+	MName   string `yaml:"mname"`
+	RName   string `yaml:"rname"`
+	Serial  uint32 `yaml:"serial,omitempty"`
+	Refresh uint32 `yaml:"refresh,omitempty"`
+	Retry   uint32 `yaml:"retry,omitempty"`
+	Expire  uint32 `yaml:"expire,omitempty"`
+	Minimum uint32 `yaml:"minimum,omitempty"`
+}
+
+// Origin returns the zone apex as a lowercase FQDN
+func (z *Zone) Origin() string {
+	return Fqdn(z.Name)
+}
+
+// Contains reports whether a domain is at or below the zone apex
+func (z *Zone) Contains(domain string) bool {
+	origin := z.Origin()
+	domain = Fqdn(domain)
+	if origin == "." {
+		return true
+	}
+	return domain == origin || strings.HasSuffix(domain, "."+origin)
+}
+
+// RecordTTL returns the TTL for records served from the zone
+func (z *Zone) RecordTTL() uint32 {
+	if z.TTL == 0 {
+		return DefaultZoneTTL
+	}
+	return z.TTL
+}
+
+// NegativeTTL returns the TTL for negative answers as defined by RFC 2308
+func (z *Zone) NegativeTTL() uint32 {
+	minimum := z.SOA.Minimum
+	if minimum == 0 {
+		minimum = DefaultSOAMinimum
+	}
+	if ttl := z.RecordTTL(); ttl < minimum {
+		return ttl
+	}
+	return minimum
+}
+
+// validate checks the zone declaration
+func (z *Zone) validate() error {
+	if z.Name == "" {
+		return &ErrInvalidZone{Name: z.Name, Reason: "name is empty"}
+	}
+	if z.SOA.MName == "" {
+		return &ErrInvalidZone{Name: z.Name, Reason: "soa.mname is empty"}
+	}
+	if z.SOA.RName == "" {
+		return &ErrInvalidZone{Name: z.Name, Reason: "soa.rname is empty"}
+	}
+	if len(z.NS) == 0 {
+		return &ErrInvalidZone{Name: z.Name, Reason: "at least one ns is required"}
+	}
+	return nil
+}
+
+// FindZone returns the most specific zone containing the domain, or nil
+func FindZone(zones []Zone, domain string) *Zone {
+	var best *Zone
+	for i := range zones {
+		zone := &zones[i]
+		if !zone.Contains(domain) {
+			continue
+		}
+		if best == nil || len(zone.Origin()) > len(best.Origin()) {
+			best = zone
+		}
+	}
+	return best
+}
+
+// Fqdn lowercases a domain and ensures it ends with a dot
+func Fqdn(domain string) string {
+	domain = strings.ToLower(domain)
+	if !strings.HasSuffix(domain, ".") {
+		domain = domain + "."
+	}
+	return domain
+}
@@ -0,0 +1,148 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/bilgehannal/reghost/internal/dns"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+	mdns "github.com/miekg/dns"
+)
+
+func newViewConfig() *reghost.Config {
+	return &reghost.Config{
+		ActiveRecord: "local",
+		Records: map[string][]reghost.Record{
+			"local":   {{Domain: "api.dev.local", IP: "127.0.0.1"}},
+			"staging": {{Domain: "api.dev.local", IP: "10.0.2.2"}},
+		},
+		ACL: &reghost.ACL{Allow: []string{"127.0.0.0/8", "10.0.2.0/24"}},
+		Views: []reghost.View{
+			{Name: "emulator", Clients: []string{"10.0.2.0/24"}, RecordSet: "staging"},
+		},
+	}
+}
+
+func TestACLAndViewValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *reghost.Config
+		wantErr bool
+	}{
+		{
+			name: "valid ACL and view",
+			config: &reghost.Config{
+				ActiveRecord: "local",
+				Records: map[string][]reghost.Record{
+					"local":   {{Domain: "api.dev.local", IP: "127.0.0.1"}},
+					"staging": {{Domain: "api.dev.local", IP: "10.0.2.2"}},
+				},
+				ACL: &reghost.ACL{Allow: []string{"127.0.0.0/8", "10.0.2.0/24"}},
+				Views: []reghost.View{
+					{Name: "emulator", Clients: []string{"10.0.2.0/24"}, RecordSet: "staging"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid ACL network",
+			config: &reghost.Config{
+				ActiveRecord: "local",
+				Records: map[string][]reghost.Record{
+					"local":   {{Domain: "api.dev.local", IP: "127.0.0.1"}},
+					"staging": {{Domain: "api.dev.local", IP: "10.0.2.2"}},
+				},
+				ACL: &reghost.ACL{Allow: []string{"not-a-network"}},
+				Views: []reghost.View{
+					{Name: "emulator", Clients: []string{"10.0.2.0/24"}, RecordSet: "staging"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "view with unknown record set",
+			config: &reghost.Config{
+				ActiveRecord: "local",
+				Records: map[string][]reghost.Record{
+					"local":   {{Domain: "api.dev.local", IP: "127.0.0.1"}},
+					"staging": {{Domain: "api.dev.local", IP: "10.0.2.2"}},
+				},
+				ACL: &reghost.ACL{Allow: []string{"127.0.0.0/8", "10.0.2.0/24"}},
+				Views: []reghost.View{
+					{Name: "emulator", Clients: []string{"10.0.2.0/24"}, RecordSet: "missing"},
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestACLAndViews(t *testing.T) {
+	cfg := newViewConfig()
+	handler := dns.NewHandler(dns.NewCache(cfg.GetActiveRecords()), newTestLogger(t))
+	handler.Configure(cfg)
+
+	tests := []struct {
+		client string
+		rcode  int
+		ip     string
+	}{
+		{"127.0.0.1", mdns.RcodeSuccess, "127.0.0.1"},
+		{"10.0.2.15", mdns.RcodeSuccess, "10.0.2.2"},
+		{"192.168.1.20", mdns.RcodeRefused, ""},
+	}
+
+	for _, tt := range tests {
+		w := newFakeResponseWriter(tt.client)
+		handler.ServeDNS(w, query("api.dev.local", mdns.TypeA))
+		if w.msg == nil {
+			t.Fatalf("No response for client %s", tt.client)
+		}
+		if w.msg.Rcode != tt.rcode {
+			t.Errorf("Client %s: expected rcode %s, got %s", tt.client,
+				mdns.RcodeToString[tt.rcode], mdns.RcodeToString[w.msg.Rcode])
+			continue
+		}
+		if tt.ip == "" {
+			continue
+		}
+		if len(w.msg.Answer) != 1 || w.msg.Answer[0].(*mdns.A).A.String() != tt.ip {
+			t.Errorf("Client %s: expected answer %s, got %v", tt.client, tt.ip, w.msg.Answer)
+		}
+	}
+}
+
+func TestViewRuntimeLayers(t *testing.T) {
+	cfg := newViewConfig()
+	cache := dns.NewCache(cfg.GetActiveRecords())
+	cache.SetLayer("docker", dns.ProviderRank, []reghost.Record{{Domain: "db.docker.local", IP: "172.17.0.2"}})
+	handler := dns.NewHandler(cache, newTestLogger(t))
+	handler.Configure(cfg)
+
+	// A layer set after the views were configured reaches them too
+	cache.SetLayer("update", dns.UpdateRank, []reghost.Record{{Domain: "api.dev.local", IP: "10.0.2.9"}})
+
+	tests := []struct {
+		domain string
+		ip     string
+	}{
+		{"db.docker.local", "172.17.0.2"},
+		{"api.dev.local", "10.0.2.9"},
+	}
+
+	for _, tt := range tests {
+		w := newFakeResponseWriter("10.0.2.15")
+		handler.ServeDNS(w, query(tt.domain, mdns.TypeA))
+		if w.msg == nil || len(w.msg.Answer) != 1 || w.msg.Answer[0].(*mdns.A).A.String() != tt.ip {
+			t.Errorf("View client: expected %s -> %s, got %v", tt.domain, tt.ip, w.msg)
+		}
+	}
+}
@@ -105,6 +105,105 @@ func TestConfigValidation(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "fixed bind IP",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "test.local", IP: "127.0.0.1"}},
+				},
+				BindIP: "127.53.0.1",
+			},
+			wantErr: false,
+		},
+		{
+			name: "bind IP outside loopback",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "test.local", IP: "127.0.0.1"}},
+				},
+				BindIP: "10.0.0.53",
+			},
+			wantErr: true,
+		},
+		{
+			name: "bind IP 127.0.0.1",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "test.local", IP: "127.0.0.1"}},
+				},
+				BindIP: "127.0.0.1",
+			},
+			wantErr: true,
+		},
+		{
+			name: "relative docker socket",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "test.local", IP: "127.0.0.1"}},
+				},
+				Docker: &reghost.Docker{Socket: "docker.sock"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "dir and exec providers",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "test.local", IP: "127.0.0.1"}},
+				},
+				Providers: []reghost.ProviderSource{{Name: "team", Dir: "/etc/reghost.d"}, {Name: "vault", Exec: []string{"vault-records"}, Interval: "30s"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "provider with dir and exec",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "test.local", IP: "127.0.0.1"}},
+				},
+				Providers: []reghost.ProviderSource{{Name: "team", Dir: "/etc/reghost.d", Exec: []string{"true"}}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate provider name",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "test.local", IP: "127.0.0.1"}},
+				},
+				Providers: []reghost.ProviderSource{{Name: "team", Dir: "/a"}, {Name: "team", Dir: "/b"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "reserved provider name",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "test.local", IP: "127.0.0.1"}},
+				},
+				Providers: []reghost.ProviderSource{{Name: "docker", Dir: "/a"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid provider interval",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "test.local", IP: "127.0.0.1"}},
+				},
+				Providers: []reghost.ProviderSource{{Name: "vault", Exec: []string{"vault-records"}, Interval: "soon"}},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
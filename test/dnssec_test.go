@@ -0,0 +1,216 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bilgehannal/reghost/internal/cli"
+	"github.com/bilgehannal/reghost/internal/dns"
+	"github.com/bilgehannal/reghost/internal/dnssec"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+	mdns "github.com/miekg/dns"
+)
+
+// dnssecQuery builds a query with the DO bit set
+func dnssecQuery(name string, qtype uint16) *mdns.Msg {
+	m := query(name, qtype)
+	m.SetEdns0(4096, true)
+	return m
+}
+
+// verifySection checks every RRSIG in a section against the DNSKEY rrset
+func verifySection(t *testing.T, section []mdns.RR, keys []mdns.RR) int {
+	t.Helper()
+
+	sigs := 0
+	for _, rr := range section {
+		sig, ok := rr.(*mdns.RRSIG)
+		if !ok {
+			continue
+		}
+		sigs++
+
+		var rrset []mdns.RR
+		for _, other := range section {
+			if other.Header().Rrtype == sig.TypeCovered && mdns.CanonicalName(other.Header().Name) == mdns.CanonicalName(sig.Hdr.Name) {
+				rrset = append(rrset, other)
+			}
+		}
+
+		verified := false
+		for _, k := range keys {
+			key := k.(*mdns.DNSKEY)
+			if key.KeyTag() == sig.KeyTag && sig.Verify(key, rrset) == nil {
+				verified = true
+			}
+		}
+		if !verified {
+			t.Errorf("RRSIG over %s %s does not verify", sig.Hdr.Name, mdns.TypeToString[sig.TypeCovered])
+		}
+	}
+	return sigs
+}
+
+func TestDNSSECKeys(t *testing.T) {
+	settings := &reghost.DNSSEC{KeyDir: t.TempDir()}
+
+	// Loading never generates keys
+	var notFound *reghost.ErrNotFound
+	if _, err := dnssec.Load(settings, "dev.example"); !errors.As(err, &notFound) {
+		t.Fatalf("Expected a not found error before keys exist, got %v", err)
+	}
+	if entries, _ := os.ReadDir(settings.KeyDir); len(entries) != 0 {
+		t.Fatalf("Expected Load to leave the key directory empty, got %d entries", len(entries))
+	}
+
+	first, err := dnssec.LoadOrGenerate(settings, "dev.example")
+	if err != nil {
+		t.Fatalf("LoadOrGenerate failed: %v", err)
+	}
+	second, err := dnssec.LoadOrGenerate(settings, "dev.example.")
+	if err != nil {
+		t.Fatalf("LoadOrGenerate failed: %v", err)
+	}
+
+	if first.KSK.KeyTag() != second.KSK.KeyTag() || first.ZSK.KeyTag() != second.ZSK.KeyTag() {
+		t.Error("Keys should be reused from the key directory")
+	}
+	if first.KSK.Flags != 257 || first.ZSK.Flags != 256 {
+		t.Errorf("Unexpected key flags: KSK=%d ZSK=%d", first.KSK.Flags, first.ZSK.Flags)
+	}
+	if ds := first.DS(); ds.DigestType != mdns.SHA256 || ds.KeyTag != first.KSK.KeyTag() {
+		t.Errorf("Unexpected DS record: %v", ds)
+	}
+
+	loaded, err := dnssec.Load(settings, "dev.example")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.KSK.KeyTag() != first.KSK.KeyTag() {
+		t.Error("Load should return the generated keys")
+	}
+}
+
+func TestDNSSECSigning(t *testing.T) {
+	for _, nsec3 := range []bool{false, true} {
+		name := "NSEC"
+		if nsec3 {
+			name = "NSEC3"
+		}
+
+		t.Run(name, func(t *testing.T) {
+			cfg := newZoneConfig()
+			cfg.DNSSEC = &reghost.DNSSEC{KeyDir: t.TempDir(), NSEC3: nsec3}
+			if err := cfg.Validate(); err != nil {
+				t.Fatalf("Validate() unexpected error: %v", err)
+			}
+
+			handler := dns.NewHandler(dns.NewCache(cfg.GetActiveRecords()), newTestLogger(t))
+			handler.Configure(cfg)
+
+			serve := func(m *mdns.Msg) *mdns.Msg {
+				w := newFakeResponseWriter("127.0.0.1")
+				handler.ServeDNS(w, m)
+				return w.msg
+			}
+
+			keys := serve(dnssecQuery("dev.example", mdns.TypeDNSKEY))
+			if len(keys.Answer) != 3 {
+				t.Fatalf("Expected KSK, ZSK and RRSIG, got %v", keys.Answer)
+			}
+			var dnskeys []mdns.RR
+			for _, rr := range keys.Answer {
+				if rr.Header().Rrtype == mdns.TypeDNSKEY {
+					dnskeys = append(dnskeys, rr)
+				}
+			}
+			verifySection(t, keys.Answer, dnskeys)
+
+			answer := serve(dnssecQuery("api.dev.example", mdns.TypeA))
+			if sigs := verifySection(t, answer.Answer, dnskeys); sigs != 1 {
+				t.Errorf("Expected 1 RRSIG in answer, got %d", sigs)
+			}
+			if opt := answer.IsEdns0(); opt == nil || !opt.Do() {
+				t.Error("Signed reply must carry the DO bit")
+			}
+
+			denied := serve(dnssecQuery("missing.dev.example", mdns.TypeA))
+			if denied.Rcode != mdns.RcodeNameError {
+				t.Fatalf("Expected NXDOMAIN, got %s", mdns.RcodeToString[denied.Rcode])
+			}
+			proofType, proofs := mdns.TypeNSEC, 0
+			if nsec3 {
+				proofType = mdns.TypeNSEC3
+			}
+			for _, rr := range denied.Ns {
+				if rr.Header().Rrtype == proofType {
+					proofs++
+				}
+			}
+			if proofs < 2 {
+				t.Errorf("Expected denial of existence records, got %v", denied.Ns)
+			}
+			verifySection(t, denied.Ns, dnskeys)
+			if _, err := denied.Pack(); err != nil {
+				t.Errorf("Denial does not pack: %v", err)
+			}
+
+			nodata := serve(dnssecQuery("api.dev.example", mdns.TypeAAAA))
+			for _, rr := range nodata.Ns {
+				if nsec, ok := rr.(*mdns.NSEC); ok {
+					for _, typ := range nsec.TypeBitMap {
+						if typ == mdns.TypeAAAA {
+							t.Error("NODATA proof must not list the queried type")
+						}
+					}
+				}
+			}
+			verifySection(t, nodata.Ns, dnskeys)
+
+			unsigned := serve(query("api.dev.example", mdns.TypeA))
+			for _, rr := range unsigned.Answer {
+				if rr.Header().Rrtype == mdns.TypeRRSIG {
+					t.Error("Queries without the DO bit must not be signed")
+				}
+			}
+		})
+	}
+}
+
+func TestDNSSECDSCommand(t *testing.T) {
+	dir := t.TempDir()
+	keyDir := filepath.Join(dir, "keys")
+	configPath := filepath.Join(dir, "reghost.yml")
+	writeTestFile(t, configPath, `activeRecord: default
+records:
+  default:
+    - domain: api.dev.example
+      ip: 10.0.0.1
+zones:
+  - name: dev.example
+    soa:
+      mname: ns1.dev.example.
+      rname: hostmaster@dev.example
+    ns: [ns1.dev.example.]
+dnssec:
+  keyDir: `+keyDir+`
+`)
+
+	if _, code := runCLI(t, "-c", configPath, "dnssec", "ds"); code != cli.ExitNotFound {
+		t.Errorf("Expected exit code %d without keys, got %d", cli.ExitNotFound, code)
+	}
+	if _, err := os.Stat(keyDir); !os.IsNotExist(err) {
+		t.Errorf("Expected no keys to be generated, got %v", err)
+	}
+
+	keys, err := dnssec.LoadOrGenerate(&reghost.DNSSEC{KeyDir: keyDir}, "dev.example")
+	if err != nil {
+		t.Fatalf("LoadOrGenerate failed: %v", err)
+	}
+	out, code := runCLI(t, "-c", configPath, "dnssec", "ds")
+	if code != cli.ExitOK || out != keys.DS().String()+"\n" {
+		t.Errorf("Expected the DS record, got exit code %d and %q", code, out)
+	}
+}
@@ -0,0 +1,184 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bilgehannal/reghost/internal/dns"
+	"github.com/bilgehannal/reghost/internal/platform"
+	"github.com/bilgehannal/reghost/internal/provider"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+// fakeDocker serves the container list and event stream of the Docker
+// Engine API on a Unix socket
+type fakeDocker struct {
+	mu         sync.Mutex
+	containers []map[string]any
+	events     chan string
+}
+
+func startFakeDocker(t *testing.T) (*fakeDocker, string) {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	fake := &fakeDocker{events: make(chan string, 10)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		json.NewEncoder(w).Encode(fake.containers)
+	})
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case action := <-fake.events:
+				json.NewEncoder(w).Encode(map[string]any{"Type": "container", "Action": action})
+				w.(http.Flusher).Flush()
+			}
+		}
+	})
+
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return fake, socket
+}
+
+// set replaces the running containers and emits an event
+func (f *fakeDocker) set(action string, containers ...map[string]any) {
+	f.mu.Lock()
+	f.containers = containers
+	f.mu.Unlock()
+	f.events <- action
+}
+
+// container returns a container as listed by the Engine API
+func container(name, ip string, labels map[string]string) map[string]any {
+	return map[string]any{
+		"Names":  []string{"/" + name},
+		"Labels": labels,
+		"NetworkSettings": map[string]any{
+			"Networks": map[string]any{
+				"bridge": map[string]string{"IPAddress": ip},
+			},
+		},
+	}
+}
+
+func TestDockerProvider(t *testing.T) {
+	fake, socket := startFakeDocker(t)
+
+	web := container("shop-web-1", "172.18.0.2", map[string]string{
+		provider.ComposeProjectLabel: "shop",
+		provider.ComposeServiceLabel: "web",
+	})
+	redis := container("redis", "172.17.0.3", map[string]string{
+		provider.DomainLabel: "cache.test, redis.local",
+	})
+	hostNetwork := map[string]any{"Names": []string{"/agent"}}
+	fake.containers = []map[string]any{web, redis, hostNetwork}
+
+	docker := provider.NewDocker(&reghost.Docker{Socket: socket}, newTestLogger(t))
+	updates := make(chan []reghost.Record, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- docker.Run(ctx, func(records []reghost.Record) { updates <- records })
+	}()
+
+	next := func(t *testing.T) []reghost.Record {
+		t.Helper()
+		select {
+		case records := <-updates:
+			return records
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for records")
+			return nil
+		}
+	}
+
+	assertRecords(t, next(t), []reghost.Record{
+		{Domain: "cache.test", IP: "172.17.0.3", Set: "docker"},
+		{Domain: "redis.local", IP: "172.17.0.3", Set: "docker"},
+		{Domain: "redis.docker", IP: "172.17.0.3", Set: "docker"},
+		{Domain: "web.shop.docker", IP: "172.18.0.2", Set: "docker"},
+		{Domain: "shop-web-1.docker", IP: "172.18.0.2", Set: "docker"},
+	})
+
+	t.Run("Start", func(t *testing.T) {
+		db := container("db", "172.17.0.4", nil)
+		fake.set("start", web, redis, db)
+		records := next(t)
+		if !slices.Contains(records, reghost.Record{Domain: "db.docker", IP: "172.17.0.4", Set: "docker"}) {
+			t.Errorf("Expected a record for the started container, got %v", records)
+		}
+	})
+
+	t.Run("Stop", func(t *testing.T) {
+		fake.set("die", web)
+		assertRecords(t, next(t), []reghost.Record{
+			{Domain: "web.shop.docker", IP: "172.18.0.2", Set: "docker"},
+			{Domain: "shop-web-1.docker", IP: "172.18.0.2", Set: "docker"},
+		})
+	})
+
+	t.Run("IgnoredEvent", func(t *testing.T) {
+		fake.set("exec_start: sh", web)
+		fake.set("start", web) // Unchanged records are not sent again
+		select {
+		case records := <-updates:
+			t.Errorf("Unexpected update %v", records)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run returned %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after cancel")
+	}
+}
+
+func TestProviderLayer(t *testing.T) {
+	cache := dns.NewCache([]reghost.Record{{Domain: "api.test", IP: "10.0.0.1"}})
+	fake := platform.NewFake()
+	server := dns.NewServer(cache, newTestLogger(t), fake)
+	server.SetPort(freePort(t))
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer server.Shutdown(context.Background())
+
+	server.UpdateLayer("docker", dns.ProviderRank, []reghost.Record{{Domain: "web.shop.docker", IP: "172.18.0.2", Set: "docker"}})
+
+	if ip, ok := cache.Lookup("web.shop.docker."); !ok || ip != "172.18.0.2" {
+		t.Errorf("Expected the container to resolve, got %s %v", ip, ok)
+	}
+	if ip, ok := cache.Lookup("api.test."); !ok || ip != "10.0.0.1" {
+		t.Errorf("Expected the config records to be kept, got %s %v", ip, ok)
+	}
+	if _, domains := fake.Resolver(); !slices.Equal(domains, []string{"docker", "test"}) {
+		t.Errorf("Expected the resolver to route the docker domain, got %v", domains)
+	}
+}
@@ -0,0 +1,146 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bilgehannal/reghost/internal/convert"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+// exportTestConfig returns a config whose 'dev' set inherits from 'base'
+// and holds a regex rule with samples and one without
+func exportTestConfig() *reghost.Config {
+	return &reghost.Config{
+		ActiveRecord: "dev",
+		Samples:      []string{"api.dev.local", "web.dev.local", "base.local"},
+		Records: map[string][]reghost.Record{
+			"base": {{Domain: "base.local", IP: "10.0.0.5"}},
+			"dev": {
+				{Domain: `^.+\.dev\.local\.$`, IP: "127.0.0.1"},
+				{Domain: `^.+\.other\.local\.$`, IP: "127.0.0.2"},
+				{Domain: "v6.local", IP: "fd00::1"},
+			},
+		},
+		Extends: map[string][]string{"dev": {"base"}},
+	}
+}
+
+func TestExportFormats(t *testing.T) {
+	cfg := exportTestConfig()
+
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{convert.FormatHosts, []string{"127.0.0.1 api.dev.local", "127.0.0.1 web.dev.local", "10.0.0.5  base.local", "fd00::1   v6.local"}},
+		{convert.FormatDnsmasq, []string{"host-record=api.dev.local,127.0.0.1", "host-record=v6.local,fd00::1"}},
+		{convert.FormatZone, []string{"$TTL 300", "api.dev.local. IN A    127.0.0.1", "v6.local.      IN AAAA fd00::1"}},
+		{convert.FormatCorefile, []string{"hosts {", "127.0.0.1 web.dev.local", "fallthrough", "forward . /etc/resolv.conf"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var out bytes.Buffer
+			issues, err := convert.Export(&out, tt.format, cfg, "dev")
+			if err != nil {
+				t.Fatalf("Export failed: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("Expected %q in output:\n%s", want, out.String())
+				}
+			}
+
+			// The regex rule without samples is commented out and reported
+			if len(issues) != 1 || !strings.Contains(issues[0].Text, "other") {
+				t.Errorf("Expected the unexpanded rule as the only issue, got %v", issues)
+			}
+			if !strings.Contains(out.String(), `not exported, add matching samples: ^.+\.other\.local\.$`) {
+				t.Errorf("Expected a comment for the unexpanded rule:\n%s", out.String())
+			}
+		})
+	}
+}
+
+func TestExportJSON(t *testing.T) {
+	var out bytes.Buffer
+	issues, err := convert.Export(&out, convert.FormatJSON, exportTestConfig(), "dev")
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if len(issues) != 0 {
+		t.Errorf("Expected no issues, got %v", issues)
+	}
+
+	var records []reghost.Record
+	if err := json.Unmarshal(out.Bytes(), &records); err != nil {
+		t.Fatalf("Failed to parse output: %v", err)
+	}
+	assertRecords(t, records, []reghost.Record{
+		{Domain: `^.+\.dev\.local\.$`, IP: "127.0.0.1"},
+		{Domain: `^.+\.other\.local\.$`, IP: "127.0.0.2"},
+		{Domain: "v6.local", IP: "fd00::1"},
+		{Domain: "base.local", IP: "10.0.0.5"},
+	})
+}
+
+func TestExportShadowedSample(t *testing.T) {
+	cfg := &reghost.Config{
+		ActiveRecord: "dev",
+		Samples:      []string{"api.dev.local"},
+		Records: map[string][]reghost.Record{
+			"dev": {
+				{Domain: "api.dev.local", IP: "10.0.0.1"},
+				{Domain: `^.+\.dev\.local\.$`, IP: "127.0.0.1"},
+			},
+		},
+	}
+
+	var out bytes.Buffer
+	issues, err := convert.Export(&out, convert.FormatHosts, cfg, "dev")
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	// The sample resolves through the exact rule, so the regex rule has no
+	// name of its own
+	if len(issues) != 1 {
+		t.Errorf("Expected the shadowed regex rule to be reported, got %v", issues)
+	}
+	if strings.Contains(out.String(), "127.0.0.1 api.dev.local") {
+		t.Errorf("Expected the exact rule to win:\n%s", out.String())
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	var out bytes.Buffer
+	if _, err := convert.Export(&out, convert.FormatHosts, exportTestConfig(), "dev"); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	records, issues, err := convert.Import(convert.FormatHosts, &out, "")
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+	// IPv6 addresses are not served, so importing skips them
+	if len(issues) != 1 || !strings.Contains(issues[0].Text, "v6.local") {
+		t.Errorf("Expected the IPv6 entry as the only issue, got %v", issues)
+	}
+	assertDomains(t, records, "base.local", "api.dev.local", "web.dev.local")
+}
+
+func TestExportErrors(t *testing.T) {
+	cfg := exportTestConfig()
+
+	var out bytes.Buffer
+	var notFound *reghost.ErrNotFound
+	if _, err := convert.Export(&out, convert.FormatHosts, cfg, "missing"); !errors.As(err, &notFound) {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+	if _, err := convert.Export(&out, "bind", cfg, "dev"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
@@ -0,0 +1,99 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bilgehannal/reghost/internal/config"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+const extendsConfig = `activeRecord: mine
+records:
+  base:
+    - domain: api.dev.local
+      ip: 10.0.0.1
+    - domain: db.dev.local
+      ip: 10.0.0.2
+  tools:
+    - domain: grafana.dev.local
+      ip: 10.0.0.3
+  mine:
+    extends: [base, tools]
+    records:
+      - domain: api.dev.local
+        ip: 127.0.0.1
+`
+
+func TestRecordSetExtends(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "test.yml")
+	if err := os.WriteFile(configPath, []byte(extendsConfig), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	expected := []reghost.Record{
+		{Domain: "api.dev.local", IP: "127.0.0.1", Set: "mine"},
+		{Domain: "db.dev.local", IP: "10.0.0.2", Set: "base"},
+		{Domain: "grafana.dev.local", IP: "10.0.0.3", Set: "tools"},
+	}
+	records := cfg.GetActiveRecords()
+	if len(records) != len(expected) {
+		t.Fatalf("Expected %d resolved records, got %v", len(expected), records)
+	}
+	for i := range expected {
+		if records[i] != expected[i] {
+			t.Errorf("Record %d: expected %+v, got %+v", i, expected[i], records[i])
+		}
+	}
+
+	// Editing the set keeps its inheritance
+	writer := config.NewWriter(configPath)
+	if err := writer.AddRecord("mine", reghost.Record{Domain: "web.dev.local", IP: "127.0.0.2"}); err != nil {
+		t.Fatalf("AddRecord failed: %v", err)
+	}
+	data, _ := os.ReadFile(configPath)
+	if !strings.Contains(string(data), "extends:") {
+		t.Errorf("Expected extends to be written back, got:\n%s", data)
+	}
+	cfg, err = config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+	if len(cfg.GetActiveRecords()) != 4 {
+		t.Errorf("Expected 4 resolved records after edit, got %v", cfg.GetActiveRecords())
+	}
+}
+
+func TestRecordSetExtendsValidation(t *testing.T) {
+	cfg := &reghost.Config{
+		ActiveRecord: "a",
+		Records: map[string][]reghost.Record{
+			"a": {{Domain: "a.local", IP: "127.0.0.1"}},
+			"b": {{Domain: "b.local", IP: "127.0.0.1"}},
+			"c": {},
+		},
+		Extends: map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"a"}},
+	}
+
+	var cycle *reghost.ErrExtendsCycle
+	if err := cfg.Validate(); !errors.As(err, &cycle) {
+		t.Fatalf("Expected inheritance cycle error, got %v", err)
+	}
+	if got := strings.Join(cycle.Path, " -> "); got != "a -> b -> c -> a" {
+		t.Errorf("Unexpected cycle path: %s", got)
+	}
+
+	cfg.Extends = map[string][]string{"a": {"missing"}}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for extending an unknown record set")
+	}
+}
@@ -0,0 +1,59 @@
+package test
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/bilgehannal/reghost/internal/utils"
+	"github.com/miekg/dns"
+)
+
+// fakeResponseWriter captures the message written by a DNS handler
+type fakeResponseWriter struct {
+	remote net.Addr
+	msg    *dns.Msg
+}
+
+func newFakeResponseWriter(remoteIP string) *fakeResponseWriter {
+	return &fakeResponseWriter{
+		remote: &net.UDPAddr{IP: net.ParseIP(remoteIP), Port: 53535},
+	}
+}
+
+func (w *fakeResponseWriter) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 53}
+}
+func (w *fakeResponseWriter) RemoteAddr() net.Addr      { return w.remote }
+func (w *fakeResponseWriter) WriteMsg(m *dns.Msg) error { w.msg = m; return nil }
+func (w *fakeResponseWriter) Write(b []byte) (int, error) {
+	m := new(dns.Msg)
+	if err := m.Unpack(b); err != nil {
+		return 0, err
+	}
+	w.msg = m
+	return len(b), nil
+}
+func (w *fakeResponseWriter) Close() error        { return nil }
+func (w *fakeResponseWriter) TsigStatus() error   { return nil }
+func (w *fakeResponseWriter) TsigTimersOnly(bool) {}
+func (w *fakeResponseWriter) Hijack()             {}
+
+// newTestLogger creates a logger writing into the test's temp directory
+func newTestLogger(t *testing.T) *utils.Logger {
+	t.Helper()
+
+	logger, err := utils.NewLogger(filepath.Join(t.TempDir(), "reghost.log"))
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	t.Cleanup(func() { logger.Close() })
+	return logger
+}
+
+// query builds a DNS query message for a single question
+func query(name string, qtype uint16) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	return m
+}
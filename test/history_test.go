@@ -0,0 +1,277 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bilgehannal/reghost/internal/config"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+func TestHistory(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "reghost.yml")
+	writeTestFile(t, configPath, `activeRecord: default
+records:
+  default:
+    - domain: reghost.local
+      ip: 127.0.0.1
+`)
+
+	writer := config.NewWriter(configPath)
+	writer.SetCommand("reghostctl add-record default")
+	if err := writer.AddRecord("default", reghost.Record{Domain: "a.local", IP: "10.0.0.1"}); err != nil {
+		t.Fatalf("AddRecord failed: %v", err)
+	}
+	writer.SetCommand("reghostctl create-set extra")
+	if err := writer.CreateRecordSet("extra"); err != nil {
+		t.Fatalf("CreateRecordSet failed: %v", err)
+	}
+
+	entries, err := config.History(configPath)
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	// The version written by hand is recorded before the first change
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 revisions, got %d", len(entries))
+	}
+	if entries[0].Command != "" || entries[1].Command != "reghostctl add-record default" || entries[2].Command != "reghostctl create-set extra" {
+		t.Errorf("Unexpected commands: %q, %q, %q", entries[0].Command, entries[1].Command, entries[2].Command)
+	}
+	if entries[2].User == "" || entries[2].Time.IsZero() {
+		t.Errorf("Expected user and time to be recorded, got %q and %v", entries[2].User, entries[2].Time)
+	}
+	if !entries[2].IsCurrent(configPath) {
+		t.Error("Expected the latest revision to be current")
+	}
+
+	t.Run("Diff", func(t *testing.T) {
+		diff, err := config.Diff(configPath, 1)
+		if err != nil {
+			t.Fatalf("Diff failed: %v", err)
+		}
+		if !strings.Contains(diff, "+") || !strings.Contains(diff, "a.local") || !strings.Contains(diff, "extra:") {
+			t.Errorf("Expected the diff to show the added record and set, got:\n%s", diff)
+		}
+
+		diff, err = config.Diff(configPath, 3)
+		if err != nil {
+			t.Fatalf("Diff failed: %v", err)
+		}
+		if diff != "" {
+			t.Errorf("Expected no changes since the current revision, got:\n%s", diff)
+		}
+	})
+
+	t.Run("Undo", func(t *testing.T) {
+		revision, err := writer.Undo()
+		if err != nil {
+			t.Fatalf("Undo failed: %v", err)
+		}
+		if revision != 2 {
+			t.Errorf("Expected revision 2 to be restored, got %d", revision)
+		}
+
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			t.Fatalf("Failed to load config: %v", err)
+		}
+		if _, exists := cfg.Records["extra"]; exists {
+			t.Error("Undone record set still exists")
+		}
+		if len(cfg.Records["default"]) != 2 {
+			t.Errorf("Expected 2 records in default, got %d", len(cfg.Records["default"]))
+		}
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		if err := writer.Rollback(1); err != nil {
+			t.Fatalf("Rollback failed: %v", err)
+		}
+
+		data, err := os.ReadFile(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry, err := config.HistoryAt(configPath, 1)
+		if err != nil {
+			t.Fatalf("HistoryAt failed: %v", err)
+		}
+		if string(data) != entry.Files[0].Content {
+			t.Errorf("Expected the file of revision 1, got:\n%s", data)
+		}
+
+		if err := writer.Rollback(99); err == nil {
+			t.Error("Expected error for an unknown revision")
+		}
+	})
+
+	t.Run("HandEditUndone", func(t *testing.T) {
+		before, err := os.ReadFile(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		writeTestFile(t, configPath, string(before)+"# edited\n")
+
+		if _, err := writer.Undo(); err != nil {
+			t.Fatalf("Undo failed: %v", err)
+		}
+		after, err := os.ReadFile(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(after) != string(before) {
+			t.Errorf("Expected the edit by hand to be reverted, got:\n%s", after)
+		}
+	})
+}
+
+func TestRollbackValidates(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "reghost.yml")
+	writeTestFile(t, configPath, `activeRecord: default
+records:
+  default:
+    - domain: reghost.local
+      ip: 127.0.0.1
+`)
+
+	writer := config.NewWriter(configPath)
+	if err := writer.AddRecord("default", reghost.Record{Domain: "a.local", IP: "10.0.0.1"}); err != nil {
+		t.Fatalf("AddRecord failed: %v", err)
+	}
+	valid, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A broken edit by hand is recorded by the next rollback
+	writeTestFile(t, configPath, `activeRecord: missing
+records:
+  default:
+    - domain: reghost.local
+      ip: 127.0.0.1
+`)
+	if err := writer.Rollback(2); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+
+	entries, err := config.History(configPath)
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("Expected 4 revisions, got %d", len(entries))
+	}
+
+	if err := writer.Rollback(3); err == nil {
+		t.Error("Expected rollback to an invalid revision to fail")
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(valid) {
+		t.Errorf("Config was changed by the failed rollback:\n%s", data)
+	}
+}
+
+func TestRollbackRemovesNewFragments(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "reghost.yml")
+	writeTestFile(t, configPath, `activeRecord: default
+records:
+  default:
+    - domain: reghost.local
+      ip: 127.0.0.1
+  team:
+    - domain: team.local
+      ip: 10.0.0.1
+`)
+
+	writer := config.NewWriter(configPath)
+	if err := writer.AddRecord("default", reghost.Record{Domain: "a.local", IP: "10.0.0.2"}); err != nil {
+		t.Fatalf("AddRecord failed: %v", err)
+	}
+	entries, err := config.History(configPath)
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	target := entries[len(entries)-1]
+
+	// The team set moves to a fragment created after the target revision
+	if err := writer.DeleteRecordSet("team"); err != nil {
+		t.Fatalf("DeleteRecordSet failed: %v", err)
+	}
+	fragment := filepath.Join(config.FragmentDir(configPath), "team.yml")
+	writeTestFile(t, fragment, "records:\n  team:\n    - domain: team.local\n      ip: 10.0.0.9\n")
+	if err := writer.AddRecord("default", reghost.Record{Domain: "b.local", IP: "10.0.0.3"}); err != nil {
+		t.Fatalf("AddRecord failed: %v", err)
+	}
+
+	if err := writer.Rollback(target.Revision); err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if _, err := os.Stat(fragment); !os.IsNotExist(err) {
+		t.Errorf("Expected the fragment created after the revision to be removed, got %v", err)
+	}
+	if !target.IsCurrent(configPath) {
+		t.Error("Expected the files of the revision to be restored exactly")
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Load failed after rollback: %v", err)
+	}
+	if records := cfg.Records["team"]; len(records) != 1 || records[0].IP != "10.0.0.1" {
+		t.Errorf("Expected the team set of the revision, got %+v", records)
+	}
+
+	// The rollback can be undone, bringing the fragment back
+	if _, err := writer.Undo(); err != nil {
+		t.Fatalf("Undo failed: %v", err)
+	}
+	if _, err := os.Stat(fragment); err != nil {
+		t.Errorf("Expected undo to restore the fragment, got %v", err)
+	}
+}
+
+func TestRollbackRejectsForeignFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "reghost.yml")
+	writeTestFile(t, configPath, `activeRecord: default
+records:
+  default:
+    - domain: reghost.local
+      ip: 127.0.0.1
+`)
+
+	writer := config.NewWriter(configPath)
+	if err := writer.AddRecord("default", reghost.Record{Domain: "a.local", IP: "10.0.0.1"}); err != nil {
+		t.Fatalf("AddRecord failed: %v", err)
+	}
+
+	// A history entry naming a file outside the config and its fragments
+	outside := filepath.Join(tempDir, "outside.txt")
+	entry, err := config.HistoryAt(configPath, 1)
+	if err != nil {
+		t.Fatalf("HistoryAt failed: %v", err)
+	}
+	entry.Files = append(entry.Files, config.HistoryFile{Path: outside, Content: "owned\n"})
+	data, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(config.HistoryDir(configPath), "000001.json"), string(data))
+
+	if err := writer.Rollback(1); err == nil {
+		t.Error("Expected rollback to a revision with a foreign file to fail")
+	}
+	if _, err := os.Stat(outside); !os.IsNotExist(err) {
+		t.Errorf("Expected the foreign file not to be written, got %v", err)
+	}
+}
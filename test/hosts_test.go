@@ -0,0 +1,147 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bilgehannal/reghost/internal/hosts"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+const systemHostsFile = `127.0.0.1	localhost
+::1	localhost ip6-localhost
+
+# Added by the VPN client
+10.8.0.1	vpn.corp
+`
+
+func TestHostsRender(t *testing.T) {
+	records := []reghost.Record{
+		{Domain: "api.local", IP: "10.0.0.1"},
+		{Domain: `^.+\.dev\.local\.$`, IP: "127.0.0.1"},
+		{Domain: "api.local", IP: "10.0.0.9"},
+		{Domain: "v6.local.", IP: "fd00::1"},
+	}
+	entries := hosts.Entries(records)
+	assertRecords(t, entries, []reghost.Record{
+		{Domain: "api.local", IP: "10.0.0.1"},
+		{Domain: "v6.local", IP: "fd00::1"},
+	})
+
+	t.Run("Append", func(t *testing.T) {
+		got := string(hosts.Render([]byte(systemHostsFile), entries))
+		want := systemHostsFile + "\n" + hosts.BeginMarker + "\n10.0.0.1\tapi.local\nfd00::1\tv6.local\n" + hosts.EndMarker + "\n"
+		if got != want {
+			t.Errorf("Unexpected content:\n%s", got)
+		}
+	})
+
+	t.Run("ReplaceInPlace", func(t *testing.T) {
+		content := "127.0.0.1 localhost\n" + hosts.BeginMarker + "\n10.0.0.5 old.local\n" + hosts.EndMarker + "\n10.8.0.1 vpn.corp\n"
+		got := string(hosts.Render([]byte(content), entries[:1]))
+		want := "127.0.0.1 localhost\n" + hosts.BeginMarker + "\n10.0.0.1\tapi.local\n" + hosts.EndMarker + "\n10.8.0.1 vpn.corp\n"
+		if got != want {
+			t.Errorf("Unexpected content:\n%s", got)
+		}
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		rendered := hosts.Render([]byte(systemHostsFile), entries)
+		if got := string(hosts.Render(rendered, nil)); got != systemHostsFile {
+			t.Errorf("Expected the original content back, got:\n%s", got)
+		}
+	})
+
+	t.Run("MissingEndMarker", func(t *testing.T) {
+		content := hosts.BeginMarker + "\n10.8.0.1 vpn.corp\n"
+		got := string(hosts.Render([]byte(content), nil))
+		if got != "10.8.0.1 vpn.corp\n" {
+			t.Errorf("Expected only the marker to be dropped, got:\n%s", got)
+		}
+	})
+}
+
+func TestHostsManager(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	writeTestFile(t, path, systemHostsFile)
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := hosts.NewManager(path, newTestLogger(t))
+	readHosts := func() string {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	if err := manager.Update([]reghost.Record{{Domain: "api.local", IP: "10.0.0.1"}}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if !strings.Contains(readHosts(), "10.0.0.1\tapi.local") {
+		t.Fatalf("Record not written:\n%s", readHosts())
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600 to be kept, got %o", info.Mode().Perm())
+	}
+
+	t.Run("Reload", func(t *testing.T) {
+		if err := manager.Update([]reghost.Record{{Domain: "web.local", IP: "10.0.0.2"}}); err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		content := readHosts()
+		if strings.Contains(content, "api.local") || !strings.Contains(content, "10.0.0.2\tweb.local") {
+			t.Errorf("Block not updated:\n%s", content)
+		}
+	})
+
+	t.Run("Unchanged", func(t *testing.T) {
+		restored, err := manager.Sync()
+		if err != nil {
+			t.Fatalf("Sync failed: %v", err)
+		}
+		if restored {
+			t.Error("Expected an intact block to be left alone")
+		}
+	})
+
+	t.Run("RestoreRemoved", func(t *testing.T) {
+		// Something rewrites the hosts file without the block
+		writeTestFile(t, path, systemHostsFile+"10.9.0.1 new.corp\n")
+
+		restored, err := manager.Sync()
+		if err != nil {
+			t.Fatalf("Sync failed: %v", err)
+		}
+		if !restored {
+			t.Error("Expected the block to be restored")
+		}
+		content := readHosts()
+		if !strings.Contains(content, "10.9.0.1 new.corp") || !strings.Contains(content, "10.0.0.2\tweb.local") {
+			t.Errorf("Unexpected content:\n%s", content)
+		}
+	})
+
+	t.Run("Cleanup", func(t *testing.T) {
+		if err := manager.Cleanup(); err != nil {
+			t.Fatalf("Cleanup failed: %v", err)
+		}
+		if got := readHosts(); got != systemHostsFile+"10.9.0.1 new.corp\n" {
+			t.Errorf("Expected the block to be removed, got:\n%s", got)
+		}
+
+		// The block is not restored after cleanup
+		if restored, err := manager.Sync(); err != nil || restored {
+			t.Errorf("Expected Sync to do nothing after cleanup, got %v, %v", restored, err)
+		}
+	})
+}
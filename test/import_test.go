@@ -0,0 +1,235 @@
+package test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bilgehannal/reghost/internal/config"
+	"github.com/bilgehannal/reghost/internal/convert"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+func TestImportHosts(t *testing.T) {
+	input := `# Static table lookup for hostnames
+127.0.0.1	localhost
+::1		localhost ip6-localhost ip6-loopback
+10.0.0.1	api.local www.api.local   # staging
+fe80::1		v6.local
+not-an-ip	broken.local
+10.0.0.2
+`
+	records, issues, err := convert.Import(convert.FormatHosts, strings.NewReader(input), "")
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	want := []reghost.Record{
+		{Domain: "api.local", IP: "10.0.0.1"},
+		{Domain: "www.api.local", IP: "10.0.0.1"},
+	}
+	assertRecords(t, records, want)
+
+	// localhost, the 2 IPv6 lines, the invalid address and the line
+	// without a name
+	if len(issues) != 5 {
+		t.Errorf("Expected 5 issues, got %d: %v", len(issues), issues)
+	}
+	if len(issues) > 0 && issues[0].Line != 2 {
+		t.Errorf("Expected the first issue on line 2, got %d", issues[0].Line)
+	}
+}
+
+func TestImportDnsmasq(t *testing.T) {
+	input := `# dnsmasq.conf
+address=/dev.local/127.0.0.1
+address=/a.test/b.test/10.0.0.5
+address=/blocked.local/
+address=/#/10.0.0.9
+host-record=db.local,db,10.0.0.2,fd00::2
+server=8.8.8.8
+`
+	records, issues, err := convert.Import(convert.FormatDnsmasq, strings.NewReader(input), "")
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	want := []reghost.Record{
+		{Domain: convert.SubdomainPattern("dev.local"), IP: "127.0.0.1"},
+		{Domain: convert.SubdomainPattern("a.test"), IP: "10.0.0.5"},
+		{Domain: convert.SubdomainPattern("b.test"), IP: "10.0.0.5"},
+		{Domain: "db.local", IP: "10.0.0.2"},
+		{Domain: "db", IP: "10.0.0.2"},
+	}
+	assertRecords(t, records, want)
+
+	// address=/blocked.local/, address=/#/, the IPv6 host-record address
+	// and server=
+	if len(issues) != 4 {
+		t.Errorf("Expected 4 issues, got %d: %v", len(issues), issues)
+	}
+
+	// The rule matches the domain and its subdomains only
+	matcher := reghost.NewMatcher(records[:1])
+	for domain, match := range map[string]bool{
+		"dev.local.":     true,
+		"api.dev.local.": true,
+		"a.b.dev.local.": true,
+		"mydev.local.":   false,
+		"dev.local.com.": false,
+		"other.local.":   false,
+	} {
+		if _, ok := matcher.Match(domain); ok != match {
+			t.Errorf("Match(%s) = %v, want %v", domain, ok, match)
+		}
+	}
+}
+
+func TestImportZone(t *testing.T) {
+	input := `$TTL 300
+@	IN SOA ns.example.test. admin.example.test. 1 3600 600 86400 300
+@	IN A 10.0.0.1
+www	IN A 10.0.0.2
+www	IN AAAA fd00::2
+*.apps	IN A 10.0.0.3
+mail	IN MX 10 mx.example.test.
+`
+	records, issues, err := convert.Import(convert.FormatZone, strings.NewReader(input), "example.test")
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	want := []reghost.Record{
+		{Domain: "example.test", IP: "10.0.0.1"},
+		{Domain: "www.example.test", IP: "10.0.0.2"},
+		{Domain: convert.WildcardPattern("apps.example.test"), IP: "10.0.0.3"},
+	}
+	assertRecords(t, records, want)
+
+	if len(issues) != 3 {
+		t.Errorf("Expected the SOA, AAAA and MX records as issues, got %v", issues)
+	}
+
+	if _, _, err := convert.Import(convert.FormatZone, strings.NewReader("www IN A not-an-ip\n"), "example.test"); err == nil {
+		t.Error("Expected an error for a malformed zone")
+	}
+	if _, _, err := convert.Import("bind", strings.NewReader(""), ""); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestImportJSON(t *testing.T) {
+	input := `[
+  {"id": "api", "domain": "api.test", "ip": "10.0.0.1", "set": "dev"},
+  {"domain": "^[a-z]+\\.apps\\.test\\.$", "ip": "10.0.0.2"},
+  {"domain": "broken.test"},
+  {"domain": "bogus.test", "ip": "bogus"},
+  {"domain": "v6.test", "ip": "fd00::1"}
+]`
+	records, issues, err := convert.Import(convert.FormatJSON, strings.NewReader(input), "")
+	if err != nil {
+		t.Fatalf("Import failed: %v", err)
+	}
+
+	assertRecords(t, records, []reghost.Record{
+		{Domain: "api.test", IP: "10.0.0.1"},
+		{Domain: `^[a-z]+\.apps\.test\.$`, IP: "10.0.0.2"},
+	})
+	if records[0].ID != "api" || records[0].Set != "" {
+		t.Errorf("Expected the ID to be kept and the set dropped, got %+v", records[0])
+	}
+	if len(issues) != 3 {
+		t.Errorf("Expected the empty, invalid and IPv6 entries as issues, got %v", issues)
+	}
+
+	if _, _, err := convert.Import(convert.FormatJSON, strings.NewReader("{"), ""); err == nil {
+		t.Error("Expected invalid JSON to fail")
+	}
+}
+
+func TestImportCommand(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "reghost.yml")
+	writeTestFile(t, configPath, `activeRecord: default
+records:
+  default:
+    - domain: api.local
+      ip: 10.0.0.1
+`)
+	hostsPath := filepath.Join(t.TempDir(), "hosts")
+	writeTestFile(t, hostsPath, `127.0.0.1 localhost
+10.0.0.1 api.local
+10.0.0.2 web.local
+`)
+
+	t.Run("DryRun", func(t *testing.T) {
+		out, code := runCLI(t, "-c", configPath, "import", "-f", "hosts", "-s", "default", "--dry-run", hostsPath)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d: %s", code, out)
+		}
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cfg.Records["default"]) != 1 {
+			t.Errorf("Dry run changed the config: %v", cfg.Records["default"])
+		}
+	})
+
+	t.Run("Merge", func(t *testing.T) {
+		out, code := runCLI(t, "-c", configPath, "import", "-f", "hosts", "-s", "default", hostsPath)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d: %s", code, out)
+		}
+		if !strings.Contains(out, "localhost") {
+			t.Errorf("Expected the skipped entry to be reported, got:\n%s", out)
+		}
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertDomains(t, cfg.Records["default"], "api.local", "web.local")
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		dnsmasqPath := filepath.Join(t.TempDir(), "dnsmasq.conf")
+		writeTestFile(t, dnsmasqPath, "address=/dev.local/127.0.0.1\n")
+
+		out, code := runCLI(t, "-c", configPath, "-o", "json", "import", "-f", "dnsmasq", "-s", "default", "--replace", dnsmasqPath)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d: %s", code, out)
+		}
+		if !strings.Contains(out, `"replaced": true`) {
+			t.Errorf("Expected a JSON result, got:\n%s", out)
+		}
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertDomains(t, cfg.Records["default"], convert.SubdomainPattern("dev.local"))
+	})
+
+	t.Run("NewSet", func(t *testing.T) {
+		_, code := runCLI(t, "-c", configPath, "import", "-f", "hosts", "-s", "imported", hostsPath)
+		if code != 0 {
+			t.Fatalf("Expected exit code 0, got %d", code)
+		}
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertDomains(t, cfg.Records["imported"], "api.local", "web.local")
+	})
+}
+
+// assertRecords checks the domains and addresses of records, in order
+func assertRecords(t *testing.T, got, want []reghost.Record) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d records, got %d: %v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i].Domain != want[i].Domain || got[i].IP != want[i].IP {
+			t.Errorf("Record %d: expected %s -> %s, got %s -> %s", i, want[i].Domain, want[i].IP, got[i].Domain, got[i].IP)
+		}
+	}
+}
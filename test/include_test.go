@@ -0,0 +1,168 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bilgehannal/reghost/internal/config"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+// writeIncludeConfig creates a config file with a fragment directory and an
+// included file, returning the config path
+func writeIncludeConfig(t *testing.T) string {
+	t.Helper()
+
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "reghost.yml")
+
+	files := map[string]string{
+		"reghost.yml": `activeRecord: [mine, team]
+include:
+  - projects/*.yml
+records:
+  mine:
+    - domain: api.dev.local
+      ip: 127.0.0.1
+`,
+		"reghost.d/team.yml": `# Shared team records
+records:
+  team:
+    - domain: api.dev.local
+      ip: 10.0.0.1
+    - domain: db.dev.local
+      ip: 10.0.0.2
+`,
+		"projects/shop.yml": `records:
+  shop:
+    extends: [team]
+    records:
+      - domain: shop.dev.local
+        ip: 10.0.0.3
+`,
+	}
+	for name, content := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	return configPath
+}
+
+func TestLoadIncludes(t *testing.T) {
+	configPath := writeIncludeConfig(t)
+	dir := filepath.Dir(configPath)
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	sources := map[string]string{
+		"mine": configPath,
+		"team": filepath.Join(dir, "reghost.d", "team.yml"),
+		"shop": filepath.Join(dir, "projects", "shop.yml"),
+	}
+	for name, file := range sources {
+		if cfg.Sources[name] != file {
+			t.Errorf("Expected record set %s from %s, got %s", name, file, cfg.Sources[name])
+		}
+	}
+
+	if records := cfg.GetRecordSet("shop"); len(records) != 3 {
+		t.Errorf("Expected shop to inherit team records, got %v", records)
+	}
+
+	// The same record set in two files is a conflict
+	conflict := "records:\n  team:\n    - domain: x.local\n      ip: 127.0.0.1\n"
+	if err := os.WriteFile(filepath.Join(dir, "reghost.d", "other.yml"), []byte(conflict), 0644); err != nil {
+		t.Fatalf("Failed to write fragment: %v", err)
+	}
+	if _, err := config.Load(configPath); err == nil || !strings.Contains(err.Error(), "defined in both") {
+		t.Errorf("Expected duplicate record set error, got %v", err)
+	}
+}
+
+func TestWriterRespectsIncludes(t *testing.T) {
+	configPath := writeIncludeConfig(t)
+	dir := filepath.Dir(configPath)
+	teamPath := filepath.Join(dir, "reghost.d", "team.yml")
+	shopPath := filepath.Join(dir, "projects", "shop.yml")
+	shopBefore, _ := os.ReadFile(shopPath)
+
+	writer := config.NewWriter(configPath)
+	if err := writer.AddRecord("team", reghost.Record{Domain: "cache.dev.local", IP: "10.0.0.4"}); err != nil {
+		t.Fatalf("AddRecord failed: %v", err)
+	}
+
+	team, _ := os.ReadFile(teamPath)
+	if !strings.Contains(string(team), "cache.dev.local") {
+		t.Errorf("Expected new record in %s, got:\n%s", teamPath, team)
+	}
+	main, _ := os.ReadFile(configPath)
+	if strings.Contains(string(main), "team:") || !strings.Contains(string(main), "include:") {
+		t.Errorf("Expected main file to keep only its own record sets, got:\n%s", main)
+	}
+	if shopAfter, _ := os.ReadFile(shopPath); string(shopAfter) != string(shopBefore) {
+		t.Errorf("Expected untouched fragment to stay unchanged, got:\n%s", shopAfter)
+	}
+
+	// New record sets go to the main file
+	if err := writer.CreateRecordSet("new"); err != nil {
+		t.Fatalf("CreateRecordSet failed: %v", err)
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+	if cfg.Sources["new"] != configPath {
+		t.Errorf("Expected new record set in main file, got %s", cfg.Sources["new"])
+	}
+}
+
+func TestWriterRestoresFragmentsOnFailure(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("directory permissions do not apply to root")
+	}
+
+	configPath := writeIncludeConfig(t)
+	dir := filepath.Dir(configPath)
+	teamPath := filepath.Join(dir, "reghost.d", "team.yml")
+
+	// Record the history first, it lives next to the config file
+	writer := config.NewWriter(configPath)
+	if err := writer.AddRecord("mine", reghost.Record{Domain: "web.dev.local", IP: "127.0.0.2"}); err != nil {
+		t.Fatalf("AddRecord failed: %v", err)
+	}
+	teamBefore, err := os.ReadFile(teamPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	cfg.Records["team"] = append(cfg.Records["team"], reghost.Record{Domain: "cache.dev.local", IP: "10.0.0.4"})
+	cfg.Records["mine"] = append(cfg.Records["mine"], reghost.Record{Domain: "docs.dev.local", IP: "127.0.0.3"})
+
+	// The fragment can be written, the main file cannot
+	if err := os.Chmod(dir, 0555); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0755)
+
+	if err := writer.Write(cfg); err == nil {
+		t.Fatal("Expected the write of the main file to fail")
+	}
+	if teamAfter, _ := os.ReadFile(teamPath); string(teamAfter) != string(teamBefore) {
+		t.Errorf("Expected the fragment to be restored, got:\n%s", teamAfter)
+	}
+}
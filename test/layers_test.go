@@ -0,0 +1,140 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bilgehannal/reghost/internal/config"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+	"gopkg.in/yaml.v3"
+)
+
+func TestLayeredActiveRecords(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "test.yml")
+
+	testConfig := `activeRecord: [feature, personal, base]
+records:
+  base:
+    - domain: api.dev.local
+      ip: 10.0.0.1
+    - domain: db.dev.local
+      ip: 10.0.0.2
+  personal:
+    - domain: db.dev.local
+      ip: 127.0.0.1
+  feature:
+    - domain: api.dev.local
+      ip: 10.0.9.1
+`
+	if err := os.WriteFile(configPath, []byte(testConfig), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	records := cfg.GetActiveRecords()
+	expected := []reghost.Record{
+		{Domain: "api.dev.local", IP: "10.0.9.1", Set: "feature"},
+		{Domain: "db.dev.local", IP: "127.0.0.1", Set: "personal"},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("Expected %d merged records, got %v", len(expected), records)
+	}
+	for i := range expected {
+		if records[i] != expected[i] {
+			t.Errorf("Record %d: expected %+v, got %+v", i, expected[i], records[i])
+		}
+	}
+
+	cfg.SetActive(reghost.RecordSetNames{"base", "base"})
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for record set listed twice")
+	}
+}
+
+func TestActivateDeactivate(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "test.yml")
+
+	writer := config.NewWriter(configPath)
+	if err := writer.Write(&reghost.Config{
+		ActiveRecord: "base",
+		Records: map[string][]reghost.Record{
+			"base":    {{Domain: "api.dev.local", IP: "10.0.0.1"}},
+			"feature": {{Domain: "api.dev.local", IP: "10.0.9.1"}},
+		},
+	}); err != nil {
+		t.Fatalf("Failed to write initial config: %v", err)
+	}
+
+	if err := writer.ActivateRecordSet("feature"); err != nil {
+		t.Fatalf("ActivateRecordSet failed: %v", err)
+	}
+	cfg, _ := config.Load(configPath)
+	if cfg.Active().String() != "feature, base" {
+		t.Errorf("Expected active sets 'feature, base', got '%s'", cfg.Active())
+	}
+
+	if err := writer.ActivateRecordSet("missing"); err == nil {
+		t.Error("Expected error when activating unknown record set")
+	}
+
+	removed, err := writer.DeactivateRecordSet("")
+	if err != nil {
+		t.Fatalf("DeactivateRecordSet failed: %v", err)
+	}
+	if removed != "feature" {
+		t.Errorf("Expected top set 'feature' to be removed, got '%s'", removed)
+	}
+
+	// A single active set is written back as a scalar
+	data, _ := os.ReadFile(configPath)
+	if !strings.Contains(string(data), "activeRecord: base\n") {
+		t.Errorf("Expected scalar activeRecord, got:\n%s", data)
+	}
+
+	if _, err := writer.DeactivateRecordSet("base"); err == nil {
+		t.Error("Expected error when deactivating the only active set")
+	}
+}
+
+func TestActiveRecordCompatibility(t *testing.T) {
+	cfg := &reghost.Config{
+		ActiveRecord: "base",
+		Records: map[string][]reghost.Record{
+			"base":    {{Domain: "api.dev.local", IP: "10.0.0.1"}},
+			"feature": {{Domain: "api.dev.local", IP: "10.0.9.1"}},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Expected a single ActiveRecord to be valid, got %v", err)
+	}
+
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "activeRecord: base\n") {
+		t.Errorf("Expected a single active set to be written as a name, got:\n%s", data)
+	}
+
+	var loaded reghost.Config
+	if err := yaml.Unmarshal([]byte("activeRecord: [feature, base]\n"), &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ActiveRecord != "feature" {
+		t.Errorf("Expected ActiveRecord to be the top set 'feature', got '%s'", loaded.ActiveRecord)
+	}
+
+	// Setting ActiveRecord replaces the top set and keeps the layers below
+	loaded.ActiveRecord = "base"
+	if loaded.Active().String() != "base" {
+		t.Errorf("Expected active sets 'base', got '%s'", loaded.Active())
+	}
+}
@@ -0,0 +1,212 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bilgehannal/reghost/internal/cli"
+	"gopkg.in/yaml.v3"
+)
+
+// runCLI runs reghostctl with args and returns its standard output and the
+// exit code it would exit with
+func runCLI(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		out <- buf.String()
+	}()
+
+	cmd := cli.NewRootCommand()
+	cmd.SetArgs(args)
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	runErr := cmd.Execute()
+
+	w.Close()
+	return <-out, cli.ExitCode(runErr)
+}
+
+func writeOutputConfig(t *testing.T) string {
+	t.Helper()
+
+	configPath := filepath.Join(t.TempDir(), "reghost.yml")
+	writeTestFile(t, configPath, `activeRecord: [dev, base]
+records:
+  zeta:
+    - domain: z.local
+      ip: 10.0.0.9
+  base:
+    - id: api
+      domain: api.local
+      ip: 10.0.0.1
+    - domain: '^[a-z]+\.base\.local\.$'
+      ip: 10.0.0.2
+  dev:
+    - domain: api.local
+      ip: 127.0.0.1
+  alpha:
+    - domain: a.local
+      ip: 10.0.0.3
+`)
+	return configPath
+}
+
+func TestListOutput(t *testing.T) {
+	configPath := writeOutputConfig(t)
+
+	out, code := runCLI(t, "-c", configPath, "list", "-o", "json")
+	if code != cli.ExitOK {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+
+	var list struct {
+		ActiveRecord []string `json:"activeRecord"`
+		RecordSets   []struct {
+			Name    string `json:"name"`
+			Active  bool   `json:"active"`
+			Records []struct {
+				ID     string `json:"id"`
+				Domain string `json:"domain"`
+			} `json:"records"`
+		} `json:"recordSets"`
+	}
+	if err := json.Unmarshal([]byte(out), &list); err != nil {
+		t.Fatalf("Invalid JSON output: %v\n%s", err, out)
+	}
+
+	var names []string
+	for _, set := range list.RecordSets {
+		names = append(names, set.Name)
+	}
+	want := []string{"alpha", "base", "dev", "zeta"}
+	if len(names) != len(want) {
+		t.Fatalf("Expected sets %v, got %v", want, names)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("Expected sets %v in order, got %v", want, names)
+		}
+	}
+	if !list.RecordSets[1].Active || list.RecordSets[0].Active {
+		t.Error("Expected only the active sets to be marked active")
+	}
+	if list.RecordSets[1].Records[0].ID != "api" {
+		t.Errorf("Expected record ID 'api', got '%s'", list.RecordSets[1].Records[0].ID)
+	}
+
+	// Output is stable across runs
+	for i := 0; i < 5; i++ {
+		again, _ := runCLI(t, "-c", configPath, "list", "-o", "json")
+		if again != out {
+			t.Fatal("list output changed between runs")
+		}
+		table, _ := runCLI(t, "-c", configPath, "list")
+		first, _ := runCLI(t, "-c", configPath, "list")
+		if table != first {
+			t.Fatal("table output changed between runs")
+		}
+	}
+}
+
+func TestShowAndResolveOutput(t *testing.T) {
+	configPath := writeOutputConfig(t)
+
+	out, code := runCLI(t, "-c", configPath, "show", "-o", "yaml")
+	if code != cli.ExitOK {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	var show struct {
+		ActiveRecord []string `yaml:"activeRecord"`
+		Records      []struct {
+			Domain string `yaml:"domain"`
+			IP     string `yaml:"ip"`
+			Set    string `yaml:"set"`
+		} `yaml:"records"`
+	}
+	if err := yaml.Unmarshal([]byte(out), &show); err != nil {
+		t.Fatalf("Invalid YAML output: %v\n%s", err, out)
+	}
+	if len(show.Records) != 2 || show.Records[0].Set != "dev" || show.Records[1].Set != "base" {
+		t.Errorf("Unexpected merged rules: %+v", show.Records)
+	}
+
+	out, code = runCLI(t, "-c", configPath, "resolve", "www.base.local", "-o", "json")
+	if code != cli.ExitOK {
+		t.Fatalf("Expected exit code 0, got %d", code)
+	}
+	var resolved struct {
+		IP   string `json:"ip"`
+		Rule struct {
+			Set    string `json:"set"`
+			Domain string `json:"domain"`
+		} `json:"rule"`
+	}
+	if err := json.Unmarshal([]byte(out), &resolved); err != nil {
+		t.Fatalf("Invalid JSON output: %v\n%s", err, out)
+	}
+	if resolved.IP != "10.0.0.2" || resolved.Rule.Set != "base" {
+		t.Errorf("Expected the base regex rule, got %+v", resolved)
+	}
+
+	out, _ = runCLI(t, "-c", configPath, "resolve", "api.local", "-o", "json", "--record-set", "base")
+	if err := json.Unmarshal([]byte(out), &resolved); err != nil {
+		t.Fatalf("Invalid JSON output: %v\n%s", err, out)
+	}
+	if resolved.IP != "10.0.0.1" {
+		t.Errorf("Expected 10.0.0.1 from the base set, got %s", resolved.IP)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	configPath := writeOutputConfig(t)
+
+	invalidPath := filepath.Join(t.TempDir(), "invalid.yml")
+	writeTestFile(t, invalidPath, `activeRecord: missing
+records:
+  default:
+    - domain: a.local
+      ip: 10.0.0.1
+`)
+
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"ok", []string{"-c", configPath, "show", "base"}, cli.ExitOK},
+		{"unknown flag", []string{"-c", configPath, "list", "--bogus"}, cli.ExitUsage},
+		{"extra argument", []string{"-c", configPath, "show", "a", "b"}, cli.ExitUsage},
+		{"missing required flag", []string{"-c", configPath, "add-record", "base", "-i", "1.2.3.4"}, cli.ExitUsage},
+		{"missing flag group", []string{"-c", configPath, "remove-record", "base"}, cli.ExitUsage},
+		{"bad output format", []string{"-c", configPath, "list", "-o", "xml"}, cli.ExitUsage},
+		{"invalid config", []string{"-c", invalidPath, "list"}, cli.ExitInvalidConfig},
+		{"missing set", []string{"-c", configPath, "show", "nope"}, cli.ExitNotFound},
+		{"missing record", []string{"-c", configPath, "remove-record", "base", "--id", "nope"}, cli.ExitNotFound},
+		{"no matching rule", []string{"-c", configPath, "resolve", "nothing.example"}, cli.ExitNotFound},
+		{"invalid edit", []string{"-c", configPath, "add-record", "base", "-d", "x.local", "-i", ""}, cli.ExitInvalidConfig},
+		{"unreadable status", []string{"-c", configPath, "status", "--status-file", t.TempDir()}, cli.ExitIO},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, code := runCLI(t, tt.args...); code != tt.want {
+				t.Errorf("Expected exit code %d, got %d", tt.want, code)
+			}
+		})
+	}
+}
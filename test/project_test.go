@@ -0,0 +1,151 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bilgehannal/reghost/internal/cli"
+	"github.com/bilgehannal/reghost/internal/config"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+func TestProjects(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "reghost.yml")
+
+	writer := config.NewWriter(configPath)
+	if err := writer.Write(&reghost.Config{
+		ActiveRecord: "default",
+		Records: map[string][]reghost.Record{
+			"default": {{Domain: "api.dev.local", IP: "127.0.0.1"}},
+		},
+	}); err != nil {
+		t.Fatalf("Failed to write initial config: %v", err)
+	}
+
+	shop := filepath.Join(tempDir, "shop")
+	broken := filepath.Join(tempDir, "broken")
+	missing := filepath.Join(tempDir, "missing")
+	for _, dir := range []string{shop, broken} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create project directory: %v", err)
+		}
+	}
+	shopFile := "records:\n  - domain: api.dev.local\n    ip: 10.0.0.1\n  - domain: shop.dev.local\n    ip: 10.0.0.2\n"
+	if err := os.WriteFile(filepath.Join(shop, config.ProjectFile), []byte(shopFile), 0644); err != nil {
+		t.Fatalf("Failed to write project file: %v", err)
+	}
+	brokenFile := "records:\n  - domain: ''\n    ip: 10.0.0.3\n"
+	if err := os.WriteFile(filepath.Join(broken, config.ProjectFile), []byte(brokenFile), 0644); err != nil {
+		t.Fatalf("Failed to write project file: %v", err)
+	}
+
+	for _, project := range []reghost.Project{
+		{Name: "shop", Path: shop},
+		{Name: "broken", Path: broken},
+		{Name: "missing", Path: missing},
+	} {
+		if err := writer.RegisterProject(project); err != nil {
+			t.Fatalf("RegisterProject(%s) failed: %v", project.Name, err)
+		}
+	}
+	if err := writer.RegisterProject(reghost.Project{Name: "shop", Path: tempDir}); err == nil {
+		t.Error("Expected error when registering a project name twice")
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	// Project records are served after the active set, namespaced
+	records := cfg.GetActiveRecords()
+	if len(records) != 2 || records[0].Set != "default" || records[1].Set != "project/shop" {
+		t.Errorf("Expected default record followed by project/shop record, got %+v", records)
+	}
+
+	expected := map[string]string{
+		"shop":    config.ProjectActive,
+		"broken":  config.ProjectInvalid,
+		"missing": config.ProjectMissing,
+	}
+	for _, state := range config.ProjectStates(cfg) {
+		if state.Status != expected[state.Name] {
+			t.Errorf("Project %s: expected status %s, got %s", state.Name, expected[state.Name], state.Status)
+		}
+	}
+
+	// Project records are owned by the project repository
+	if err := writer.AddRecord("project/shop", reghost.Record{Domain: "x.dev.local", IP: "10.0.0.9"}); err == nil {
+		t.Error("Expected error when editing a project record set")
+	}
+
+	if _, err := writer.UnregisterProject(shop); err != nil {
+		t.Fatalf("UnregisterProject failed: %v", err)
+	}
+	cfg, _ = config.Load(configPath)
+	if _, exists := cfg.Records["project/shop"]; exists || len(cfg.Projects) != 2 {
+		t.Errorf("Expected project shop to be unregistered, got projects %+v", cfg.Projects)
+	}
+}
+
+func TestActiveProjectFileRemoved(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "reghost.yml")
+	project := filepath.Join(tempDir, "shop")
+	projectFile := filepath.Join(project, config.ProjectFile)
+	writeTestFile(t, projectFile, "records:\n  - domain: shop.dev.local\n    ip: 10.0.0.2\n")
+
+	writer := config.NewWriter(configPath)
+	if err := writer.Write(&reghost.Config{
+		ActiveRecord: "default",
+		Records: map[string][]reghost.Record{
+			"default": {{Domain: "api.dev.local", IP: "127.0.0.1"}},
+		},
+	}); err != nil {
+		t.Fatalf("Failed to write initial config: %v", err)
+	}
+	if err := writer.RegisterProject(reghost.Project{Name: "shop", Path: project}); err != nil {
+		t.Fatalf("RegisterProject failed: %v", err)
+	}
+	if err := writer.ActivateRecordSet("project/shop"); err != nil {
+		t.Fatalf("ActivateRecordSet failed: %v", err)
+	}
+
+	if err := os.Remove(projectFile); err != nil {
+		t.Fatalf("Failed to remove project file: %v", err)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Load failed after the project file was removed: %v", err)
+	}
+	if records := cfg.GetActiveRecords(); len(records) != 1 || records[0].Domain != "api.dev.local" {
+		t.Errorf("Expected only the default record, got %+v", records)
+	}
+	if states := config.ProjectStates(cfg); len(states) != 1 || states[0].Status != config.ProjectMissing {
+		t.Errorf("Expected project shop to be missing, got %+v", states)
+	}
+
+	if err := writer.AddRecord("default", reghost.Record{Domain: "web.dev.local", IP: "127.0.0.2"}); err != nil {
+		t.Errorf("AddRecord failed while a project file is missing: %v", err)
+	}
+
+	output, code := runCLI(t, "-c", configPath, "project", "list")
+	if code != cli.ExitOK || !strings.Contains(output, config.ProjectMissing) {
+		t.Errorf("Expected project list to report the missing file, got exit %d: %s", code, output)
+	}
+
+	if _, err := writer.UnregisterProject("shop"); err != nil {
+		t.Fatalf("UnregisterProject failed: %v", err)
+	}
+	cfg, err = config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Load failed after unregistering: %v", err)
+	}
+	if len(cfg.Projects) != 0 || cfg.Active().Contains("project/shop") {
+		t.Errorf("Expected project shop to be unregistered, got %+v", cfg)
+	}
+}
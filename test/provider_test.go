@@ -0,0 +1,171 @@
+package test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bilgehannal/reghost/internal/convert"
+	"github.com/bilgehannal/reghost/internal/dns"
+	"github.com/bilgehannal/reghost/internal/provider"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+// runProvider runs a provider until the test ends and returns the channel
+// its updates are sent to
+func runProvider(t *testing.T, p reghost.Provider) <-chan []reghost.Record {
+	t.Helper()
+
+	updates := make(chan []reghost.Record, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- p.Run(ctx, func(records []reghost.Record) { updates <- records })
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Run returned %v", err)
+		}
+	})
+	return updates
+}
+
+// nextUpdate waits for the next update of a provider
+func nextUpdate(t *testing.T, updates <-chan []reghost.Record) []reghost.Record {
+	t.Helper()
+
+	select {
+	case records := <-updates:
+		return records
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for records")
+		return nil
+	}
+}
+
+func TestLayerPrecedence(t *testing.T) {
+	cache := dns.NewCache([]reghost.Record{
+		{Domain: "a.test", IP: "10.0.0.1"},
+		{Domain: "config.test", IP: "10.0.0.1"},
+	})
+
+	// Added out of rank order on purpose
+	cache.SetLayer("docker", dns.ProviderRank+1, []reghost.Record{
+		{Domain: "a.test", IP: "10.0.0.3"},
+		{Domain: "b.test", IP: "10.0.0.3"},
+		{Domain: "docker.test", IP: "10.0.0.3"},
+	})
+	cache.SetLayer("team", dns.ProviderRank, []reghost.Record{
+		{Domain: "b.test", IP: "10.0.0.2"},
+	})
+	cache.SetLayer("update", dns.UpdateRank, []reghost.Record{
+		{Domain: "config.test", IP: "10.0.0.9"},
+	})
+
+	tests := map[string]string{
+		"a.test.":      "10.0.0.1", // Config over providers
+		"b.test.":      "10.0.0.2", // Earlier provider over later one
+		"docker.test.": "10.0.0.3",
+		"config.test.": "10.0.0.9", // Dynamic updates over config
+	}
+	for domain, want := range tests {
+		if ip, ok := cache.Lookup(domain); !ok || ip != want {
+			t.Errorf("Lookup(%s) = %s, %v; want %s", domain, ip, ok, want)
+		}
+	}
+
+	// Updating a layer keeps its rank
+	cache.SetLayer("team", dns.UpdateRank, nil)
+	if ip, _ := cache.Lookup("b.test."); ip != "10.0.0.3" {
+		t.Errorf("Expected the docker record once the team layer is empty, got %s", ip)
+	}
+	if ip, _ := cache.Lookup("config.test."); ip != "10.0.0.9" {
+		t.Errorf("Expected the update layer to keep precedence, got %s", ip)
+	}
+}
+
+func TestDirProvider(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "10-team.json"), `[{"domain": "api.test", "ip": "10.0.0.1"}]`)
+	writeTestFile(t, filepath.Join(dir, "20-legacy.hosts"), "10.0.0.2 api.test legacy.test\n")
+	writeTestFile(t, filepath.Join(dir, "README.md"), "Not records\n")
+
+	updates := runProvider(t, provider.NewDir("team", dir, newTestLogger(t)))
+
+	records := nextUpdate(t, updates)
+	assertRecords(t, records, []reghost.Record{
+		{Domain: "api.test", IP: "10.0.0.1"},
+		{Domain: "api.test", IP: "10.0.0.2"},
+		{Domain: "legacy.test", IP: "10.0.0.2"},
+	})
+	if records[0].Set != "team" {
+		t.Errorf("Expected records to be annotated with the provider, got %q", records[0].Set)
+	}
+
+	t.Run("Added", func(t *testing.T) {
+		writeTestFile(t, filepath.Join(dir, "30-dev.conf"), "address=/dev.test/10.0.0.3\n")
+		want := reghost.Record{Domain: convert.SubdomainPattern("dev.test"), IP: "10.0.0.3", Set: "team"}
+		records := nextUpdate(t, updates)
+		for !slices.Contains(records, want) {
+			records = nextUpdate(t, updates)
+		}
+	})
+
+	t.Run("Removed", func(t *testing.T) {
+		if err := os.Remove(filepath.Join(dir, "20-legacy.hosts")); err != nil {
+			t.Fatal(err)
+		}
+		assertRecords(t, nextUpdate(t, updates), []reghost.Record{
+			{Domain: "api.test", IP: "10.0.0.1"},
+			{Domain: convert.SubdomainPattern("dev.test"), IP: "10.0.0.3"},
+		})
+	})
+}
+
+func TestExecProvider(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "records.json")
+	writeTestFile(t, output, `[{"domain": "api.test", "ip": "10.0.0.1"}]`)
+
+	command := []string{"cat", output}
+	updates := runProvider(t, provider.NewExec("vault", command, 20*time.Millisecond, newTestLogger(t)))
+
+	assertRecords(t, nextUpdate(t, updates), []reghost.Record{
+		{Domain: "api.test", IP: "10.0.0.1"},
+	})
+
+	t.Run("Changed", func(t *testing.T) {
+		writeTestFile(t, output, `[{"domain": "api.test", "ip": "10.0.0.2"}]`)
+		records := nextUpdate(t, updates)
+		assertRecords(t, records, []reghost.Record{
+			{Domain: "api.test", IP: "10.0.0.2"},
+		})
+		if records[0].Set != "vault" {
+			t.Errorf("Expected records to be annotated with the provider, got %q", records[0].Set)
+		}
+	})
+
+	t.Run("InvalidAddresses", func(t *testing.T) {
+		writeTestFile(t, output, `[
+  {"domain": "api.test", "ip": "10.0.0.3"},
+  {"domain": "bogus.test", "ip": "bogus"},
+  {"domain": "v6.test", "ip": "fd00::1"}
+]`)
+		assertRecords(t, nextUpdate(t, updates), []reghost.Record{
+			{Domain: "api.test", IP: "10.0.0.3"},
+		})
+	})
+
+	t.Run("Failed", func(t *testing.T) {
+		// The records of the last successful run are kept
+		writeTestFile(t, output, "not json")
+		select {
+		case records := <-updates:
+			t.Errorf("Unexpected update %v", records)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+}
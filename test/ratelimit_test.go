@@ -0,0 +1,226 @@
+package test
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/bilgehannal/reghost/internal/dns"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+	mdns "github.com/miekg/dns"
+)
+
+func newRateLimitConfig(limit *reghost.RateLimit) *reghost.Config {
+	return &reghost.Config{
+		ActiveRecord: "default",
+		Records: map[string][]reghost.Record{
+			"default": {{Domain: "api.dev.local", IP: "127.0.0.1"}},
+		},
+		RateLimit: limit,
+	}
+}
+
+func TestRateLimitValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *reghost.Config
+		wantErr bool
+	}{
+		{
+			name: "query rate",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "api.dev.local", IP: "127.0.0.1"}},
+				},
+				RateLimit: &reghost.RateLimit{QueriesPerSecond: 10},
+			},
+			wantErr: false,
+		},
+		{
+			name: "no rate",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "api.dev.local", IP: "127.0.0.1"}},
+				},
+				RateLimit: &reghost.RateLimit{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid IPv4 prefix length",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "api.dev.local", IP: "127.0.0.1"}},
+				},
+				RateLimit: &reghost.RateLimit{QueriesPerSecond: 10, IPv4Prefix: 33},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid IPv6 prefix length",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "api.dev.local", IP: "127.0.0.1"}},
+				},
+				RateLimit: &reghost.RateLimit{QueriesPerSecond: 10, IPv6Prefix: -1},
+			},
+			wantErr: true,
+		},
+		{
+			// Zero prefix lengths select the defaults
+			name: "default prefix lengths",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "api.dev.local", IP: "127.0.0.1"}},
+				},
+				RateLimit: &reghost.RateLimit{QueriesPerSecond: 10, IPv4Prefix: 0, IPv6Prefix: 0},
+			},
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestQueryRateLimit(t *testing.T) {
+	cfg := newRateLimitConfig(&reghost.RateLimit{QueriesPerSecond: 0.001, Burst: 3})
+	handler := dns.NewHandler(dns.NewCache(cfg.GetActiveRecords()), newTestLogger(t))
+	handler.Configure(cfg)
+
+	answered := 0
+	for i := 0; i < 5; i++ {
+		w := newFakeResponseWriter("10.0.0.1")
+		handler.ServeDNS(w, query("api.dev.local", mdns.TypeA))
+		if w.msg != nil {
+			answered++
+		}
+	}
+	if answered != 3 {
+		t.Errorf("Expected 3 answered queries within the burst, got %d", answered)
+	}
+
+	// Clients of the same /24 share the bucket, other networks do not
+	w := newFakeResponseWriter("10.0.0.2")
+	handler.ServeDNS(w, query("api.dev.local", mdns.TypeA))
+	if w.msg != nil {
+		t.Error("Expected client in the same prefix to be rate limited")
+	}
+	w = newFakeResponseWriter("10.0.1.1")
+	handler.ServeDNS(w, query("api.dev.local", mdns.TypeA))
+	if w.msg == nil {
+		t.Error("Expected client in another prefix to be answered")
+	}
+
+	metrics := handler.Metrics().Snapshot()
+	if metrics.Queries != 7 || metrics.RateLimited != 3 {
+		t.Errorf("Expected 7 queries and 3 rate limited, got %+v", metrics)
+	}
+}
+
+func TestResponseRateLimitSlip(t *testing.T) {
+	cfg := newRateLimitConfig(&reghost.RateLimit{ResponsesPerSecond: 2, Slip: 2})
+	handler := dns.NewHandler(dns.NewCache(cfg.GetActiveRecords()), newTestLogger(t))
+	handler.Configure(cfg)
+
+	var full, truncated, dropped int
+	for i := 0; i < 6; i++ {
+		w := newFakeResponseWriter("10.0.0.1")
+		handler.ServeDNS(w, query("api.dev.local", mdns.TypeA))
+		switch {
+		case w.msg == nil:
+			dropped++
+		case w.msg.Truncated && len(w.msg.Answer) == 0:
+			truncated++
+		default:
+			full++
+		}
+	}
+
+	if full != 2 || truncated != 2 || dropped != 2 {
+		t.Errorf("Expected 2 full, 2 truncated and 2 dropped responses, got %d, %d and %d", full, truncated, dropped)
+	}
+
+	metrics := handler.Metrics().Snapshot()
+	if metrics.RRLDropped != 2 || metrics.RRLSlipped != 2 {
+		t.Errorf("Expected 2 dropped and 2 slipped in metrics, got %+v", metrics)
+	}
+}
+
+func TestQueryRateLimitTCP(t *testing.T) {
+	cfg := newRateLimitConfig(&reghost.RateLimit{QueriesPerSecond: 0.001, Burst: 2, ResponsesPerSecond: 1, Slip: 1})
+	handler := dns.NewHandler(dns.NewCache(cfg.GetActiveRecords()), newTestLogger(t))
+	handler.Configure(cfg)
+
+	// Use up the UDP allowance; the last response slips
+	var w *fakeResponseWriter
+	for i := 0; i < 2; i++ {
+		w = newFakeResponseWriter("10.0.0.1")
+		handler.ServeDNS(w, query("api.dev.local", mdns.TypeA))
+	}
+	if w.msg == nil || !w.msg.Truncated {
+		t.Fatalf("Expected a truncated response, got %v", w.msg)
+	}
+
+	// The client retries over TCP as told
+	w = newFakeResponseWriter("10.0.0.1")
+	w.remote = &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 53535}
+	handler.ServeDNS(w, query("api.dev.local", mdns.TypeA))
+	if w.msg == nil || w.msg.Truncated || len(w.msg.Answer) != 1 {
+		t.Errorf("Expected the TCP retry to be answered, got %v", w.msg)
+	}
+
+	w = newFakeResponseWriter("10.0.0.1")
+	handler.ServeDNS(w, query("api.dev.local", mdns.TypeA))
+	if w.msg != nil {
+		t.Error("Expected further UDP queries to stay rate limited")
+	}
+}
+
+func TestRateLimitFloodOfPrefixes(t *testing.T) {
+	cfg := newRateLimitConfig(&reghost.RateLimit{QueriesPerSecond: 0.001, Burst: 1})
+	handler := dns.NewHandler(dns.NewCache(cfg.GetActiveRecords()), newTestLogger(t))
+	handler.Configure(cfg)
+
+	ask := func(client string) bool {
+		w := newFakeResponseWriter(client)
+		handler.ServeDNS(w, query("api.dev.local", mdns.TypeA))
+		return w.msg != nil
+	}
+
+	// Both clients use up their burst
+	for _, client := range []string{"192.168.1.1", "192.168.2.1"} {
+		ask(client)
+		if ask(client) {
+			t.Fatalf("Expected %s to be rate limited", client)
+		}
+	}
+
+	// A flood from more distinct prefixes than buckets are kept for, while
+	// the first client keeps querying
+	for i := 0; i < 20000; i++ {
+		ask(fmt.Sprintf("10.%d.%d.1", i/256, i%256))
+		if i%1000 == 0 && ask("192.168.1.1") {
+			t.Fatal("Expected the active client to stay rate limited during the flood")
+		}
+	}
+
+	// The idle client's bucket was evicted, the active one's was kept
+	if !ask("192.168.2.1") {
+		t.Error("Expected the least recently used bucket to be evicted")
+	}
+	if ask("192.168.1.1") {
+		t.Error("Expected the recently used bucket to be kept")
+	}
+}
@@ -0,0 +1,228 @@
+package test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bilgehannal/reghost/internal/config"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+func writeEditConfig(t *testing.T) (string, *config.Writer) {
+	t.Helper()
+
+	configPath := filepath.Join(t.TempDir(), "reghost.yml")
+	writeTestFile(t, configPath, `activeRecord: [dev, base]
+records:
+  base:
+    - domain: a.local
+      ip: 10.0.0.1
+    - domain: b.local
+      ip: 10.0.0.2
+    - domain: c.local
+      ip: 10.0.0.3
+  dev:
+    extends: [base]
+    records:
+      - domain: api.local
+        ip: 127.0.0.1
+views:
+  - name: office
+    clients: [10.0.0.0/8]
+    recordSet: base
+tsigKeys:
+  - name: update-key
+    secret: `+testTSIGSecret+`
+update:
+  keys: [update-key]
+  recordSet: base
+  persist: true
+`)
+	return configPath, config.NewWriter(configPath)
+}
+
+func TestUpdateRecord(t *testing.T) {
+	configPath, writer := writeEditConfig(t)
+
+	err := writer.UpdateRecord("base", 1, func(record *reghost.Record) {
+		record.IP = "10.0.0.20"
+	})
+	if err != nil {
+		t.Fatalf("UpdateRecord failed: %v", err)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	record := cfg.Records["base"][1]
+	if record.Domain != "b.local" || record.IP != "10.0.0.20" {
+		t.Errorf("Expected b.local -> 10.0.0.20, got %s -> %s", record.Domain, record.IP)
+	}
+
+	if err := writer.UpdateRecord("base", 5, func(*reghost.Record) {}); err == nil {
+		t.Error("Expected error for an invalid index")
+	}
+	err = writer.UpdateRecord("base", 0, func(record *reghost.Record) {
+		record.IP = ""
+	})
+	if err == nil {
+		t.Error("Expected error when the update makes the record invalid")
+	}
+}
+
+func TestUpdateRecordCommand(t *testing.T) {
+	configPath, _ := writeEditConfig(t)
+
+	// The record is picked by --domain, as in remove-record
+	out, code := runCLI(t, "-c", configPath, "update-record", "base", "--domain", "b.local", "--set-domain", "b.test", "--set-ip", "10.0.0.20")
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, out)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	record := cfg.Records["base"][1]
+	if record.Domain != "b.test" || record.IP != "10.0.0.20" {
+		t.Errorf("Expected b.test -> 10.0.0.20, got %s -> %s", record.Domain, record.IP)
+	}
+
+	if _, code := runCLI(t, "-c", configPath, "update-record", "base", "--domain", "a.local"); code == 0 {
+		t.Error("Expected an update without new values to fail")
+	}
+}
+
+func TestMoveRecord(t *testing.T) {
+	configPath, writer := writeEditConfig(t)
+
+	if err := writer.MoveRecord("base", 2, 0); err != nil {
+		t.Fatalf("MoveRecord failed: %v", err)
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	assertDomains(t, cfg.Records["base"], "c.local", "a.local", "b.local")
+
+	if err := writer.MoveRecord("base", 0, 2); err != nil {
+		t.Fatalf("MoveRecord failed: %v", err)
+	}
+	cfg, err = config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	assertDomains(t, cfg.Records["base"], "a.local", "b.local", "c.local")
+
+	if err := writer.MoveRecord("base", 0, 3); err == nil {
+		t.Error("Expected error for an invalid index")
+	}
+}
+
+func TestRenameRecordSet(t *testing.T) {
+	configPath, writer := writeEditConfig(t)
+
+	if err := writer.RenameRecordSet("base", "shared"); err != nil {
+		t.Fatalf("RenameRecordSet failed: %v", err)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if _, exists := cfg.Records["base"]; exists {
+		t.Error("Old record set still exists")
+	}
+	if len(cfg.Records["shared"]) != 3 {
+		t.Errorf("Expected 3 records in renamed set, got %d", len(cfg.Records["shared"]))
+	}
+	if cfg.Active().String() != "dev, shared" {
+		t.Errorf("Expected activeRecord 'dev, shared', got '%s'", cfg.Active())
+	}
+	if parents := cfg.Extends["dev"]; len(parents) != 1 || parents[0] != "shared" {
+		t.Errorf("Expected dev to extend shared, got %v", parents)
+	}
+	if cfg.Views[0].RecordSet != "shared" {
+		t.Errorf("Expected view to serve shared, got %s", cfg.Views[0].RecordSet)
+	}
+	if cfg.Update.RecordSet != "shared" {
+		t.Errorf("Expected dynamic updates to go to shared, got %s", cfg.Update.RecordSet)
+	}
+
+	if err := writer.RenameRecordSet("shared", "dev"); err == nil {
+		t.Error("Expected error when renaming to an existing set")
+	}
+	if err := writer.RenameRecordSet("missing", "other"); err == nil {
+		t.Error("Expected error when renaming a missing set")
+	}
+}
+
+func TestCopyRecordSet(t *testing.T) {
+	configPath, writer := writeEditConfig(t)
+
+	if err := writer.CopyRecordSet("dev", "staging"); err != nil {
+		t.Fatalf("CopyRecordSet failed: %v", err)
+	}
+	if err := writer.UpdateRecord("staging", 0, func(record *reghost.Record) {
+		record.IP = "10.1.0.1"
+	}); err != nil {
+		t.Fatalf("UpdateRecord failed: %v", err)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Records["dev"][0].IP != "127.0.0.1" {
+		t.Error("Editing the copy changed the original")
+	}
+	if parents := cfg.Extends["staging"]; len(parents) != 1 || parents[0] != "base" {
+		t.Errorf("Expected the copy to extend base, got %v", parents)
+	}
+	if got := len(cfg.GetRecordSet("staging")); got != 4 {
+		t.Errorf("Expected 4 resolved records in the copy, got %d", got)
+	}
+
+	if err := writer.CopyRecordSet("dev", "base"); err == nil {
+		t.Error("Expected error when copying to an existing set")
+	}
+}
+
+func TestCreateEmptyRecordSet(t *testing.T) {
+	configPath, writer := writeEditConfig(t)
+
+	if err := writer.CreateEmptyRecordSet("later"); err != nil {
+		t.Fatalf("CreateEmptyRecordSet failed: %v", err)
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if records, exists := cfg.Records["later"]; !exists || len(records) != 0 {
+		t.Errorf("Expected an empty record set, got %v", records)
+	}
+
+	// An empty set would serve nothing
+	if err := writer.ActivateRecordSet("later"); err == nil {
+		t.Error("Expected error when activating an empty set")
+	}
+	if err := writer.AddRecord("later", reghost.Record{Domain: "later.local", IP: "10.0.0.9"}); err != nil {
+		t.Fatalf("AddRecord failed: %v", err)
+	}
+	if err := writer.ActivateRecordSet("later"); err != nil {
+		t.Errorf("ActivateRecordSet failed: %v", err)
+	}
+}
+
+func assertDomains(t *testing.T, records []reghost.Record, domains ...string) {
+	t.Helper()
+	if len(records) != len(domains) {
+		t.Fatalf("Expected %d records, got %d", len(domains), len(records))
+	}
+	for i, domain := range domains {
+		if records[i].Domain != domain {
+			t.Errorf("Expected record %d to be %s, got %s", i, domain, records[i].Domain)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bilgehannal/reghost/internal/config"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+func TestRecordID(t *testing.T) {
+	explicit := reghost.Record{ID: "api", Domain: "api.local", IP: "10.0.0.1"}
+	if explicit.RecordID() != "api" {
+		t.Errorf("Expected explicit ID 'api', got '%s'", explicit.RecordID())
+	}
+
+	derived := reghost.Record{Domain: "api.local", IP: "10.0.0.1"}
+	if len(derived.RecordID()) != 8 || derived.RecordID() != derived.RecordID() {
+		t.Errorf("Expected a stable 8 digit derived ID, got '%s'", derived.RecordID())
+	}
+	other := reghost.Record{Domain: "api.local", IP: "10.0.0.2"}
+	if derived.RecordID() == other.RecordID() {
+		t.Error("Expected records with different IPs to have different IDs")
+	}
+
+	cfg := &reghost.Config{
+		ActiveRecord: "default",
+		Records: map[string][]reghost.Record{
+			"default": {
+				{ID: "dup", Domain: "a.local", IP: "10.0.0.1"},
+				{ID: "dup", Domain: "b.local", IP: "10.0.0.2"},
+			},
+		},
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for duplicate record IDs")
+	}
+}
+
+func TestRemoveRecordBy(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "reghost.yml")
+	writeTestFile(t, configPath, `activeRecord: default
+records:
+  default:
+    - domain: reghost.local
+      ip: 127.0.0.1
+    - id: api
+      domain: api.local
+      ip: 10.0.0.1
+    - domain: web.local
+      ip: 10.0.0.2
+    - domain: web.local
+      ip: 10.0.0.3
+`)
+	writer := config.NewWriter(configPath)
+
+	t.Run("DryRun", func(t *testing.T) {
+		before, err := os.ReadFile(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		writer.SetDryRun(true)
+		defer writer.SetDryRun(false)
+		change, err := writer.RemoveRecordBy("default", config.RecordSelector{ID: "api"})
+		if err != nil {
+			t.Fatalf("RemoveRecordBy failed: %v", err)
+		}
+		if change.Index != 1 || change.Before.Domain != "api.local" || change.After != nil {
+			t.Errorf("Unexpected change: %+v", change)
+		}
+
+		after, err := os.ReadFile(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(before) != string(after) {
+			t.Error("Dry run changed the config file")
+		}
+	})
+
+	t.Run("ByDomain", func(t *testing.T) {
+		_, err := writer.RemoveRecordBy("default", config.RecordSelector{Domain: "web.local"})
+		if err == nil || !strings.Contains(err.Error(), "matches 2 records") {
+			t.Fatalf("Expected an ambiguous match error, got %v", err)
+		}
+
+		change, err := writer.RemoveRecordBy("default", config.RecordSelector{Domain: "API.local."})
+		if err != nil {
+			t.Fatalf("RemoveRecordBy failed: %v", err)
+		}
+		if change.Before.ID != "api" {
+			t.Errorf("Expected the api record to be removed, got %+v", change.Before)
+		}
+	})
+
+	t.Run("ByDerivedID", func(t *testing.T) {
+		target := reghost.Record{Domain: "web.local", IP: "10.0.0.3"}
+		if _, err := writer.RemoveRecordBy("default", config.RecordSelector{ID: target.RecordID()}); err != nil {
+			t.Fatalf("RemoveRecordBy failed: %v", err)
+		}
+
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			t.Fatalf("Failed to load config: %v", err)
+		}
+		assertDomains(t, cfg.Records["default"], "reghost.local", "web.local")
+		if cfg.Records["default"][1].IP != "10.0.0.2" {
+			t.Errorf("Removed the wrong web.local record")
+		}
+
+		if _, err := writer.RemoveRecordBy("default", config.RecordSelector{ID: "missing"}); err == nil {
+			t.Error("Expected error for an unknown ID")
+		}
+	})
+}
+
+func TestUpdateRecordBy(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "reghost.yml")
+	writeTestFile(t, configPath, `activeRecord: default
+records:
+  default:
+    - domain: reghost.local
+      ip: 127.0.0.1
+    - id: api
+      domain: api.local
+      ip: 10.0.0.1
+`)
+	writer := config.NewWriter(configPath)
+
+	change, err := writer.UpdateRecordBy("default", config.RecordSelector{ID: "api"}, func(record *reghost.Record) {
+		record.IP = "10.0.0.9"
+	})
+	if err != nil {
+		t.Fatalf("UpdateRecordBy failed: %v", err)
+	}
+	if change.Before.IP != "10.0.0.1" || change.After == nil || change.After.IP != "10.0.0.9" {
+		t.Errorf("Unexpected change: %+v", change)
+	}
+
+	// The explicit ID survives the edit and a move
+	if err := writer.MoveRecord("default", 1, 0); err != nil {
+		t.Fatalf("MoveRecord failed: %v", err)
+	}
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if record := cfg.Records["default"][0]; record.ID != "api" || record.IP != "10.0.0.9" {
+		t.Errorf("Expected the api record first with IP 10.0.0.9, got %+v", record)
+	}
+}
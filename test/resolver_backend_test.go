@@ -0,0 +1,263 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bilgehannal/reghost/internal/resolver"
+	"github.com/bilgehannal/reghost/internal/sysstate"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+// fakeResolved emulates the links and the resolvectl commands of a machine
+// running systemd-resolved
+type fakeResolved struct {
+	links    map[string]bool
+	dns      map[string][]string
+	domains  map[string][]string
+	commands []string
+}
+
+func newFakeResolved() *fakeResolved {
+	return &fakeResolved{
+		links:   make(map[string]bool),
+		dns:     make(map[string][]string),
+		domains: make(map[string][]string),
+	}
+}
+
+func (f *fakeResolved) Run(name string, args ...string) ([]byte, error) {
+	command := strings.Join(append([]string{name}, args...), " ")
+	f.commands = append(f.commands, command)
+
+	if command == "resolvectl status" {
+		return []byte("Global\n"), nil
+	}
+
+	link := args[1]
+	if !f.links[link] {
+		return []byte("Failed to resolve interface"), errors.New("exit status 1")
+	}
+	switch args[0] {
+	case "dns", "domain":
+		values := f.dns
+		if args[0] == "domain" {
+			values = f.domains
+		}
+		if len(args) == 2 {
+			return []byte("Link 7 (" + link + "): " + strings.Join(values[link], " ") + "\n"), nil
+		}
+		values[link] = slices.Clone(args[2:])
+	case "revert":
+		delete(f.dns, link)
+		delete(f.domains, link)
+	}
+	return nil, nil
+}
+
+func (f *fakeResolved) HasLink(name string) bool {
+	return f.links[name]
+}
+
+func (f *fakeResolved) AddDummyLink(name string) error {
+	f.commands = append(f.commands, "add link "+name)
+	f.links[name] = true
+	return nil
+}
+
+func (f *fakeResolved) RemoveLink(name string) error {
+	if !f.links[name] {
+		return errors.New("link does not exist")
+	}
+	f.commands = append(f.commands, "remove link "+name)
+	delete(f.links, name)
+	delete(f.dns, name)
+	delete(f.domains, name)
+	return nil
+}
+
+// changes returns the commands run since the last call that change the
+// configuration, leaving out queries
+func (f *fakeResolved) changes() []string {
+	var changes []string
+	for _, command := range f.commands {
+		fields := strings.Fields(command)
+		query := command == "resolvectl status" ||
+			(fields[0] == "resolvectl" && len(fields) == 3 && fields[1] != "revert")
+		if !query {
+			changes = append(changes, command)
+		}
+	}
+	f.commands = nil
+	return changes
+}
+
+func TestResolvedInUse(t *testing.T) {
+	dir := t.TempDir()
+
+	stub := filepath.Join(dir, "resolv.conf")
+	if err := os.Symlink("/run/systemd/resolve/stub-resolv.conf", stub); err != nil {
+		t.Fatal(err)
+	}
+	if !resolver.ResolvedInUse(stub) {
+		t.Error("Expected a symlink to the stub file to be detected")
+	}
+
+	listed := filepath.Join(dir, "listed.conf")
+	writeTestFile(t, listed, "# managed by resolvconf\nnameserver 127.0.0.53\noptions edns0\n")
+	if !resolver.ResolvedInUse(listed) {
+		t.Error("Expected the stub listener to be detected")
+	}
+
+	static := filepath.Join(dir, "static.conf")
+	writeTestFile(t, static, "nameserver 10.0.0.53\n")
+	if resolver.ResolvedInUse(static) {
+		t.Error("Expected a static resolv.conf not to be detected")
+	}
+
+	logger := newTestLogger(t)
+	fake := newFakeResolved()
+	if _, ok := resolver.DetectLinuxBackend(fake, fake, listed, logger, nil).(*resolver.ResolvedBackend); !ok {
+		t.Error("Expected the systemd-resolved backend")
+	}
+	if _, ok := resolver.DetectLinuxBackend(fake, fake, static, logger, nil).(*resolver.ResolvConfBackend); !ok {
+		t.Error("Expected the resolv.conf backend")
+	}
+}
+
+func TestResolvedBackend(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	journal := sysstate.NewJournal(statePath)
+	fake := newFakeResolved()
+	backend := resolver.NewResolvedBackend(fake, fake, newTestLogger(t), journal)
+
+	records := []reghost.Record{
+		{Domain: "api.test", IP: "10.0.0.1"},
+		{Domain: `^[a-z]+\.dev\.local\.$`, IP: "127.0.0.1"},
+	}
+	if err := backend.Configure("127.1.2.3", records); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+
+	want := []string{
+		"add link reghost0",
+		"resolvectl dns reghost0 127.1.2.3",
+		"resolvectl domain reghost0 ~local ~test",
+		"resolvectl default-route reghost0 false",
+	}
+	if got := fake.changes(); !slices.Equal(got, want) {
+		t.Errorf("Expected commands %v, got %v", want, got)
+	}
+	if state := journal.State(); !slices.Equal(state.Links, []string{"reghost0"}) {
+		t.Errorf("Expected the link to be recorded, got %v", state.Links)
+	}
+
+	t.Run("Unchanged", func(t *testing.T) {
+		if err := backend.Configure("127.1.2.3", records); err != nil {
+			t.Fatalf("Configure failed: %v", err)
+		}
+		if got := fake.changes(); len(got) != 0 {
+			t.Errorf("Expected no changes, got %v", got)
+		}
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		records := append(records, reghost.Record{Domain: "db.internal", IP: "10.0.0.2"})
+		if err := backend.Configure("127.1.2.3", records); err != nil {
+			t.Fatalf("Configure failed: %v", err)
+		}
+		if got := fake.domains["reghost0"]; !slices.Equal(got, []string{"~internal", "~local", "~test"}) {
+			t.Errorf("Unexpected routing domains %v", got)
+		}
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		// systemd-resolved was restarted and lost the link settings
+		delete(fake.dns, "reghost0")
+		delete(fake.domains, "reghost0")
+
+		if err := backend.Configure("127.1.2.3", records); err != nil {
+			t.Fatalf("Configure failed: %v", err)
+		}
+		if got := fake.dns["reghost0"]; !slices.Equal(got, []string{"127.1.2.3"}) {
+			t.Errorf("DNS server not restored, got %v", got)
+		}
+	})
+
+	t.Run("Cleanup", func(t *testing.T) {
+		fake.changes()
+		if err := backend.Cleanup(); err != nil {
+			t.Fatalf("Cleanup failed: %v", err)
+		}
+		if fake.links["reghost0"] {
+			t.Error("Link not deleted")
+		}
+		if state := journal.State(); !state.Empty() {
+			t.Errorf("Expected nothing left to undo, got %+v", state)
+		}
+	})
+}
+
+func TestResolvConfBackend(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "resolv.conf")
+	original := "nameserver 10.0.0.53\nsearch corp\n"
+	writeTestFile(t, path, original)
+
+	journal := sysstate.NewJournal(filepath.Join(dir, "state.json"))
+	backend := resolver.NewResolvConfBackend(path, newTestLogger(t), journal)
+	readConf := func() string {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	if err := backend.Configure("127.1.2.3", nil); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	if got := readConf(); got != "nameserver 127.1.2.3\n"+original {
+		t.Errorf("Unexpected resolv.conf:\n%s", got)
+	}
+	if state := journal.State(); state.ResolvConf == nil || state.ResolvConf.Original != original {
+		t.Errorf("Expected the backup to be recorded, got %+v", state.ResolvConf)
+	}
+
+	// A VPN client rewrites resolv.conf
+	writeTestFile(t, path, "nameserver 10.8.0.1\n")
+	if err := backend.Configure("127.1.2.3", nil); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	if got := readConf(); got != "nameserver 127.1.2.3\nnameserver 10.8.0.1\n" {
+		t.Errorf("Nameserver not restored:\n%s", got)
+	}
+
+	if err := backend.Cleanup(); err != nil {
+		t.Fatalf("Cleanup failed: %v", err)
+	}
+	if got := readConf(); got != original {
+		t.Errorf("Original not restored:\n%s", got)
+	}
+	if state := journal.State(); state.ResolvConf != nil {
+		t.Error("Expected the backup to be dropped from the state")
+	}
+}
+
+func TestDomainSuffixes(t *testing.T) {
+	records := []reghost.Record{
+		{Domain: "api.test"},
+		{Domain: `^[a-zA-Z0-9-]+\.myhost\.$`},
+		{Domain: `^(api|web)\.example\.com$`},
+		{Domain: "other.test."},
+	}
+	want := []string{"com", "myhost", "test"}
+	if got := resolver.DomainSuffixes(records); !slices.Equal(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,261 @@
+package test
+
+import (
+	"context"
+
+	"net"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bilgehannal/reghost/internal/dns"
+	"github.com/bilgehannal/reghost/internal/platform"
+	"github.com/bilgehannal/reghost/internal/sysstate"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+	mdns "github.com/miekg/dns"
+)
+
+// freePort returns a UDP port that is currently unused on the loopback
+// interface
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+// waitFor polls cond until it holds or a second has passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServerLifecycle(t *testing.T) {
+	records := []reghost.Record{
+		{Domain: "api.test", IP: "10.0.0.1"},
+		{Domain: `^[a-z]+\.dev\.local\.$`, IP: "10.0.0.2"},
+	}
+	cache := dns.NewCache(records)
+	fake := platform.NewFake()
+	journal := sysstate.NewJournal(filepath.Join(t.TempDir(), "state.json"))
+
+	server := dns.NewServer(cache, newTestLogger(t), fake)
+	server.SetJournal(journal)
+	port := freePort(t)
+	server.SetPort(port)
+	server.SetCheckInterval(10 * time.Millisecond)
+
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	stopped := false
+	t.Cleanup(func() {
+		if !stopped {
+			server.Shutdown(context.Background())
+		}
+	})
+
+	bindIP := server.GetBindIP()
+	if !slices.Equal(fake.Aliases(), []string{bindIP}) {
+		t.Fatalf("Expected alias %s, got %v", bindIP, fake.Aliases())
+	}
+	if state := journal.State(); !slices.Equal(state.LoopbackAliases, []string{bindIP}) {
+		t.Errorf("Expected the alias to be recorded, got %v", state.LoopbackAliases)
+	}
+	ip, domains := fake.Resolver()
+	if ip != bindIP || !slices.Equal(domains, []string{"local", "test"}) {
+		t.Errorf("Unexpected resolver configuration %s %v", ip, domains)
+	}
+
+	t.Run("Query", func(t *testing.T) {
+		addr := net.JoinHostPort(bindIP, strconv.Itoa(port))
+		resp, _, err := new(mdns.Client).Exchange(query("web.dev.local", mdns.TypeA), addr)
+		if err != nil {
+			t.Fatalf("Exchange failed: %v", err)
+		}
+		if len(resp.Answer) != 1 || resp.Answer[0].(*mdns.A).A.String() != "10.0.0.2" {
+			t.Errorf("Unexpected answer %v", resp.Answer)
+		}
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		records := append(records, reghost.Record{Domain: "db.internal", IP: "10.0.0.3"})
+		cache.Update(records)
+		if err := server.UpdateResolverFiles(records); err != nil {
+			t.Fatalf("UpdateResolverFiles failed: %v", err)
+		}
+		if _, domains := fake.Resolver(); !slices.Equal(domains, []string{"internal", "local", "test"}) {
+			t.Errorf("Unexpected resolver domains %v", domains)
+		}
+		if fake.Flushes() != 1 {
+			t.Errorf("Expected the cache to be flushed once, got %d", fake.Flushes())
+		}
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		// A VPN client overwrites the resolver configuration
+		fake.BreakResolver()
+		waitFor(t, "the resolver to be restored", func() bool {
+			ip, _ := fake.Resolver()
+			return ip == bindIP
+		})
+	})
+
+	t.Run("Shutdown", func(t *testing.T) {
+		stopped = true
+		if err := server.Shutdown(context.Background()); err != nil {
+			t.Fatalf("Shutdown failed: %v", err)
+		}
+		if aliases := fake.Aliases(); len(aliases) != 0 {
+			t.Errorf("Expected the alias to be released, got %v", aliases)
+		}
+		if ip, _ := fake.Resolver(); ip != "" {
+			t.Errorf("Expected the resolver to be cleaned up, got %s", ip)
+		}
+		if state := journal.State(); !state.Empty() {
+			t.Errorf("Expected nothing left to undo, got %+v", state)
+		}
+	})
+}
+
+// newBindTestServer creates a server on a free port persisting its bind IP
+// to bindIPFile
+func newBindTestServer(t *testing.T, fake *platform.Fake, bindIPFile string, cfg *reghost.Config) *dns.Server {
+	t.Helper()
+
+	server := dns.NewServer(dns.NewCache(nil), newTestLogger(t), fake)
+	server.Configure(cfg)
+	server.SetPort(freePort(t))
+	server.SetBindIPFile(bindIPFile)
+	return server
+}
+
+func TestServerBindIP(t *testing.T) {
+	shutdown := func(t *testing.T, server *dns.Server) {
+		t.Helper()
+		if err := server.Shutdown(context.Background()); err != nil {
+			t.Fatalf("Shutdown failed: %v", err)
+		}
+	}
+
+	t.Run("ReusedAcrossRestarts", func(t *testing.T) {
+		bindIPFile := filepath.Join(t.TempDir(), "bind-ip")
+
+		first := newBindTestServer(t, platform.NewFake(), bindIPFile, &reghost.Config{})
+		if err := first.Start(); err != nil {
+			t.Fatalf("Start failed: %v", err)
+		}
+		ip := first.GetBindIP()
+		shutdown(t, first)
+
+		if saved, err := sysstate.LoadBindIP(bindIPFile); err != nil || saved != ip {
+			t.Fatalf("Expected %s to be persisted, got %q (%v)", ip, saved, err)
+		}
+
+		second := newBindTestServer(t, platform.NewFake(), bindIPFile, &reghost.Config{})
+		if err := second.Start(); err != nil {
+			t.Fatalf("Start failed: %v", err)
+		}
+		defer shutdown(t, second)
+		if second.GetBindIP() != ip {
+			t.Errorf("Expected %s to be reused, got %s", ip, second.GetBindIP())
+		}
+	})
+
+	t.Run("PersistedIPInUse", func(t *testing.T) {
+		bindIPFile := filepath.Join(t.TempDir(), "bind-ip")
+		if err := sysstate.SaveBindIP(bindIPFile, "127.1.2.3"); err != nil {
+			t.Fatal(err)
+		}
+		fake := platform.NewFake()
+		fake.AddAlias("127.1.2.3") // Added by another program
+
+		server := newBindTestServer(t, fake, bindIPFile, &reghost.Config{})
+		if err := server.Start(); err != nil {
+			t.Fatalf("Start failed: %v", err)
+		}
+		ip := server.GetBindIP()
+		if ip == "127.1.2.3" {
+			t.Fatal("Expected an IP owned by another program to be skipped")
+		}
+		if saved, _ := sysstate.LoadBindIP(bindIPFile); saved != ip {
+			t.Errorf("Expected the new IP %s to be persisted, got %s", ip, saved)
+		}
+
+		shutdown(t, server)
+		if !slices.Equal(fake.Aliases(), []string{"127.1.2.3"}) {
+			t.Errorf("Expected only the other program's alias to remain, got %v", fake.Aliases())
+		}
+	})
+
+	t.Run("Fixed", func(t *testing.T) {
+		bindIPFile := filepath.Join(t.TempDir(), "bind-ip")
+		fake := platform.NewFake()
+
+		server := newBindTestServer(t, fake, bindIPFile, &reghost.Config{BindIP: "127.77.0.1"})
+		if err := server.Start(); err != nil {
+			t.Fatalf("Start failed: %v", err)
+		}
+		if server.GetBindIP() != "127.77.0.1" {
+			t.Errorf("Expected the configured IP, got %s", server.GetBindIP())
+		}
+		shutdown(t, server)
+
+		if saved, _ := sysstate.LoadBindIP(bindIPFile); saved != "" {
+			t.Errorf("Expected a configured IP not to be persisted, got %s", saved)
+		}
+		if aliases := fake.Aliases(); len(aliases) != 0 {
+			t.Errorf("Expected the alias to be released, got %v", aliases)
+		}
+	})
+
+	t.Run("FixedExistingAlias", func(t *testing.T) {
+		// The alias is part of the system's network configuration
+		fake := platform.NewFake()
+		fake.AddAlias("127.77.0.1")
+
+		server := newBindTestServer(t, fake, "", &reghost.Config{BindIP: "127.77.0.1"})
+		if err := server.Start(); err != nil {
+			t.Fatalf("Start failed: %v", err)
+		}
+		shutdown(t, server)
+
+		if !slices.Equal(fake.Aliases(), []string{"127.77.0.1"}) {
+			t.Errorf("Expected the existing alias to be kept, got %v", fake.Aliases())
+		}
+	})
+
+	t.Run("FixedPortInUse", func(t *testing.T) {
+		fake := platform.NewFake()
+		server := newBindTestServer(t, fake, "", &reghost.Config{BindIP: "127.77.0.2"})
+		port := freePort(t)
+		server.SetPort(port)
+
+		conn, err := net.ListenPacket("udp", net.JoinHostPort("127.77.0.2", strconv.Itoa(port)))
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		defer conn.Close()
+
+		if err := server.Start(); err == nil {
+			server.Shutdown(context.Background())
+			t.Fatal("Expected Start to fail while the port is in use")
+		}
+		if aliases := fake.Aliases(); len(aliases) != 0 {
+			t.Errorf("Expected the alias to be released, got %v", aliases)
+		}
+	})
+}
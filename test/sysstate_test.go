@@ -0,0 +1,346 @@
+package test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/bilgehannal/reghost/internal/hosts"
+	"github.com/bilgehannal/reghost/internal/sysstate"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+// fakeNetwork holds loopback aliases and links in memory
+type fakeNetwork struct {
+	aliases map[string]bool
+	links   map[string]bool
+	err     error
+}
+
+func (n *fakeNetwork) HasAlias(ip string) bool {
+	return n.aliases[ip]
+}
+
+func (n *fakeNetwork) RemoveAlias(ip string) error {
+	if n.err != nil {
+		return n.err
+	}
+	delete(n.aliases, ip)
+	return nil
+}
+
+func (n *fakeNetwork) HasLink(name string) bool {
+	return n.links[name]
+}
+
+func (n *fakeNetwork) RemoveLink(name string) error {
+	delete(n.links, name)
+	return nil
+}
+
+// testPaths are the files the changes of crashedState are made to
+func testPaths(dir string) sysstate.Paths {
+	return sysstate.Paths{
+		ResolvConf:  filepath.Join(dir, "resolv.conf"),
+		ResolverDir: filepath.Join(dir, "resolver"),
+		HostsFiles:  []string{filepath.Join(dir, "hosts")},
+	}
+}
+
+// writeStateFile writes a state file the way reghostd does, readable only
+// by its owner
+func writeStateFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// crashedState records changes of a daemon that is no longer running
+// through a journal, the way reghostd does
+func crashedState(t *testing.T, dir string) (string, *sysstate.ResolvConfBackup) {
+	t.Helper()
+
+	statePath := filepath.Join(dir, "state.json")
+	journal := sysstate.NewJournal(statePath)
+
+	resolvConf := filepath.Join(dir, "resolv.conf")
+	original := "nameserver 10.0.0.53\nsearch corp\n"
+	backup := &sysstate.ResolvConfBackup{Path: resolvConf, Nameserver: "nameserver 127.1.2.3", Original: original}
+	writeTestFile(t, resolvConf, backup.Nameserver+"\n"+original)
+
+	resolverFile := filepath.Join(dir, "resolver", "local")
+	writeTestFile(t, resolverFile, "nameserver 127.1.2.3\nport 53\n")
+
+	hostsFile := filepath.Join(dir, "hosts")
+	writeTestFile(t, hostsFile, string(hosts.Render([]byte(systemHostsFile), []reghost.Record{{Domain: "api.local", IP: "10.0.0.1"}})))
+
+	for _, err := range []error{
+		journal.AddLoopbackAlias("127.1.2.3"),
+		journal.AddLink("reghost0"),
+		journal.SetResolvConf(backup),
+		journal.AddResolverFile(resolverFile),
+		journal.AddHostsFile(hostsFile),
+	} {
+		if err != nil {
+			t.Fatalf("Journal failed: %v", err)
+		}
+	}
+
+	// The daemon was killed: nothing was undone and its pid is gone
+	state, err := sysstate.Load(statePath)
+	if err != nil || state == nil {
+		t.Fatalf("Expected a state file, got %v, %v", state, err)
+	}
+	if state.Running() {
+		t.Fatal("Expected the state of the test process not to count as running")
+	}
+	return statePath, backup
+}
+
+func TestJournalClose(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	journal := sysstate.NewJournal(statePath)
+
+	if err := journal.AddLoopbackAlias("127.1.2.3"); err != nil {
+		t.Fatalf("AddLoopbackAlias failed: %v", err)
+	}
+
+	// A change that could not be undone keeps the state file
+	if err := journal.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := os.Stat(statePath); err != nil {
+		t.Fatalf("Expected the state file to be kept: %v", err)
+	}
+
+	if err := journal.RemoveLoopbackAlias("127.1.2.3"); err != nil {
+		t.Fatalf("RemoveLoopbackAlias failed: %v", err)
+	}
+	if err := journal.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if _, err := os.Stat(statePath); !os.IsNotExist(err) {
+		t.Errorf("Expected the state file to be removed, got %v", err)
+	}
+
+	// A nil journal records nothing
+	var none *sysstate.Journal
+	if err := none.AddLoopbackAlias("127.1.2.3"); err != nil {
+		t.Errorf("Expected a nil journal to do nothing, got %v", err)
+	}
+}
+
+func TestRepair(t *testing.T) {
+	dir := t.TempDir()
+	statePath, backup := crashedState(t, dir)
+	loopback := &fakeNetwork{aliases: map[string]bool{"127.1.2.3": true}, links: map[string]bool{"reghost0": true}}
+
+	leftovers, err := sysstate.Repair(statePath, loopback, testPaths(dir))
+	if err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	if len(leftovers) != 5 {
+		t.Errorf("Expected 5 leftovers, got %d", len(leftovers))
+	}
+
+	if loopback.aliases["127.1.2.3"] {
+		t.Error("Loopback alias not removed")
+	}
+	if loopback.links["reghost0"] {
+		t.Error("Link not removed")
+	}
+	if data, _ := os.ReadFile(backup.Path); string(data) != backup.Original {
+		t.Errorf("resolv.conf not restored:\n%s", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "resolver", "local")); !os.IsNotExist(err) {
+		t.Error("Resolver file not removed")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "hosts")); string(data) != systemHostsFile {
+		t.Errorf("Hosts file not cleaned up:\n%s", data)
+	}
+	if _, err := os.Stat(statePath); !os.IsNotExist(err) {
+		t.Error("State file not removed")
+	}
+
+	// Nothing is left to do
+	leftovers, err = sysstate.Repair(statePath, loopback, testPaths(dir))
+	if err != nil || len(leftovers) != 0 {
+		t.Errorf("Expected nothing to repair, got %v, %v", leftovers, err)
+	}
+}
+
+func TestRepairEditedResolvConf(t *testing.T) {
+	dir := t.TempDir()
+	statePath, backup := crashedState(t, dir)
+
+	// The network manager rewrote resolv.conf after reghostd added to it
+	writeTestFile(t, backup.Path, backup.Nameserver+"\nnameserver 192.168.1.1\n")
+
+	if _, err := sysstate.Repair(statePath, &fakeNetwork{}, testPaths(dir)); err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	if data, _ := os.ReadFile(backup.Path); string(data) != "nameserver 192.168.1.1\n" {
+		t.Errorf("Expected only the reghost nameserver to be removed, got:\n%s", data)
+	}
+}
+
+func TestRepairPartialFailure(t *testing.T) {
+	dir := t.TempDir()
+	statePath, _ := crashedState(t, dir)
+	loopback := &fakeNetwork{aliases: map[string]bool{"127.1.2.3": true}, err: errors.New("operation not permitted")}
+
+	if _, err := sysstate.Repair(statePath, loopback, testPaths(dir)); err == nil || !strings.Contains(err.Error(), "127.1.2.3") {
+		t.Fatalf("Expected the alias removal to fail, got %v", err)
+	}
+
+	// Only the change that could not be undone is kept
+	state, err := sysstate.Load(statePath)
+	if err != nil || state == nil {
+		t.Fatalf("Expected the state file to be kept, got %v", err)
+	}
+	if len(state.LoopbackAliases) != 1 || state.ResolvConf != nil || len(state.ResolverFiles) != 0 || len(state.HostsFiles) != 0 {
+		t.Errorf("Unexpected remaining state: %+v", state)
+	}
+}
+
+func TestRepairRunningDaemon(t *testing.T) {
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, "state.json")
+	writeStateFile(t, statePath, `{"pid": `+strconv.Itoa(os.Getppid())+`, "loopbackAliases": ["127.1.2.3"]}`)
+
+	loopback := &fakeNetwork{aliases: map[string]bool{"127.1.2.3": true}}
+	if _, err := sysstate.Repair(statePath, loopback, testPaths(dir)); !errors.Is(err, sysstate.ErrRunning) {
+		t.Fatalf("Expected ErrRunning, got %v", err)
+	}
+	if !loopback.aliases["127.1.2.3"] {
+		t.Error("Changes of a running daemon were undone")
+	}
+}
+
+func TestRepairReusedPID(t *testing.T) {
+	bootID, err := os.ReadFile("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		t.Skip("boot id not available:", err)
+	}
+	exe, err := os.Readlink("/proc/" + strconv.Itoa(os.Getppid()) + "/exe")
+	if err != nil {
+		t.Skip("process executable not available:", err)
+	}
+
+	tests := []struct {
+		name       string
+		bootID     string
+		executable string
+		running    bool
+	}{
+		{"same process", strings.TrimSpace(string(bootID)), exe, true},
+		{"before a reboot", "2f1b1c5e-0000-4000-8000-000000000000", exe, false},
+		{"other executable", strings.TrimSpace(string(bootID)), "/usr/sbin/reghostd", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			statePath := filepath.Join(dir, "state.json")
+			writeStateFile(t, statePath, `{"pid": `+strconv.Itoa(os.Getppid())+`, "bootID": "`+tt.bootID+`", "executable": "`+tt.executable+`", "loopbackAliases": ["127.1.2.3"]}`)
+
+			loopback := &fakeNetwork{aliases: map[string]bool{"127.1.2.3": true}}
+			_, err := sysstate.Repair(statePath, loopback, testPaths(dir))
+			if running := errors.Is(err, sysstate.ErrRunning); running != tt.running {
+				t.Fatalf("Expected running=%v, got %v", tt.running, err)
+			}
+			if !tt.running && loopback.aliases["127.1.2.3"] {
+				t.Error("Changes of a process reusing the pid were not undone")
+			}
+		})
+	}
+}
+
+func TestRepairOnlyReghostFiles(t *testing.T) {
+	dir := t.TempDir()
+	statePath, backup := crashedState(t, dir)
+
+	// The same changes made to files reghostd never changes
+	other := t.TempDir()
+	paths := testPaths(other)
+	writeTestFile(t, paths.ResolvConf, "nameserver 10.0.0.53\n")
+
+	leftovers, err := sysstate.Repair(statePath, &fakeNetwork{}, paths)
+	if err != nil {
+		t.Fatalf("Repair failed: %v", err)
+	}
+	if len(leftovers) != 0 {
+		t.Errorf("Expected no leftovers outside the allowed paths, got %d", len(leftovers))
+	}
+	if data, _ := os.ReadFile(backup.Path); string(data) == backup.Original {
+		t.Error("resolv.conf outside the allowed paths was restored")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "resolver", "local")); err != nil {
+		t.Error("Resolver file outside the allowed paths was removed")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "hosts")); string(data) == systemHostsFile {
+		t.Error("Hosts file outside the allowed paths was changed")
+	}
+}
+
+func TestLoadUntrustedState(t *testing.T) {
+	statePath := filepath.Join(t.TempDir(), "state.json")
+	writeTestFile(t, statePath, `{"pid": 1, "resolverFiles": ["/etc/resolver/local"]}`)
+
+	if _, err := sysstate.Load(statePath); err == nil || !strings.Contains(err.Error(), "0600") {
+		t.Fatalf("Expected a state file others can read to be refused, got %v", err)
+	}
+	if _, code := runCLI(t, "doctor", "--fix", "--state-file", statePath); code == 0 {
+		t.Error("Expected doctor to refuse the state file")
+	}
+}
+
+func TestDoctorCommand(t *testing.T) {
+	dir := t.TempDir()
+	statePath, backup := crashedState(t, dir)
+	hostsPath := filepath.Join(dir, "hosts")
+
+	// Only the hosts file of the config is among the files reghostd changes
+	configPath := filepath.Join(dir, "reghost.yml")
+	writeTestFile(t, configPath, `activeRecord: default
+hostsSync:
+  path: `+hostsPath+`
+records:
+  default:
+    - domain: api.local
+      ip: 10.0.0.1
+`)
+
+	out, code := runCLI(t, "-c", configPath, "doctor", "--state-file", statePath)
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, out)
+	}
+	if !strings.Contains(out, "Leftover managed block in "+hostsPath) || !strings.Contains(out, "doctor --fix") {
+		t.Errorf("Expected the leftovers to be listed, got:\n%s", out)
+	}
+	if strings.Contains(out, backup.Path) {
+		t.Errorf("Expected a resolv.conf reghostd does not change to be ignored, got:\n%s", out)
+	}
+	if _, err := os.Stat(statePath); err != nil {
+		t.Fatal("doctor without --fix changed the state")
+	}
+
+	// The loopback alias and link were lost with a reboot, so they are not
+	// reported
+	out, code = runCLI(t, "-c", configPath, "-o", "json", "doctor", "--fix", "--state-file", statePath)
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, got %d: %s", code, out)
+	}
+	if !strings.Contains(out, `"fixed": true`) || strings.Contains(out, "loopback alias") {
+		t.Errorf("Unexpected output:\n%s", out)
+	}
+	if data, _ := os.ReadFile(hostsPath); string(data) != systemHostsFile {
+		t.Errorf("Hosts file not cleaned up:\n%s", data)
+	}
+	if data, _ := os.ReadFile(backup.Path); string(data) == backup.Original {
+		t.Error("resolv.conf outside the files reghostd changes was restored")
+	}
+}
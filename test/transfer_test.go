@@ -0,0 +1,213 @@
+package test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bilgehannal/reghost/internal/dns"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+	mdns "github.com/miekg/dns"
+)
+
+const testTSIGSecret = "c2VjcmV0LXNlY3JldC1zZWNyZXQ="
+
+func newTransferConfig() *reghost.Config {
+	cfg := newZoneConfig()
+	cfg.TSIGKeys = []reghost.TSIGKey{{Name: "xfr-key", Secret: testTSIGSecret}}
+	cfg.Transfer = &reghost.Transfer{
+		Allow: []string{"10.1.0.0/16"},
+		Keys:  []string{"xfr-key"},
+	}
+	cfg.Samples = []string{"shop.web.dev.example", "unrelated.test"}
+	return cfg
+}
+
+func TestTransferValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *reghost.Config
+		wantErr bool
+	}{
+		{
+			name: "valid transfer",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "ns1.dev.example", IP: "10.0.0.53"}},
+				},
+				Zones: []reghost.Zone{
+					{Name: "dev.example", SOA: reghost.SOA{MName: "ns1.dev.example.", RName: "hostmaster@dev.example"}, NS: []string{"ns1.dev.example."}},
+				},
+				TSIGKeys: []reghost.TSIGKey{{Name: "xfr-key", Secret: testTSIGSecret}},
+				Transfer: &reghost.Transfer{Allow: []string{"10.1.0.0/16"}, Keys: []string{"xfr-key"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown transfer key",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "ns1.dev.example", IP: "10.0.0.53"}},
+				},
+				Zones: []reghost.Zone{
+					{Name: "dev.example", SOA: reghost.SOA{MName: "ns1.dev.example.", RName: "hostmaster@dev.example"}, NS: []string{"ns1.dev.example."}},
+				},
+				TSIGKeys: []reghost.TSIGKey{{Name: "xfr-key", Secret: testTSIGSecret}},
+				Transfer: &reghost.Transfer{Allow: []string{"10.1.0.0/16"}, Keys: []string{"missing-key"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid TSIG secret",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "ns1.dev.example", IP: "10.0.0.53"}},
+				},
+				Zones: []reghost.Zone{
+					{Name: "dev.example", SOA: reghost.SOA{MName: "ns1.dev.example.", RName: "hostmaster@dev.example"}, NS: []string{"ns1.dev.example."}},
+				},
+				TSIGKeys: []reghost.TSIGKey{{Name: "xfr-key", Secret: "not base64!"}},
+				Transfer: &reghost.Transfer{Allow: []string{"10.1.0.0/16"}, Keys: []string{"xfr-key"}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEnumerate(t *testing.T) {
+	matcher := reghost.NewMatcher([]reghost.Record{
+		{Domain: "a.test", IP: "1.1.1.1"},
+		{Domain: "^[a-z]+\\.test\\.$", IP: "2.2.2.2"},
+		{Domain: "A.test.", IP: "3.3.3.3"},
+	})
+
+	records := matcher.Enumerate([]string{"b.test", "1.other"})
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %v", records)
+	}
+	if records[0].Domain != "a.test." || records[0].IP != "1.1.1.1" {
+		t.Errorf("Unexpected first record: %v", records[0])
+	}
+	if records[1].Domain != "b.test." || records[1].IP != "2.2.2.2" {
+		t.Errorf("Unexpected sample record: %v", records[1])
+	}
+}
+
+func TestTransferAllowlist(t *testing.T) {
+	cfg := newTransferConfig()
+	cache := dns.NewCache(cfg.GetActiveRecords())
+	handler := dns.NewHandler(cache, newTestLogger(t))
+	handler.Configure(cfg)
+
+	serve := func(remote string, m *mdns.Msg) *mdns.Msg {
+		w := newFakeResponseWriter(remote)
+		w.remote = &net.TCPAddr{IP: net.ParseIP(remote), Port: 53535}
+		handler.ServeDNS(w, m)
+		return w.msg
+	}
+
+	t.Run("refused outside allowlist", func(t *testing.T) {
+		m := serve("192.168.1.1", query("dev.example", mdns.TypeAXFR))
+		if m.Rcode != mdns.RcodeRefused {
+			t.Errorf("Expected REFUSED, got %s", mdns.RcodeToString[m.Rcode])
+		}
+	})
+
+	t.Run("AXFR from allowlist", func(t *testing.T) {
+		m := serve("10.1.2.3", query("dev.example", mdns.TypeAXFR))
+		if len(m.Answer) < 2 {
+			t.Fatalf("Expected zone content, got %v", m)
+		}
+		if m.Answer[0].Header().Rrtype != mdns.TypeSOA || m.Answer[len(m.Answer)-1].Header().Rrtype != mdns.TypeSOA {
+			t.Errorf("Transfer must start and end with SOA: %v", m.Answer)
+		}
+
+		names := make(map[string]bool)
+		for _, rr := range m.Answer {
+			if a, ok := rr.(*mdns.A); ok {
+				names[a.Hdr.Name] = true
+			}
+		}
+		for _, want := range []string{"api.dev.example.", "ns1.dev.example.", "shop.web.dev.example."} {
+			if !names[want] {
+				t.Errorf("Expected %s in transfer, got %v", want, names)
+			}
+		}
+		if names["myhost."] {
+			t.Error("Records outside the zone must not be transferred")
+		}
+	})
+
+	t.Run("IXFR up to date", func(t *testing.T) {
+		m := query("dev.example", mdns.TypeIXFR)
+		m.Ns = []mdns.RR{&mdns.SOA{
+			Hdr:    mdns.RR_Header{Name: "dev.example.", Rrtype: mdns.TypeSOA, Class: mdns.ClassINET},
+			Serial: 42,
+		}}
+		resp := serve("10.1.2.3", m)
+		if len(resp.Answer) != 1 || resp.Answer[0].Header().Rrtype != mdns.TypeSOA {
+			t.Errorf("Expected single SOA for current serial, got %v", resp.Answer)
+		}
+	})
+}
+
+func TestTransferTSIG(t *testing.T) {
+	cfg := newTransferConfig()
+	cfg.Transfer.Allow = nil
+
+	cache := dns.NewCache(cfg.GetActiveRecords())
+	handler := dns.NewHandler(cache, newTestLogger(t))
+	handler.Configure(cfg)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &mdns.Server{Listener: listener, Handler: handler, TsigProvider: handler.TsigProvider()}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	transfer := func(secret map[string]string) ([]mdns.RR, error) {
+		m := query("dev.example", mdns.TypeAXFR)
+		if secret != nil {
+			m.SetTsig("xfr-key.", mdns.HmacSHA256, 300, time.Now().Unix())
+		}
+		tr := &mdns.Transfer{TsigSecret: secret}
+		env, err := tr.In(m, listener.Addr().String())
+		if err != nil {
+			return nil, err
+		}
+		var rrs []mdns.RR
+		for e := range env {
+			if e.Error != nil {
+				return nil, e.Error
+			}
+			rrs = append(rrs, e.RR...)
+		}
+		return rrs, nil
+	}
+
+	rrs, err := transfer(map[string]string{"xfr-key.": testTSIGSecret})
+	if err != nil {
+		t.Fatalf("Signed transfer failed: %v", err)
+	}
+	if len(rrs) < 3 {
+		t.Errorf("Expected zone content, got %v", rrs)
+	}
+
+	if _, err := transfer(nil); err == nil {
+		t.Error("Expected unsigned transfer outside the allowlist to fail")
+	}
+}
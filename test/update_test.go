@@ -0,0 +1,341 @@
+package test
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bilgehannal/reghost/internal/config"
+	"github.com/bilgehannal/reghost/internal/dns"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+	mdns "github.com/miekg/dns"
+)
+
+// startUpdateServer serves the handler over UDP on an ephemeral port
+func startUpdateServer(t *testing.T, handler *dns.Handler) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	server := &mdns.Server{
+		PacketConn:    conn,
+		Handler:       handler,
+		TsigProvider:  handler.TsigProvider(),
+		MsgAcceptFunc: dns.AcceptMsg,
+	}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+	return conn.LocalAddr().String()
+}
+
+// sendUpdate sends an UPDATE message, signed when sign is true
+func sendUpdate(t *testing.T, addr string, m *mdns.Msg, sign bool) int {
+	t.Helper()
+
+	client := &mdns.Client{}
+	if sign {
+		client.TsigSecret = map[string]string{"update-key.": testTSIGSecret}
+		m.SetTsig("update-key.", mdns.HmacSHA256, 300, time.Now().Unix())
+	}
+	resp, _, err := client.Exchange(m, addr)
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	return resp.Rcode
+}
+
+func newUpdateConfig(persist bool) *reghost.Config {
+	cfg := newZoneConfig()
+	cfg.TSIGKeys = []reghost.TSIGKey{{Name: "update-key", Secret: testTSIGSecret}}
+	cfg.Update = &reghost.Update{Keys: []string{"update-key"}}
+	if persist {
+		cfg.Update.Persist = true
+		cfg.Update.RecordSet = "default"
+	}
+	return cfg
+}
+
+func TestUpdateValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *reghost.Config
+		wantErr bool
+	}{
+		{
+			name: "ephemeral updates",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "ns1.dev.example", IP: "10.0.0.53"}},
+				},
+				Zones: []reghost.Zone{
+					{Name: "dev.example", SOA: reghost.SOA{MName: "ns1.dev.example.", RName: "hostmaster@dev.example"}, NS: []string{"ns1.dev.example."}},
+				},
+				TSIGKeys: []reghost.TSIGKey{{Name: "update-key", Secret: testTSIGSecret}},
+				Update:   &reghost.Update{Keys: []string{"update-key"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "persisted updates",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "ns1.dev.example", IP: "10.0.0.53"}},
+				},
+				Zones: []reghost.Zone{
+					{Name: "dev.example", SOA: reghost.SOA{MName: "ns1.dev.example.", RName: "hostmaster@dev.example"}, NS: []string{"ns1.dev.example."}},
+				},
+				TSIGKeys: []reghost.TSIGKey{{Name: "update-key", Secret: testTSIGSecret}},
+				Update:   &reghost.Update{Keys: []string{"update-key"}, Persist: true, RecordSet: "default"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "no update key",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "ns1.dev.example", IP: "10.0.0.53"}},
+				},
+				Zones: []reghost.Zone{
+					{Name: "dev.example", SOA: reghost.SOA{MName: "ns1.dev.example.", RName: "hostmaster@dev.example"}, NS: []string{"ns1.dev.example."}},
+				},
+				TSIGKeys: []reghost.TSIGKey{{Name: "update-key", Secret: testTSIGSecret}},
+				Update:   &reghost.Update{},
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown update key",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "ns1.dev.example", IP: "10.0.0.53"}},
+				},
+				Zones: []reghost.Zone{
+					{Name: "dev.example", SOA: reghost.SOA{MName: "ns1.dev.example.", RName: "hostmaster@dev.example"}, NS: []string{"ns1.dev.example."}},
+				},
+				TSIGKeys: []reghost.TSIGKey{{Name: "update-key", Secret: testTSIGSecret}},
+				Update:   &reghost.Update{Keys: []string{"missing-key"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "persisted without record set",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "ns1.dev.example", IP: "10.0.0.53"}},
+				},
+				Zones: []reghost.Zone{
+					{Name: "dev.example", SOA: reghost.SOA{MName: "ns1.dev.example.", RName: "hostmaster@dev.example"}, NS: []string{"ns1.dev.example."}},
+				},
+				TSIGKeys: []reghost.TSIGKey{{Name: "update-key", Secret: testTSIGSecret}},
+				Update:   &reghost.Update{Keys: []string{"update-key"}, Persist: true},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDynamicUpdateEphemeral(t *testing.T) {
+	cfg := newUpdateConfig(false)
+
+	cache := dns.NewCache(cfg.GetActiveRecords())
+	handler := dns.NewHandler(cache, newTestLogger(t))
+	handler.Configure(cfg)
+	addr := startUpdateServer(t, handler)
+
+	newRR := func(s string) mdns.RR {
+		rr, err := mdns.NewRR(s)
+		if err != nil {
+			t.Fatalf("NewRR(%s): %v", s, err)
+		}
+		return rr
+	}
+
+	t.Run("unsigned update is rejected", func(t *testing.T) {
+		m := new(mdns.Msg)
+		m.SetUpdate("dev.example.")
+		m.Insert([]mdns.RR{newRR("web.dev.example. 60 IN A 10.9.9.9")})
+		if rcode := sendUpdate(t, addr, m, false); rcode != mdns.RcodeNotAuth {
+			t.Errorf("Expected NOTAUTH, got %s", mdns.RcodeToString[rcode])
+		}
+	})
+
+	t.Run("add record", func(t *testing.T) {
+		m := new(mdns.Msg)
+		m.SetUpdate("dev.example.")
+		m.NameNotUsed([]mdns.RR{newRR("web.dev.example. 0 IN A 0.0.0.0")})
+		m.Insert([]mdns.RR{newRR("web.dev.example. 60 IN A 10.9.9.9")})
+		if rcode := sendUpdate(t, addr, m, true); rcode != mdns.RcodeSuccess {
+			t.Fatalf("Expected NOERROR, got %s", mdns.RcodeToString[rcode])
+		}
+		if ip, found := cache.Lookup("web.dev.example."); !found || ip != "10.9.9.9" {
+			t.Errorf("Expected runtime record, got %s (found=%v)", ip, found)
+		}
+	})
+
+	t.Run("prerequisite fails", func(t *testing.T) {
+		m := new(mdns.Msg)
+		m.SetUpdate("dev.example.")
+		m.NameNotUsed([]mdns.RR{newRR("web.dev.example. 0 IN A 0.0.0.0")})
+		m.Insert([]mdns.RR{newRR("web.dev.example. 60 IN A 10.8.8.8")})
+		if rcode := sendUpdate(t, addr, m, true); rcode != mdns.RcodeYXDomain {
+			t.Errorf("Expected YXDOMAIN, got %s", mdns.RcodeToString[rcode])
+		}
+	})
+
+	t.Run("runtime records survive reload", func(t *testing.T) {
+		cache.Update(cfg.GetActiveRecords())
+		if _, found := cache.Lookup("web.dev.example."); !found {
+			t.Error("Runtime record lost after cache update")
+		}
+	})
+
+	t.Run("delete record", func(t *testing.T) {
+		m := new(mdns.Msg)
+		m.SetUpdate("dev.example.")
+		m.RemoveName([]mdns.RR{newRR("web.dev.example. 0 IN A 0.0.0.0")})
+		if rcode := sendUpdate(t, addr, m, true); rcode != mdns.RcodeSuccess {
+			t.Fatalf("Expected NOERROR, got %s", mdns.RcodeToString[rcode])
+		}
+		if _, found := cache.Lookup("web.dev.example."); found {
+			t.Error("Record still present after delete")
+		}
+	})
+
+	t.Run("concurrent updates", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				m := new(mdns.Msg)
+				m.SetUpdate("dev.example.")
+				m.Insert([]mdns.RR{newRR(fmt.Sprintf("host%d.dev.example. 60 IN A 10.6.0.%d", i, i+1))})
+				if rcode := sendUpdate(t, addr, m, true); rcode != mdns.RcodeSuccess {
+					t.Errorf("Expected NOERROR, got %s", mdns.RcodeToString[rcode])
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		for i := 0; i < 20; i++ {
+			if _, found := cache.Lookup(fmt.Sprintf("host%d.dev.example.", i)); !found {
+				t.Errorf("Update of host%d.dev.example was lost", i)
+			}
+		}
+	})
+
+	t.Run("name outside zone", func(t *testing.T) {
+		m := new(mdns.Msg)
+		m.SetUpdate("dev.example.")
+		m.Insert([]mdns.RR{newRR("web.other.example. 60 IN A 10.9.9.9")})
+		if rcode := sendUpdate(t, addr, m, true); rcode != mdns.RcodeNotZone {
+			t.Errorf("Expected NOTZONE, got %s", mdns.RcodeToString[rcode])
+		}
+	})
+}
+
+func TestDynamicUpdatePersisted(t *testing.T) {
+	cfg := newUpdateConfig(true)
+	configPath := filepath.Join(t.TempDir(), "reghost.yml")
+	writer := config.NewWriter(configPath)
+	if err := writer.Write(cfg); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cache := dns.NewCache(cfg.GetActiveRecords())
+	handler := dns.NewHandler(cache, newTestLogger(t))
+	handler.Configure(cfg)
+	handler.SetRecordStore(writer)
+	addr := startUpdateServer(t, handler)
+
+	rr, _ := mdns.NewRR("api.dev.example. 60 IN A 10.7.7.7")
+	m := new(mdns.Msg)
+	m.SetUpdate("dev.example.")
+	m.Insert([]mdns.RR{rr})
+	if rcode := sendUpdate(t, addr, m, true); rcode != mdns.RcodeSuccess {
+		t.Fatalf("Expected NOERROR, got %s", mdns.RcodeToString[rcode])
+	}
+
+	loaded, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	records := loaded.Records["default"]
+	if records[0].Domain != "api.dev.example" || records[0].IP != "10.7.7.7" {
+		t.Errorf("Expected api.dev.example to be replaced in place, got %v", records)
+	}
+	if len(records) != len(cfg.Records["default"]) {
+		t.Errorf("Expected %d records, got %d", len(cfg.Records["default"]), len(records))
+	}
+
+	// Prerequisites see the persisted set before the served records reload
+	stale, _ := mdns.NewRR("api.dev.example. 0 IN A 10.0.0.1")
+	m = new(mdns.Msg)
+	m.SetUpdate("dev.example.")
+	m.Used([]mdns.RR{stale})
+	m.Insert([]mdns.RR{rr})
+	if rcode := sendUpdate(t, addr, m, true); rcode != mdns.RcodeNXRrset {
+		t.Errorf("Expected NXRRSET for a prerequisite on the replaced address, got %s", mdns.RcodeToString[rcode])
+	}
+
+	current, _ := mdns.NewRR("api.dev.example. 0 IN A 10.7.7.7")
+	next, _ := mdns.NewRR("api.dev.example. 60 IN A 10.7.7.8")
+	m = new(mdns.Msg)
+	m.SetUpdate("dev.example.")
+	m.Used([]mdns.RR{current})
+	m.Insert([]mdns.RR{next})
+	if rcode := sendUpdate(t, addr, m, true); rcode != mdns.RcodeSuccess {
+		t.Errorf("Expected NOERROR for a prerequisite on the persisted address, got %s", mdns.RcodeToString[rcode])
+	}
+}
+
+func TestDynamicUpdateInvalidResult(t *testing.T) {
+	cfg := newUpdateConfig(true)
+	cfg.Records["default"] = []reghost.Record{{Domain: "api.dev.example", IP: "10.0.0.1"}}
+	configPath := filepath.Join(t.TempDir(), "reghost.yml")
+	writer := config.NewWriter(configPath)
+	if err := writer.Write(cfg); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	handler := dns.NewHandler(dns.NewCache(cfg.GetActiveRecords()), newTestLogger(t))
+	handler.Configure(cfg)
+	handler.SetRecordStore(writer)
+	addr := startUpdateServer(t, handler)
+
+	// Deleting the last record would empty the active record set
+	rr, _ := mdns.NewRR("api.dev.example. 0 IN A 0.0.0.0")
+	m := new(mdns.Msg)
+	m.SetUpdate("dev.example.")
+	m.RemoveName([]mdns.RR{rr})
+	if rcode := sendUpdate(t, addr, m, true); rcode != mdns.RcodeRefused {
+		t.Fatalf("Expected REFUSED, got %s", mdns.RcodeToString[rcode])
+	}
+
+	loaded, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if len(loaded.Records["default"]) != 1 {
+		t.Errorf("Expected the refused update not to be persisted, got %v", loaded.Records["default"])
+	}
+}
@@ -0,0 +1,184 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bilgehannal/reghost/internal/config"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+func TestConcurrentWrites(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "reghost.yml")
+
+	initial := &reghost.Config{
+		ActiveRecord: "default",
+		Records: map[string][]reghost.Record{
+			"default": {{Domain: "reghost.local", IP: "127.0.0.1"}},
+		},
+	}
+	if err := config.NewWriter(configPath).Write(initial); err != nil {
+		t.Fatalf("Failed to write initial config: %v", err)
+	}
+
+	// Separate writers behave like separate CLI processes
+	const writers = 8
+	const perWriter = 5
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*perWriter)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			writer := config.NewWriter(configPath)
+			for j := 0; j < perWriter; j++ {
+				record := reghost.Record{Domain: fmt.Sprintf("host-%d-%d.local", i, j), IP: "10.0.0.1"}
+				if err := writer.AddRecord("default", record); err != nil {
+					errs <- err
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("AddRecord failed: %v", err)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if got, want := len(cfg.Records["default"]), writers*perWriter+1; got != want {
+		t.Errorf("Expected %d records, got %d", want, got)
+	}
+
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			t.Errorf("Temp file left behind: %s", entry.Name())
+		}
+	}
+}
+
+func TestWriteConflict(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "reghost.yml")
+	writeTestFile(t, configPath, `activeRecord: default
+records:
+  default:
+    - domain: reghost.local
+      ip: 127.0.0.1
+`)
+	if err := os.Chmod(configPath, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	writer := config.NewWriter(configPath)
+
+	// edit applies a record change while running during, which stands for a
+	// process editing the files without taking the lock
+	edit := func(domain string, during func()) error {
+		return writer.ModifyRecordSet("default", func(records []reghost.Record) ([]reghost.Record, error) {
+			during()
+			return append(records, reghost.Record{Domain: domain, IP: "10.0.0.1"}), nil
+		})
+	}
+
+	t.Run("Unchanged", func(t *testing.T) {
+		if err := edit("a.local", func() {}); err != nil {
+			t.Fatalf("ModifyRecordSet failed: %v", err)
+		}
+
+		info, err := os.Stat(configPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("Expected mode 0600 to be kept, got %o", info.Mode().Perm())
+		}
+	})
+
+	t.Run("ModifiedMainFile", func(t *testing.T) {
+		err := edit("c.local", func() {
+			data, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeTestFile(t, configPath, string(data)+"    - domain: b.local\n      ip: 10.0.0.2\n")
+		})
+		if !errors.Is(err, config.ErrConflict) {
+			t.Fatalf("Expected ErrConflict, got %v", err)
+		}
+
+		loaded, err := config.Load(configPath)
+		if err != nil {
+			t.Fatalf("Failed to load config: %v", err)
+		}
+		domains := make(map[string]bool)
+		for _, record := range loaded.Records["default"] {
+			domains[record.Domain] = true
+		}
+		if domains["c.local"] || !domains["b.local"] {
+			t.Errorf("Expected the edit by hand to be kept and the conflicting write dropped, got %+v", loaded.Records["default"])
+		}
+	})
+
+	t.Run("AddedFragment", func(t *testing.T) {
+		err := edit("d.local", func() {
+			writeTestFile(t, filepath.Join(config.FragmentDir(configPath), "extra.yml"), `records:
+  extra:
+    - domain: extra.local
+      ip: 10.0.0.4
+`)
+		})
+		if !errors.Is(err, config.ErrConflict) {
+			t.Fatalf("Expected ErrConflict, got %v", err)
+		}
+	})
+
+	t.Run("WriteAt", func(t *testing.T) {
+		// A revision read before the user decides on a change
+		cfg, revision, err := config.LoadWithRevision(configPath)
+		if err != nil {
+			t.Fatalf("LoadWithRevision failed: %v", err)
+		}
+		cfg.Records["default"] = append(cfg.Records["default"], reghost.Record{Domain: "e.local", IP: "10.0.0.5"})
+		if err := writer.WriteAt(cfg, revision); err != nil {
+			t.Fatalf("WriteAt failed: %v", err)
+		}
+
+		// Another writer changes the files in between
+		cfg, revision, err = config.LoadWithRevision(configPath)
+		if err != nil {
+			t.Fatalf("LoadWithRevision failed: %v", err)
+		}
+		if err := config.NewWriter(configPath).AddRecord("default", reghost.Record{Domain: "f.local", IP: "10.0.0.6"}); err != nil {
+			t.Fatalf("AddRecord failed: %v", err)
+		}
+		cfg.Records["default"] = append(cfg.Records["default"], reghost.Record{Domain: "g.local", IP: "10.0.0.7"})
+		if err := writer.WriteAt(cfg, revision); !errors.Is(err, config.ErrConflict) {
+			t.Fatalf("Expected ErrConflict, got %v", err)
+		}
+	})
+}
+
+// writeTestFile writes a file, creating its directory
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
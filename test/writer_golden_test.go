@@ -0,0 +1,139 @@
+package test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bilgehannal/reghost/internal/config"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files")
+
+func TestWriterGolden(t *testing.T) {
+	// input is the config file fixture, config.yml if empty. fragment is
+	// copied to reghost.d/team.yml, and result names the file compared to
+	// the golden file, the config file if empty.
+	tests := []struct {
+		golden   string
+		input    string
+		fragment string
+		result   string
+		edit     func(w *config.Writer) error
+	}{
+		{golden: "roundtrip.golden.yml", edit: func(w *config.Writer) error {
+			cfg, err := config.Load(w.Path())
+			if err != nil {
+				return err
+			}
+			return w.Write(cfg)
+		}},
+		{golden: "add-record.golden.yml", edit: func(w *config.Writer) error {
+			return w.AddRecord("record1", reghost.Record{Domain: "db.myhost", IP: "10.113.241.217"})
+		}},
+		{golden: "remove-record.golden.yml", edit: func(w *config.Writer) error {
+			return w.RemoveRecord("record1", 0)
+		}},
+		{golden: "set-active.golden.yml", edit: func(w *config.Writer) error {
+			return w.SetActiveRecord("tools")
+		}},
+		{golden: "activate.golden.yml", edit: func(w *config.Writer) error {
+			return w.ActivateRecordSet("staging")
+		}},
+		{golden: "extends-add.golden.yml", edit: func(w *config.Writer) error {
+			return w.AddRecord("tools", reghost.Record{Domain: "kibana.staging.local", IP: "10.0.0.21"})
+		}},
+		{golden: "create-delete-set.golden.yml", edit: func(w *config.Writer) error {
+			if err := w.CreateRecordSet("scratch"); err != nil {
+				return err
+			}
+			return w.DeleteRecordSet("mirror")
+		}},
+		{golden: "rename-set.golden.yml", edit: func(w *config.Writer) error {
+			return w.RenameRecordSet("record1", "personal")
+		}},
+		{golden: "anchors-add.golden.yml", input: "anchors.yml", edit: func(w *config.Writer) error {
+			return w.AddRecord("dev", reghost.Record{Domain: "db.dev.local", IP: "127.0.0.3"})
+		}},
+		{golden: "anchors-update.golden.yml", input: "anchors.yml", edit: func(w *config.Writer) error {
+			return w.UpdateRecord("staging", 0, func(r *reghost.Record) { r.IP = "10.0.0.12" })
+		}},
+		{golden: "flow-add.golden.yml", input: "flow.yml", edit: func(w *config.Writer) error {
+			return w.AddRecord("shared", reghost.Record{Domain: "mq.shared.local", IP: "10.0.0.7"})
+		}},
+		{golden: "flow-update.golden.yml", input: "flow.yml", edit: func(w *config.Writer) error {
+			return w.UpdateRecord("dev", 1, func(r *reghost.Record) { r.IP = "127.0.0.9" })
+		}},
+		{golden: "comments-remove.golden.yml", input: "comments.yml", edit: func(w *config.Writer) error {
+			return w.RemoveRecord("dev", 1)
+		}},
+		{golden: "comments-move.golden.yml", input: "comments.yml", edit: func(w *config.Writer) error {
+			return w.MoveRecord("dev", 2, 0)
+		}},
+		{golden: "comments-update.golden.yml", input: "comments.yml", edit: func(w *config.Writer) error {
+			return w.UpdateRecord("dev", 0, func(r *reghost.Record) { r.IP = "127.0.0.10" })
+		}},
+		{golden: "fragment-add.golden.yml", input: "fragments.yml", fragment: "fragment-team.yml", result: "reghost.d/team.yml", edit: func(w *config.Writer) error {
+			return w.AddRecord("team", reghost.Record{Domain: "ci.team.local", IP: "10.0.0.3"})
+		}},
+		{golden: "fragment-main.golden.yml", input: "fragments.yml", fragment: "fragment-team.yml", edit: func(w *config.Writer) error {
+			return w.AddRecord("mine", reghost.Record{Domain: "web.dev.local", IP: "127.0.0.2"})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			dir := t.TempDir()
+			configPath := filepath.Join(dir, "reghost.yml")
+
+			input := tt.input
+			if input == "" {
+				input = "config.yml"
+			}
+			copyTestdata(t, input, configPath)
+			if tt.fragment != "" {
+				copyTestdata(t, tt.fragment, filepath.Join(config.FragmentDir(configPath), "team.yml"))
+			}
+
+			if err := tt.edit(config.NewWriter(configPath)); err != nil {
+				t.Fatalf("Edit failed: %v", err)
+			}
+
+			resultPath := configPath
+			if tt.result != "" {
+				resultPath = filepath.Join(dir, tt.result)
+			}
+			got, err := os.ReadFile(resultPath)
+			if err != nil {
+				t.Fatalf("Failed to read result: %v", err)
+			}
+
+			goldenPath := filepath.Join("testdata", "writer", tt.golden)
+			if *updateGolden {
+				if err := os.WriteFile(goldenPath, got, 0644); err != nil {
+					t.Fatalf("Failed to update golden file: %v", err)
+				}
+			}
+
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("Failed to read golden file: %v", err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("Result differs from %s\n--- got ---\n%s\n--- want ---\n%s", goldenPath, got, want)
+			}
+		})
+	}
+}
+
+// copyTestdata copies a file of testdata/writer to path
+func copyTestdata(t *testing.T, name, path string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "writer", name))
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", name, err)
+	}
+	writeTestFile(t, path, string(data))
+}
@@ -0,0 +1,180 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/bilgehannal/reghost/internal/dns"
+	"github.com/bilgehannal/reghost/pkg/reghost"
+	mdns "github.com/miekg/dns"
+)
+
+func newZoneConfig() *reghost.Config {
+	return &reghost.Config{
+		ActiveRecord: "default",
+		Records: map[string][]reghost.Record{
+			"default": {
+				{Domain: "api.dev.example", IP: "10.0.0.1"},
+				{Domain: "ns1.dev.example", IP: "10.0.0.53"},
+				{Domain: "^[a-z]+\\.web\\.dev\\.example\\.$", IP: "10.0.0.2"},
+				{Domain: "myhost", IP: "10.0.0.3"},
+			},
+		},
+		Zones: []reghost.Zone{
+			{
+				Name: "dev.example",
+				SOA: reghost.SOA{
+					MName:  "ns1.dev.example.",
+					RName:  "hostmaster@dev.example",
+					Serial: 42,
+				},
+				NS: []string{"ns1.dev.example."},
+			},
+		},
+	}
+}
+
+func TestZoneValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *reghost.Config
+		wantErr bool
+	}{
+		{
+			name: "valid zone",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "ns1.dev.example", IP: "10.0.0.53"}},
+				},
+				Zones: []reghost.Zone{
+					{Name: "dev.example", SOA: reghost.SOA{MName: "ns1.dev.example.", RName: "hostmaster@dev.example"}, NS: []string{"ns1.dev.example."}},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "zone without NS records",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "ns1.dev.example", IP: "10.0.0.53"}},
+				},
+				Zones: []reghost.Zone{
+					{Name: "dev.example", SOA: reghost.SOA{MName: "ns1.dev.example.", RName: "hostmaster@dev.example"}},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "forward policy without forwarders",
+			config: &reghost.Config{
+				ActiveRecord: "default",
+				Records: map[string][]reghost.Record{
+					"default": {{Domain: "ns1.dev.example", IP: "10.0.0.53"}},
+				},
+				Zones: []reghost.Zone{
+					{Name: "dev.example", SOA: reghost.SOA{MName: "ns1.dev.example.", RName: "hostmaster@dev.example"}, NS: []string{"ns1.dev.example."}},
+				},
+				OutOfZone: reghost.OutOfZoneForward,
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFindZone(t *testing.T) {
+	zones := []reghost.Zone{{Name: "example."}, {Name: "dev.example."}}
+
+	if zone := reghost.FindZone(zones, "api.dev.example"); zone == nil || zone.Origin() != "dev.example." {
+		t.Errorf("Expected most specific zone dev.example., got %v", zone)
+	}
+	if zone := reghost.FindZone(zones, "notdev.example."); zone == nil || zone.Origin() != "example." {
+		t.Errorf("Expected zone example., got %v", zone)
+	}
+	if zone := reghost.FindZone(zones, "other.test."); zone != nil {
+		t.Errorf("Expected no zone, got %s", zone.Origin())
+	}
+}
+
+func TestAuthoritativeHandler(t *testing.T) {
+	cfg := newZoneConfig()
+	cache := dns.NewCache(cfg.GetActiveRecords())
+	handler := dns.NewHandler(cache, newTestLogger(t))
+	handler.Configure(cfg)
+
+	serve := func(name string, qtype uint16) *mdns.Msg {
+		w := newFakeResponseWriter("127.0.0.1")
+		handler.ServeDNS(w, query(name, qtype))
+		if w.msg == nil {
+			t.Fatalf("No response for %s", name)
+		}
+		return w.msg
+	}
+
+	t.Run("answer sets AA", func(t *testing.T) {
+		m := serve("api.dev.example", mdns.TypeA)
+		if !m.Authoritative || m.Rcode != mdns.RcodeSuccess || len(m.Answer) != 1 {
+			t.Fatalf("Unexpected response: %v", m)
+		}
+	})
+
+	t.Run("regex answer", func(t *testing.T) {
+		m := serve("shop.web.dev.example", mdns.TypeA)
+		if len(m.Answer) != 1 || m.Answer[0].(*mdns.A).A.String() != "10.0.0.2" {
+			t.Fatalf("Unexpected response: %v", m)
+		}
+	})
+
+	t.Run("NXDOMAIN carries SOA", func(t *testing.T) {
+		m := serve("missing.dev.example", mdns.TypeA)
+		if m.Rcode != mdns.RcodeNameError || !m.Authoritative {
+			t.Fatalf("Expected authoritative NXDOMAIN, got %v", m)
+		}
+		if len(m.Ns) != 1 || m.Ns[0].Header().Rrtype != mdns.TypeSOA {
+			t.Fatalf("Expected SOA in authority section, got %v", m.Ns)
+		}
+		if soa := m.Ns[0].(*mdns.SOA); soa.Serial != 42 || soa.Mbox != "hostmaster.dev.example." {
+			t.Errorf("Unexpected SOA: %v", soa)
+		}
+	})
+
+	t.Run("NODATA carries SOA", func(t *testing.T) {
+		m := serve("api.dev.example", mdns.TypeAAAA)
+		if m.Rcode != mdns.RcodeSuccess || len(m.Answer) != 0 || len(m.Ns) != 1 {
+			t.Fatalf("Expected NODATA with SOA, got %v", m)
+		}
+	})
+
+	t.Run("apex SOA and NS", func(t *testing.T) {
+		m := serve("dev.example", mdns.TypeSOA)
+		if len(m.Answer) != 1 || m.Answer[0].Header().Rrtype != mdns.TypeSOA {
+			t.Fatalf("Expected SOA answer, got %v", m)
+		}
+
+		m = serve("dev.example", mdns.TypeNS)
+		if len(m.Answer) != 1 || len(m.Extra) != 1 {
+			t.Fatalf("Expected NS answer with glue, got %v", m)
+		}
+	})
+
+	t.Run("out of zone", func(t *testing.T) {
+		m := serve("unknown.test", mdns.TypeA)
+		if m.Rcode != mdns.RcodeRefused {
+			t.Errorf("Expected REFUSED, got %s", mdns.RcodeToString[m.Rcode])
+		}
+
+		m = serve("myhost", mdns.TypeA)
+		if m.Authoritative || len(m.Answer) != 1 {
+			t.Errorf("Expected non-authoritative answer for record outside zones, got %v", m)
+		}
+	})
+}